@@ -0,0 +1,59 @@
+package base
+
+import (
+	crand "crypto/rand"
+	"io"
+	"sync"
+	"time"
+)
+
+// Clock is a function type that returns the current time.
+type Clock func() time.Time
+
+var (
+	envMu      sync.RWMutex
+	clock      Clock     = time.Now
+	randSource io.Reader = crand.Reader
+)
+
+// SetClock sets the clock used by all modules for timestamps and expirations, nil restores the system clock.
+// It's for tests and replay runs that need deterministic results.
+func SetClock(c Clock) {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if c == nil {
+		c = time.Now
+	}
+	clock = c
+}
+
+// Now returns the current time from the clock set by SetClock.
+func Now() time.Time {
+	envMu.RLock()
+	defer envMu.RUnlock()
+	return clock()
+}
+
+// SetRandSource sets the source of random bytes used by all modules for IDs, codes and jitters, nil restores crypto/rand.
+// It's for tests and replay runs that need deterministic results.
+func SetRandSource(r io.Reader) {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if r == nil {
+		r = crand.Reader
+	}
+	randSource = r
+}
+
+// RandReader returns the source of random bytes set by SetRandSource.
+func RandReader() io.Reader {
+	envMu.RLock()
+	defer envMu.RUnlock()
+	return randSource
+}
+
+// RandRead fills b with random bytes from the source set by SetRandSource.
+func RandRead(b []byte) error {
+	_, err := io.ReadFull(RandReader(), b)
+	return err
+}
@@ -4,6 +4,7 @@ package base
 import (
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/1set/starlet"
 	"github.com/1set/starlet/dataconv"
@@ -15,12 +16,18 @@ type ConfigGetter[T any] func() T
 
 // ConfigurableModule provides a generic base module that can be extended with different configurations.
 type ConfigurableModule[T any] struct {
-	configs map[string]ConfigGetter[T]
+	configs  map[string]ConfigGetter[T]
+	mu       sync.RWMutex
+	params   map[string][]string
+	defaults map[string]map[string]starlark.Value
 }
 
 // NewConfigurableModule creates a new instance of ConfigurableModule.
 func NewConfigurableModule[T any]() *ConfigurableModule[T] {
-	return &ConfigurableModule[T]{configs: make(map[string]ConfigGetter[T])}
+	return &ConfigurableModule[T]{
+		configs:  make(map[string]ConfigGetter[T]),
+		defaults: make(map[string]map[string]starlark.Value),
+	}
 }
 
 // SetConfig sets a configuration getter for a given name.
@@ -71,14 +78,118 @@ func (m *ConfigurableModule[T]) GetConfig(name string) (T, error) {
 	return getter(), nil
 }
 
+// SetDefaultKwarg sets the default value of the keyword argument for the function in the module, e.g. temperature for chat.
+// The default is used when the argument is not given, and nil value removes the default. It only applies to the parameters declared
+// for the function in LoadModule.
+func (m *ConfigurableModule[T]) SetDefaultKwarg(funcName, argName string, value starlark.Value) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if value == nil || value == starlark.None {
+		delete(m.defaults[funcName], argName)
+		return
+	}
+	if m.defaults[funcName] == nil {
+		m.defaults[funcName] = make(map[string]starlark.Value)
+	}
+	m.defaults[funcName][argName] = value
+}
+
+// genSetDefault generates a Starlark callable function to set the default keyword arguments for a function in the module.
+// The argument names are checked against the declared parameters of the function, so a typo fails here instead of every later call.
+func (m *ConfigurableModule[T]) genSetDefault(funcs starlark.StringDict) starlark.Callable {
+	return starlark.NewBuiltin("set_default", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var funcName string
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, nil, 1, &funcName); err != nil {
+			return nil, err
+		}
+		if _, ok := funcs[funcName].(*starlark.Builtin); !ok {
+			return nil, fmt.Errorf("%s: no function named %s", b.Name(), funcName)
+		}
+		m.mu.RLock()
+		names := m.params[funcName]
+		m.mu.RUnlock()
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%s: function %s doesn't accept default arguments", b.Name(), funcName)
+		}
+		for _, kv := range kwargs {
+			if argName := string(kv[0].(starlark.String)); !hasParam(names, argName) {
+				return nil, fmt.Errorf("%s: function %s has no parameter named %s", b.Name(), funcName, argName)
+			}
+		}
+		for _, kv := range kwargs {
+			m.SetDefaultKwarg(funcName, string(kv[0].(starlark.String)), kv[1])
+		}
+		return starlark.None, nil
+	})
+}
+
+// hasParam reports whether the parameter name is in the list.
+func hasParam(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyDefaultKwargs returns the keyword arguments with the defaults of the function filled in if they are not given.
+// It's for functions calling other functions of the module directly, e.g. email.send_all() calling send().
+func (m *ConfigurableModule[T]) ApplyDefaultKwargs(funcName string, kwargs []starlark.Tuple) []starlark.Tuple {
+	return m.applyDefaults(funcName, 0, kwargs)
+}
+
+// applyDefaults returns the keyword arguments with the defaults of the function appended, skipping the parameters given by keyword
+// or filled by the first numArgs positional arguments. Defaults of the names not declared for the function are ignored.
+func (m *ConfigurableModule[T]) applyDefaults(funcName string, numArgs int, kwargs []starlark.Tuple) []starlark.Tuple {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	defs := m.defaults[funcName]
+	if len(defs) == 0 {
+		return kwargs
+	}
+	names := m.params[funcName]
+	given := make(map[string]bool, len(kwargs)+numArgs)
+	for i := 0; i < numArgs && i < len(names); i++ {
+		given[names[i]] = true
+	}
+	for _, kv := range kwargs {
+		given[string(kv[0].(starlark.String))] = true
+	}
+	merged := append([]starlark.Tuple{}, kwargs...)
+	for _, name := range names {
+		if v, ok := defs[name]; ok && !given[name] {
+			merged = append(merged, starlark.Tuple{starlark.String(name), v})
+		}
+	}
+	return merged
+}
+
+// wrapDefaults wraps the builtin function to fill in the default keyword arguments which are not given.
+func (m *ConfigurableModule[T]) wrapDefaults(funcName string, fn *starlark.Builtin) *starlark.Builtin {
+	return starlark.NewBuiltin(fn.Name(), func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		return fn.CallInternal(thread, args, m.applyDefaults(funcName, len(args), kwargs))
+	})
+}
+
 // LoadModule returns a Starlark module loader with the given configurations and additional functions.
-func (m *ConfigurableModule[T]) LoadModule(moduleName string, additionalFuncs starlark.StringDict) starlet.ModuleLoader {
+// The params lists the parameter names of the functions in order, the builtin functions listed there accept default keyword
+// arguments set by SetDefaultKwarg or set_default() in Starlark.
+func (m *ConfigurableModule[T]) LoadModule(moduleName string, additionalFuncs starlark.StringDict, params map[string][]string) starlet.ModuleLoader {
+	m.mu.Lock()
+	m.params = params
+	m.mu.Unlock()
+
 	sd := starlark.StringDict{}
 	for name := range m.configs {
 		sd["set_"+name] = m.genSetConfig(name)
 	}
 	for k, v := range additionalFuncs {
+		if fn, ok := v.(*starlark.Builtin); ok {
+			v = m.wrapDefaults(k, fn)
+		}
 		sd[k] = v
 	}
+	sd["set_default"] = m.genSetDefault(additionalFuncs)
 	return dataconv.WrapModuleData(moduleName, sd)
 }
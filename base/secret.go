@@ -0,0 +1,132 @@
+package base
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretAction is the action taken when a configured secret is found in an outgoing payload.
+type SecretAction int
+
+const (
+	// SecretAllow sends the payload as it is, it's the default.
+	SecretAllow SecretAction = iota
+	// SecretBlock rejects the outgoing call with SecretLeakError.
+	SecretBlock
+	// SecretRedact replaces the secrets in the payload with RedactedSecret.
+	SecretRedact
+)
+
+// RedactedSecret is the placeholder of secrets redacted from outgoing payloads.
+const RedactedSecret = "[REDACTED]"
+
+// minSecretLength is the minimum length of values to scan for, shorter ones would cause false positives.
+const minSecretLength = 8
+
+var (
+	secretMu     sync.RWMutex
+	secretAction = SecretAllow
+	extraSecrets = make(map[string]string)
+)
+
+// secretKeywords are the parts of config names whose values are treated as secrets, e.g. resend_api_key, smtp_password.
+var secretKeywords = []string{"api_key", "password", "secret", "token"}
+
+// SecretLeakError is returned when an outgoing payload contains configured secrets and the guard blocks it.
+type SecretLeakError struct {
+	// Names are the config names of the secrets found, the values are never included.
+	Names []string
+}
+
+// Error implements the error interface.
+func (e *SecretLeakError) Error() string {
+	return fmt.Sprintf("outgoing payload contains secrets: %s", strings.Join(e.Names, ", "))
+}
+
+// SetSecretGuard sets the action for all modules when configured secrets are found in outgoing payloads, e.g. llm prompts and email bodies.
+func SetSecretGuard(action SecretAction) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretAction = action
+}
+
+// AddSecret adds a secret of the host to scan for in addition to the secrets in module configs, e.g. a database password.
+func AddSecret(name, value string) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	extraSecrets[name] = value
+}
+
+// isSecretName reports whether the config name looks like a secret.
+func isSecretName(name string) bool {
+	n := strings.ToLower(name)
+	for _, k := range secretKeywords {
+		if strings.Contains(n, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// secrets returns the secret values of the module configs and the ones added by AddSecret, keyed by their names.
+func (m *ConfigurableModule[T]) secrets() map[string]string {
+	res := make(map[string]string)
+	for name, getter := range m.configs {
+		if !isSecretName(name) || getter == nil {
+			continue
+		}
+		if v := fmt.Sprint(getter()); len(v) >= minSecretLength {
+			res[name] = v
+		}
+	}
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+	for name, v := range extraSecrets {
+		if len(v) >= minSecretLength {
+			res[name] = v
+		}
+	}
+	return res
+}
+
+// GuardSecrets scans the outgoing payloads for the configured secrets, and blocks or redacts them as set by SetSecretGuard.
+// It returns the payloads to send, which are redacted copies if any secret is found in redact mode.
+func (m *ConfigurableModule[T]) GuardSecrets(payloads ...string) ([]string, error) {
+	secretMu.RLock()
+	action := secretAction
+	secretMu.RUnlock()
+	if action == SecretAllow {
+		return payloads, nil
+	}
+
+	// find the secrets in payloads
+	secrets := m.secrets()
+	var found []string
+	for name, v := range secrets {
+		for _, p := range payloads {
+			if strings.Contains(p, v) {
+				found = append(found, name)
+				break
+			}
+		}
+	}
+	if len(found) == 0 {
+		return payloads, nil
+	}
+	sort.Strings(found)
+	if action == SecretBlock {
+		return nil, &SecretLeakError{Names: found}
+	}
+
+	// redact the found ones
+	res := make([]string, len(payloads))
+	for i, p := range payloads {
+		for _, name := range found {
+			p = strings.ReplaceAll(p, secrets[name], RedactedSecret)
+		}
+		res[i] = p
+	}
+	return res, nil
+}
@@ -0,0 +1,220 @@
+// Package auth provides a Starlark module for verification code workflows, with hashed codes stored in Charm KV.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet"
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"github.com/PureMature/starport/charm/ckv"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// ModuleName defines the expected name for this module when used in Starlark's load() function, e.g., load('auth', 'send_code')
+const ModuleName = "auth"
+
+// SenderFunc delivers the verification code to the recipient, e.g. by email or SMS.
+type SenderFunc func(ctx context.Context, to, code string) error
+
+// Module provides verification code functions, the codes are stored in the given Charm KV module.
+type Module struct {
+	store   *ckv.Module
+	senders map[string]SenderFunc
+}
+
+// NewModule creates a new instance of Module with the Charm KV module as the code storage.
+func NewModule(store *ckv.Module) *Module {
+	return &Module{
+		store:   store,
+		senders: make(map[string]SenderFunc),
+	}
+}
+
+// SetSender sets the sender function for the given channel name, e.g. "email" or "sms".
+func (m *Module) SetSender(via string, fn SenderFunc) {
+	m.senders[strings.ToLower(via)] = fn
+}
+
+// LoadModule returns the Starlark module loader with the auth-specific functions.
+func (m *Module) LoadModule() starlet.ModuleLoader {
+	sd := starlark.StringDict{
+		"send_code":   starlark.NewBuiltin(ModuleName+".send_code", m.sendCode),
+		"verify_code": starlark.NewBuiltin(ModuleName+".verify_code", m.verifyCode),
+	}
+	return dataconv.WrapModuleData(ModuleName, sd)
+}
+
+var (
+	none        = starlark.None
+	codeDB      = "starport.auth.codes"
+	codePrefix  = "code/"
+	maxAttempts = 5
+)
+
+// codeRecord is the stored state of a verification code, the code itself is never stored.
+type codeRecord struct {
+	Hash     string `json:"hash"`
+	Salt     string `json:"salt"`
+	Expires  int64  `json:"expires"`
+	Attempts int    `json:"attempts"`
+}
+
+// codeKey returns the storage key for the recipient, the recipient is hashed to avoid storing it in plain text.
+func codeKey(to string) []byte {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(to))))
+	return []byte(codePrefix + hex.EncodeToString(h[:]))
+}
+
+// hashCode returns the salted hash of the code.
+func hashCode(salt, code string) string {
+	h := sha256.Sum256([]byte(salt + ":" + code))
+	return hex.EncodeToString(h[:])
+}
+
+// generateCode returns a random numeric code with the given length.
+func generateCode(length int) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(base.RandReader(), big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(byte('0' + n.Int64()))
+	}
+	return sb.String(), nil
+}
+
+// generateSalt returns a random hex salt.
+func generateSalt() (string, error) {
+	b := make([]byte, 16)
+	if err := base.RandRead(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (m *Module) sendCode(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		to     tps.StringOrBytes
+		via    = tps.NewNullableStringOrBytes("email")
+		ttl    = tps.FloatOrInt(600)
+		length = 6
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "to", &to, "via?", via, "ttl?", &ttl, "length?", &length); err != nil {
+		return none, err
+	}
+	if to.IsEmpty() {
+		return none, errors.New("to must be non-empty")
+	}
+	if length < 4 || length > 12 {
+		return none, fmt.Errorf("length must be between 4 and 12, got %d", length)
+	}
+	if ttl <= 0 {
+		return none, errors.New("ttl must be positive")
+	}
+
+	// find the sender
+	sender, ok := m.senders[strings.ToLower(via.GoString())]
+	if !ok || sender == nil {
+		return none, fmt.Errorf("no sender for: %s", via.GoString())
+	}
+
+	// generate code and save its hash
+	code, err := generateCode(length)
+	if err != nil {
+		return none, err
+	}
+	salt, err := generateSalt()
+	if err != nil {
+		return none, err
+	}
+	rec := codeRecord{
+		Hash:    hashCode(salt, code),
+		Salt:    salt,
+		Expires: base.Now().Add(time.Duration(ttl.GoFloat64() * float64(time.Second))).Unix(),
+	}
+	if err := m.saveRecord(to.GoString(), &rec); err != nil {
+		return none, err
+	}
+
+	// deliver the code
+	ctx := dataconv.GetThreadContext(thread)
+	if err := sender(ctx, to.GoString(), code); err != nil {
+		return none, fmt.Errorf("send code: %w", err)
+	}
+	return none, nil
+}
+
+func (m *Module) verifyCode(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var to, code tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "to", &to, "code", &code); err != nil {
+		return none, err
+	}
+
+	// check and update the record in one transaction after syncing, so the concurrent guesses can't share the attempts
+	var (
+		ok  bool
+		key = codeKey(to.GoString())
+	)
+	err := m.store.Update(codeDB, func(txn *badger.Txn) error {
+		ok = false
+		item, err := txn.Get(key)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ckv.ErrSkipCommit
+			}
+			return err
+		}
+		var rec codeRecord
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &rec)
+		}); err != nil {
+			return err
+		}
+
+		// expired or too many attempts
+		if base.Now().Unix() > rec.Expires || rec.Attempts >= maxAttempts {
+			return txn.Delete(key)
+		}
+
+		// compare the hashes, the code can only be used once
+		expected := []byte(rec.Hash)
+		actual := []byte(hashCode(rec.Salt, strings.TrimSpace(code.GoString())))
+		if subtle.ConstantTimeCompare(expected, actual) == 1 {
+			ok = true
+			return txn.Delete(key)
+		}
+		rec.Attempts++
+		bs, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, bs)
+	})
+	if err != nil {
+		return none, err
+	}
+	return starlark.Bool(ok), nil
+}
+
+// saveRecord saves the code record of the recipient.
+func (m *Module) saveRecord(to string, rec *codeRecord) error {
+	bs, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return m.store.Set(codeDB, string(codeKey(to)), bs)
+}
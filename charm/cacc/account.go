@@ -39,6 +39,11 @@ func NewModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort base.
 	}
 }
 
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"set_username": {"name"},
+}
+
 // LoadModule returns the Starlark module loader with the email-specific functions.
 func (m *Module) LoadModule() starlet.ModuleLoader {
 	additionalFuncs := starlark.StringDict{
@@ -50,7 +55,7 @@ func (m *Module) LoadModule() starlet.ModuleLoader {
 		"get_key_files": starlark.NewBuiltin(ModuleName+".get_key_files", m.getKeyFiles),
 		"get_keys":      starlark.NewBuiltin(ModuleName+".get_keys", m.getKeys),
 	}
-	return m.ExtendModuleLoader(ModuleName, additionalFuncs)
+	return m.ExtendModuleLoader(ModuleName, additionalFuncs, funcParams)
 }
 
 var (
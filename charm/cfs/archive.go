@@ -0,0 +1,174 @@
+package cfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	gofs "io/fs"
+	"os"
+	"path"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/charmbracelet/charm/fs"
+	"go.starlark.net/starlark"
+)
+
+// archiveWriter adds files to the archive in the format.
+type archiveWriter interface {
+	add(name string, fi gofs.FileInfo, r io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) add(name string, fi gofs.FileInfo, r io.Reader) error {
+	h, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	h.Method = zip.Deflate
+	w, err := a.zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+type tarGzArchive struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarGzArchive) add(name string, fi gofs.FileInfo, r io.Reader) error {
+	h, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if h.Mode&0777 == 0 {
+		h.Mode |= 0644
+	}
+	if err := a.tw.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err = io.Copy(a.tw, r)
+	return err
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gw.Close()
+}
+
+// newArchiveWriter returns the writer of the archive format, i.e. zip or tar.gz.
+func newArchiveWriter(w io.Writer, format string) (archiveWriter, error) {
+	switch strings.ToLower(format) {
+	case "zip":
+		return &zipArchive{zw: zip.NewWriter(w)}, nil
+	case "tar.gz", "tgz":
+		gw := gzip.NewWriter(w)
+		return &tarGzArchive{gw: gw, tw: tar.NewWriter(gw)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+// archiveTree writes the files in the directory of Charm FS to the archive, with the paths relative to the directory.
+// It returns the number of files archived.
+func archiveTree(cf *fs.FS, dir string, aw archiveWriter) (int, error) {
+	cnt := 0
+	err := gofs.WalkDir(cf, dir, func(p string, d gofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := cf.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close() // nolint:errcheck
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(p, dir), "/")
+		if name == "" {
+			name = path.Base(p)
+		}
+		if err := aw.add(name, fi, f); err != nil {
+			return fmt.Errorf("archive %q: %w", p, err)
+		}
+		cnt++
+		return nil
+	})
+	return cnt, err
+}
+
+// archiveDir archives the directory of Charm FS into zip or tar.gz, it returns the bytes of the archive,
+// or writes it to the local dest and returns the number of files archived.
+func (m *Module) archiveDir(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name   tps.StringOrBytes
+		format = "zip"
+		dest   tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &name, "format?", &format, "dest?", &dest); err != nil {
+		return nil, err
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// write to the local file or memory
+	var (
+		buf *bytes.Buffer
+		out io.Writer
+		lf  *os.File
+	)
+	if dp := dest.GoString(); dp != "" {
+		if lf, err = os.Create(dp); err != nil {
+			return nil, err
+		}
+		defer lf.Close() // nolint:errcheck
+		out = lf
+	} else {
+		buf = bytes.NewBuffer(nil)
+		out = buf
+	}
+	aw, err := newArchiveWriter(out, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	cnt, err := archiveTree(cf, path.Clean(name.GoString()), aw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+
+	// return the bytes or the count
+	if lf == nil {
+		return starlark.Bytes(buf.Bytes()), nil
+	}
+	if err := lf.Close(); err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(cnt), nil
+}
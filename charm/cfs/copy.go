@@ -0,0 +1,124 @@
+package cfs
+
+import (
+	"errors"
+	"fmt"
+	gofs "io/fs"
+	"path"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/charmbracelet/charm/fs"
+	"go.starlark.net/starlark"
+)
+
+// copyFile copies the file within Charm FS, the mode of the source file is kept.
+func copyFile(cf *fs.FS, src, dst string) error {
+	f, err := cf.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint:errcheck
+	return cf.WriteFile(dst, f)
+}
+
+// copyTree copies the file, or the directory with all its contents, within Charm FS. It returns the number of files copied.
+func copyTree(cf *fs.FS, src, dst string) (int, error) {
+	fi, err := statPath(cf, src)
+	if err != nil {
+		return 0, err
+	}
+	if !fi.IsDir() {
+		return 1, copyFile(cf, src, dst)
+	}
+	if dst == src || strings.HasPrefix(dst, strings.TrimSuffix(src, "/")+"/") {
+		return 0, fmt.Errorf("cannot copy directory %s into itself: %s", src, dst)
+	}
+
+	// walk the source, and create the directories to keep the empty ones
+	cnt := 0
+	err = gofs.WalkDir(cf, src, func(p string, d gofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, strings.TrimPrefix(strings.TrimPrefix(p, src), "/"))
+		if d.IsDir() {
+			return cf.WriteFile(target, CreateVirtualDir(target))
+		}
+		if err := copyFile(cf, p, target); err != nil {
+			return fmt.Errorf("copy %q: %w", p, err)
+		}
+		cnt++
+		return nil
+	})
+	return cnt, err
+}
+
+// renamePath moves the file or directory within Charm FS by copying and then removing the source, since Charm FS has no native rename.
+// It fails if the target exists.
+func (m *Module) renamePath(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var oldName, newName tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "old", &oldName, "new", &newName); err != nil {
+		return nil, err
+	}
+	src, dst := path.Clean(oldName.GoString()), path.Clean(newName.GoString())
+	if src == dst {
+		return none, nil
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// check the target
+	if _, err := statPath(cf, dst); err == nil {
+		return nil, fmt.Errorf("%s: target exists: %s", b.Name(), dst)
+	} else if !errors.Is(err, gofs.ErrNotExist) {
+		return nil, err
+	}
+
+	// copy and remove
+	if _, err := copyTree(cf, src, dst); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return none, cf.Remove(src)
+}
+
+// copyPath copies the file, or the directory if recursive is set, within Charm FS. It returns the number of files copied.
+func (m *Module) copyPath(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		srcName, dstName tps.StringOrBytes
+		recursive        bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "src", &srcName, "dst", &dstName, "recursive?", &recursive); err != nil {
+		return nil, err
+	}
+	src, dst := path.Clean(srcName.GoString()), path.Clean(dstName.GoString())
+	if src == dst {
+		return nil, fmt.Errorf("%s: source and destination are the same: %s", b.Name(), src)
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// check the source
+	fi, err := statPath(cf, src)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() && !recursive {
+		return nil, fmt.Errorf("%s: %s is a directory, set recursive=True to copy it", b.Name(), src)
+	}
+
+	// copy
+	cnt, err := copyTree(cf, src, dst)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.MakeInt(cnt), nil
+}
@@ -0,0 +1,107 @@
+package cfs
+
+import (
+	"errors"
+	"fmt"
+	gofs "io/fs"
+	"path"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/charmbracelet/charm/fs"
+	"go.starlark.net/starlark"
+)
+
+// statPath returns the file info of the path by listing its parent directory. Charm FS has no stat API, and gofs.Stat opens the file,
+// which downloads and decrypts the whole content, while the listing carries the size and modification time already.
+func statPath(cf *fs.FS, name string) (gofs.FileInfo, error) {
+	p := strings.TrimPrefix(path.Clean(name), "/")
+	if p == "." || p == "" {
+		return gofs.Stat(cf, "")
+	}
+	dir := path.Dir(p)
+	if dir == "." {
+		dir = ""
+	}
+	des, err := cf.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(p)
+	for _, de := range des {
+		if de.Name() == base {
+			return de.Info()
+		}
+	}
+	return nil, &gofs.PathError{Op: "stat", Path: name, Err: gofs.ErrNotExist}
+}
+
+// makeDir creates the directory in Charm FS. With parents, the missing parents are created and the existing directory is fine, like mkdir -p.
+func (m *Module) makeDir(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name    tps.StringOrBytes
+		parents = true
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &name, "parents?", &parents); err != nil {
+		return nil, err
+	}
+	p := path.Clean(name.GoString())
+	if p == "." || p == "/" {
+		return nil, fmt.Errorf("%s: invalid path: %q", b.Name(), name.GoString())
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// check the path and its parent
+	if fi, err := statPath(cf, p); err == nil {
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("%s: file exists: %s", b.Name(), p)
+		}
+		if !parents {
+			return nil, fmt.Errorf("%s: directory exists: %s", b.Name(), p)
+		}
+		return none, nil
+	} else if !errors.Is(err, gofs.ErrNotExist) {
+		return nil, err
+	}
+	if dir := path.Dir(p); !parents && dir != "." && dir != "/" {
+		if fi, err := statPath(cf, dir); err != nil {
+			return nil, fmt.Errorf("%s: parent of %s: %w", b.Name(), p, err)
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("%s: parent of %s is not a directory", b.Name(), p)
+		}
+	}
+
+	// create the directory
+	return none, cf.WriteFile(p, CreateVirtualDir(p))
+}
+
+// genExistsFunc generates the Starlark callable function to check if the path exists, and is a directory if dirOnly is set.
+func (m *Module) genExistsFunc(dirOnly bool) func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var name tps.StringOrBytes
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &name); err != nil {
+			return nil, err
+		}
+
+		// get the client
+		cf, err := m.getClient()
+		if err != nil {
+			return nil, err
+		}
+
+		// check the path
+		fi, err := statPath(cf, name.GoString())
+		if errors.Is(err, gofs.ErrNotExist) {
+			return starlark.False, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Bool(!dirOnly || fi.IsDir()), nil
+	}
+}
@@ -3,10 +3,12 @@ package cfs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	gofs "io/fs"
 	"path/filepath"
+	"sync"
 
 	"github.com/1set/starlet"
 	tps "github.com/1set/starlet/dataconv/types"
@@ -24,43 +26,91 @@ const ModuleName = "cfs"
 // Module wraps the ConfigurableModule with specific functionality for Charm FS.
 type Module struct {
 	*core.CommonModule
-	cf *fs.FS
+	cf    *fs.FS
+	mu    sync.Mutex
+	temps []string
 }
 
 // NewModule creates a new instance of Module. It doesn't set any configuration values, nor provide any setters.
 func NewModule() *Module {
 	return &Module{
-		core.NewCommonModule(),
-		nil,
+		CommonModule: core.NewCommonModule(),
 	}
 }
 
 // NewModuleWithConfig creates a new instance of Module with the given configuration values.
 func NewModuleWithConfig(host, dataDirPath, keyFilePath string, sshPort, httpPort uint16) *Module {
 	return &Module{
-		core.NewCommonModuleWithConfig(host, dataDirPath, keyFilePath, sshPort, httpPort),
-		nil,
+		CommonModule: core.NewCommonModuleWithConfig(host, dataDirPath, keyFilePath, sshPort, httpPort),
 	}
 }
 
 // NewModuleWithGetter creates a new instance of Module with the given configuration getters.
 func NewModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort base.ConfigGetter[string]) *Module {
 	return &Module{
-		core.NewCommonModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort),
-		nil,
+		CommonModule: core.NewCommonModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort),
 	}
 }
 
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"read":         {"name", "offset", "length"},
+	"write":        {"name", "content"},
+	"append":       {"name", "content"},
+	"read_lines":   {"name", "max_lines"},
+	"iter_lines":   {"name"},
+	"tail":         {"name", "lines"},
+	"read_json":    {"name"},
+	"write_json":   {"name", "value", "indent"},
+	"read_stream":  {"name", "fn", "chunk_size"},
+	"write_stream": {"name", "fn"},
+	"remove":       {"name"},
+	"stat":         {"name"},
+	"checksum":     {"name", "algo"},
+	"exists":       {"path"},
+	"is_dir":       {"path"},
+	"listdir":      {"path", "recursive", "filter"},
+	"mkdir":        {"path", "parents"},
+	"rename":       {"old", "new"},
+	"copy":         {"src", "dst", "recursive"},
+	"upload":       {"local_path", "remote_path", "recursive"},
+	"download":     {"remote_path", "local_path", "recursive"},
+	"sync":         {"local_dir", "remote_dir", "direction", "delete", "checksum"},
+	"archive":      {"path", "format", "dest"},
+	"watch":        {"path", "callback", "interval", "timeout"},
+	"mktemp":       {"prefix", "cleanup"},
+}
+
 // LoadModule returns the Starlark module loader with the email-specific functions.
 func (m *Module) LoadModule() starlet.ModuleLoader {
 	additionalFuncs := starlark.StringDict{
-		"read":    starlark.NewBuiltin(ModuleName+".read", m.readFile),
-		"write":   starlark.NewBuiltin(ModuleName+".write", m.writeFile),
-		"remove":  starlark.NewBuiltin(ModuleName+".remove", m.removeFile),
-		"stat":    starlark.NewBuiltin(ModuleName+".stat", m.statFile),
-		"listdir": starlark.NewBuiltin(ModuleName+".listdir", m.listDirContents),
+		"read":         starlark.NewBuiltin(ModuleName+".read", m.readFile),
+		"write":        starlark.NewBuiltin(ModuleName+".write", m.writeFile),
+		"append":       starlark.NewBuiltin(ModuleName+".append", m.appendFile),
+		"read_lines":   starlark.NewBuiltin(ModuleName+".read_lines", m.readLines),
+		"iter_lines":   starlark.NewBuiltin(ModuleName+".iter_lines", m.iterLines),
+		"tail":         starlark.NewBuiltin(ModuleName+".tail", m.tailFile),
+		"read_json":    starlark.NewBuiltin(ModuleName+".read_json", m.readJSON),
+		"write_json":   starlark.NewBuiltin(ModuleName+".write_json", m.writeJSON),
+		"read_stream":  starlark.NewBuiltin(ModuleName+".read_stream", m.readStream),
+		"write_stream": starlark.NewBuiltin(ModuleName+".write_stream", m.writeStream),
+		"remove":       starlark.NewBuiltin(ModuleName+".remove", m.removeFile),
+		"stat":         starlark.NewBuiltin(ModuleName+".stat", m.statFile),
+		"checksum":     starlark.NewBuiltin(ModuleName+".checksum", m.checksumFile),
+		"exists":       starlark.NewBuiltin(ModuleName+".exists", m.genExistsFunc(false)),
+		"is_dir":       starlark.NewBuiltin(ModuleName+".is_dir", m.genExistsFunc(true)),
+		"listdir":      starlark.NewBuiltin(ModuleName+".listdir", m.listDirContents),
+		"mkdir":        starlark.NewBuiltin(ModuleName+".mkdir", m.makeDir),
+		"rename":       starlark.NewBuiltin(ModuleName+".rename", m.renamePath),
+		"copy":         starlark.NewBuiltin(ModuleName+".copy", m.copyPath),
+		"upload":       starlark.NewBuiltin(ModuleName+".upload", m.uploadFiles),
+		"download":     starlark.NewBuiltin(ModuleName+".download", m.downloadFiles),
+		"sync":         starlark.NewBuiltin(ModuleName+".sync", m.syncDirs),
+		"archive":      starlark.NewBuiltin(ModuleName+".archive", m.archiveDir),
+		"watch":        starlark.NewBuiltin(ModuleName+".watch", m.watchPath),
+		"mktemp":       starlark.NewBuiltin(ModuleName+".mktemp", m.makeTemp),
 	}
-	return m.ExtendModuleLoader(ModuleName, additionalFuncs)
+	return m.ExtendModuleLoader(ModuleName, additionalFuncs, funcParams)
 }
 
 var (
@@ -68,6 +118,12 @@ var (
 	none     = starlark.None
 )
 
+// Client returns the Charm FS client of this module, it's created on the first call.
+// It's for other modules built on top of Charm FS.
+func (m *Module) Client() (*fs.FS, error) {
+	return m.getClient()
+}
+
 func (m *Module) getClient() (*fs.FS, error) {
 	// return the client if it's already created
 	if m.cf != nil {
@@ -90,11 +146,38 @@ func (m *Module) getClient() (*fs.FS, error) {
 }
 
 func (m *Module) readFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	var name tps.StringOrBytes
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name); err != nil {
+	var (
+		name   tps.StringOrBytes
+		offset = 0
+		length = -1
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "offset?", &offset, "length?", &length); err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%s: offset must be non-negative, got %d", b.Name(), offset)
+	}
+
+	// read the whole file
+	if offset == 0 && length < 0 {
+		data, err := m.ReadFile(name.GoString())
+		if err != nil {
+			return nil, err
+		}
+		return starlark.String(data), nil
+	}
+
+	// read the range only
+	data, err := m.readRange(name.GoString(), int64(offset), int64(length))
+	if err != nil {
 		return nil, err
 	}
+	return starlark.String(data), nil
+}
 
+// readRange reads the part of the file from the offset with the length, negative length means to the end.
+// Charm FS has no range requests and downloads the whole file on opening, so it only avoids creating a large Starlark value.
+func (m *Module) readRange(name string, offset, length int64) ([]byte, error) {
 	// get the client
 	cf, err := m.getClient()
 	if err != nil {
@@ -102,7 +185,39 @@ func (m *Module) readFile(thread *starlark.Thread, b *starlark.Builtin, args sta
 	}
 
 	// open file for reading
-	f, err := cf.Open(name.GoString())
+	f, err := cf.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+	if fi, err := f.Stat(); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		return nil, fmt.Errorf("is a directory: %s", name)
+	}
+
+	// skip to the offset and read the range
+	if _, err := io.CopyN(io.Discard, f, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var r io.Reader = f
+	if length >= 0 {
+		r = io.LimitReader(f, length)
+	}
+	return io.ReadAll(r)
+}
+
+// ReadFile reads the content of the file in Charm FS.
+// It's for other modules loading files from Charm FS, e.g. email attachments.
+func (m *Module) ReadFile(name string) ([]byte, error) {
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// open file for reading
+	f, err := cf.Open(name)
 	if err != nil {
 		return nil, err
 	}
@@ -123,7 +238,7 @@ func (m *Module) readFile(thread *starlark.Thread, b *starlark.Builtin, args sta
 	if err != nil {
 		return nil, err
 	}
-	return starlark.String(buf.Bytes()), nil
+	return buf.Bytes(), nil
 }
 
 func (m *Module) writeFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -132,17 +247,44 @@ func (m *Module) writeFile(thread *starlark.Thread, b *starlark.Builtin, args st
 		return nil, err
 	}
 
+	err := m.WriteFile(name.GoString(), content.GoBytes())
+	return none, err
+}
+
+// WriteFile writes the content as the file in Charm FS.
+// It's for other modules saving files to Charm FS, e.g. llm transcripts.
+func (m *Module) WriteFile(name string, data []byte) error {
 	// get the client
 	cf, err := m.getClient()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// write as file
-	fn := name.GoString()
-	vf := CreateVirtualFile(fn, content.GoBytes())
-	err = cf.WriteFile(fn, vf)
-	return none, err
+	vf := CreateVirtualFile(name, data)
+	return cf.WriteFile(name, vf)
+}
+
+// appendFile appends the content to the file in Charm FS by reading, concatenating and rewriting it, since Charm FS has no native append.
+// The missing file is created. It returns the size of the file after appending.
+func (m *Module) appendFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, content tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "content", &content); err != nil {
+		return nil, err
+	}
+
+	// read the existing content
+	data, err := m.ReadFile(name.GoString())
+	if err != nil && !errors.Is(err, gofs.ErrNotExist) {
+		return nil, err
+	}
+
+	// append and write back
+	data = append(data, content.GoBytes()...)
+	if err := m.WriteFile(name.GoString(), data); err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(len(data)), nil
 }
 
 func (m *Module) removeFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -162,6 +304,7 @@ func (m *Module) removeFile(thread *starlark.Thread, b *starlark.Builtin, args s
 	return none, err
 }
 
+// statFile returns the struct of the file info with the stable fields: name, path, ext, size, mode, mod_time, is_dir and is_link.
 func (m *Module) statFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var name tps.StringOrBytes
 	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name); err != nil {
@@ -197,6 +340,7 @@ func (m *Module) statFile(thread *starlark.Thread, b *starlark.Builtin, args sta
 		"mode":     starlark.String(fi.Mode().String()),
 		"mod_time": stdtime.Time(fi.ModTime()),
 		"is_dir":   starlark.Bool(fi.IsDir()),
+		"is_link":  starlark.Bool(fi.Mode()&gofs.ModeSymlink != 0),
 	}
 	return starlarkstruct.FromStringDict(starlark.String("file_stat"), fields), nil
 }
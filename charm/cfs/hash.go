@@ -0,0 +1,91 @@
+package cfs
+
+import (
+	"crypto/md5"  // nolint:gosec
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/charmbracelet/charm/fs"
+	"go.starlark.net/starlark"
+)
+
+// newHash returns the hash of the algorithm name, i.e. md5, sha1, sha256 or sha512.
+func newHash(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case "md5":
+		return md5.New(), nil // nolint:gosec
+	case "sha1":
+		return sha1.New(), nil // nolint:gosec
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algo)
+	}
+}
+
+// fileChecksum returns the hex digest of the file in Charm FS. The algorithm is checked before opening the file,
+// since Charm FS downloads the whole file on opening.
+func fileChecksum(cf *fs.FS, name, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+	f, err := cf.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() // nolint:errcheck
+	if fi, err := f.Stat(); err != nil {
+		return "", err
+	} else if fi.IsDir() {
+		return "", fmt.Errorf("is a directory: %s", name)
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashReader returns the hex digest of the content of the reader with the hash algorithm.
+func hashReader(r io.Reader, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (m *Module) checksumFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name tps.StringOrBytes
+		algo = "sha256"
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "algo?", &algo); err != nil {
+		return nil, err
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// compute checksum
+	sum, err := fileChecksum(cf, name.GoString(), algo)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(sum), nil
+}
@@ -0,0 +1,55 @@
+package cfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+)
+
+func (m *Module) readJSON(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+
+	// read and parse JSON
+	data, err := m.ReadFile(name.GoString())
+	if err != nil {
+		return nil, err
+	}
+	return dataconv.DecodeStarlarkJSON(data)
+}
+
+func (m *Module) writeJSON(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name   tps.StringOrBytes
+		value  starlark.Value
+		indent = 0
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "value", &value, "indent?", &indent); err != nil {
+		return nil, err
+	}
+	if indent < 0 {
+		return nil, fmt.Errorf("%s: indent must be non-negative, got %d", b.Name(), indent)
+	}
+
+	// convert value to JSON
+	js, err := dataconv.EncodeStarlarkJSON(value)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(js)
+	if indent > 0 {
+		buf := bytes.NewBuffer(nil)
+		if err := json.Indent(buf, data, "", strings.Repeat(" ", indent)); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	return none, m.WriteFile(name.GoString(), data)
+}
@@ -0,0 +1,147 @@
+package cfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+)
+
+// newLineScanner returns the scanner splitting the content into lines without the line endings, long lines are not truncated.
+func newLineScanner(data []byte) *bufio.Scanner {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	return sc
+}
+
+// readLines returns the lines of the file as a list of strings, at most max_lines lines if it's non-negative.
+func (m *Module) readLines(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name     tps.StringOrBytes
+		maxLines = -1
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "max_lines?", &maxLines); err != nil {
+		return nil, err
+	}
+
+	// read the file
+	data, err := m.ReadFile(name.GoString())
+	if err != nil {
+		return nil, err
+	}
+
+	// split into lines
+	var (
+		sl []starlark.Value
+		sc = newLineScanner(data)
+	)
+	for (maxLines < 0 || len(sl) < maxLines) && sc.Scan() {
+		sl = append(sl, starlark.String(sc.Text()))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return starlark.NewList(sl), nil
+}
+
+// tailFile returns the last lines of the file as a list of strings. Charm FS has no range requests and downloads the whole file,
+// so it only avoids creating a large Starlark value, the lines are scanned keeping only the last ones in a ring.
+func (m *Module) tailFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name  tps.StringOrBytes
+		lines = 10
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "lines?", &lines); err != nil {
+		return nil, err
+	}
+	if lines < 0 {
+		return nil, fmt.Errorf("%s: lines must be non-negative, got %d", b.Name(), lines)
+	}
+
+	// read the file
+	data, err := m.ReadFile(name.GoString())
+	if err != nil {
+		return nil, err
+	}
+	if lines == 0 {
+		return starlark.NewList(nil), nil
+	}
+
+	// keep the last lines in the ring
+	var (
+		ring = make([]string, lines)
+		cnt  int
+		sc   = newLineScanner(data)
+	)
+	for sc.Scan() {
+		ring[cnt%lines] = sc.Text()
+		cnt++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// convert in order
+	n := cnt
+	if n > lines {
+		n = lines
+	}
+	sl := make([]starlark.Value, 0, n)
+	for i := cnt - n; i < cnt; i++ {
+		sl = append(sl, starlark.String(ring[i%lines]))
+	}
+	return starlark.NewList(sl), nil
+}
+
+// iterLines returns an iterable of the lines of the file, the lines are converted into Starlark strings lazily while iterating,
+// so scripts can process large files in a for loop without splitting the whole content.
+func (m *Module) iterLines(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+
+	// read the file, Charm FS client loads the whole file anyway
+	data, err := m.ReadFile(name.GoString())
+	if err != nil {
+		return nil, err
+	}
+	return &fileLines{name: name.GoString(), data: data}, nil
+}
+
+// fileLines is the Starlark iterable of the lines of a file.
+type fileLines struct {
+	name string
+	data []byte
+}
+
+var (
+	_ starlark.Iterable = (*fileLines)(nil)
+	_ starlark.Iterator = (*lineIterator)(nil)
+)
+
+func (l *fileLines) String() string        { return fmt.Sprintf("<file_lines %q>", l.name) }
+func (l *fileLines) Type() string          { return "file_lines" }
+func (l *fileLines) Freeze()               {}
+func (l *fileLines) Truth() starlark.Bool  { return len(l.data) > 0 }
+func (l *fileLines) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", l.Type()) }
+func (l *fileLines) Iterate() starlark.Iterator {
+	return &lineIterator{sc: newLineScanner(l.data)}
+}
+
+// lineIterator yields the lines one by one.
+type lineIterator struct {
+	sc *bufio.Scanner
+}
+
+func (it *lineIterator) Next(p *starlark.Value) bool {
+	if !it.sc.Scan() {
+		return false
+	}
+	*p = starlark.String(it.sc.Text())
+	return true
+}
+
+func (it *lineIterator) Done() {}
@@ -0,0 +1,131 @@
+package cfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+)
+
+// defaultChunkSize is the default size of chunks for streaming reads.
+const defaultChunkSize = 1 << 20
+
+// readStream calls the Starlark callable with each chunk of the file as bytes, so the whole content is never a single Starlark value.
+// The reading stops early if the callable returns False. It returns the number of bytes read.
+func (m *Module) readStream(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name      tps.StringOrBytes
+		fn        starlark.Callable
+		chunkSize = defaultChunkSize
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "fn", &fn, "chunk_size?", &chunkSize); err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("%s: chunk_size must be positive, got %d", b.Name(), chunkSize)
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// open file for reading
+	f, err := cf.Open(name.GoString())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+	if fi, err := f.Stat(); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		return nil, fmt.Errorf("is a directory: %s", name.GoString())
+	}
+
+	// read and call in chunks
+	var (
+		total int
+		buf   = make([]byte, chunkSize)
+	)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			total += n
+			res, cerr := starlark.Call(thread, fn, starlark.Tuple{starlark.Bytes(buf[:n])}, nil)
+			if cerr != nil {
+				return nil, cerr
+			}
+			if res == starlark.False {
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return starlark.MakeInt(total), nil
+}
+
+// writeStream calls the Starlark callable repeatedly for the chunks to write until it returns None or empty, the chunks are buffered
+// in a local temporary file instead of Starlark values, and then written as the file in Charm FS. It returns the number of bytes written.
+func (m *Module) writeStream(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name tps.StringOrBytes
+		fn   starlark.Callable
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "fn", &fn); err != nil {
+		return nil, err
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// buffer the chunks in a temporary file
+	tmp, err := os.CreateTemp("", "cfs-stream-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+	defer tmp.Close()           // nolint:errcheck
+	total := 0
+	for {
+		res, err := starlark.Call(thread, fn, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if res == none {
+			break
+		}
+		var chunk tps.StringOrBytes
+		if err := chunk.Unpack(res); err != nil {
+			return nil, fmt.Errorf("%s: chunk must be string or bytes, got %s", b.Name(), res.Type())
+		}
+		bs := chunk.GoBytes()
+		if len(bs) == 0 {
+			break
+		}
+		if _, err := tmp.Write(bs); err != nil {
+			return nil, err
+		}
+		total += len(bs)
+	}
+
+	// write the file
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := cf.WriteFile(name.GoString(), tmp); err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(total), nil
+}
@@ -0,0 +1,247 @@
+package cfs
+
+import (
+	"errors"
+	"fmt"
+	gofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/charm/core"
+	"github.com/charmbracelet/charm/fs"
+	"go.starlark.net/starlark"
+)
+
+// syncEntry is the size and modification time of a file to compare.
+type syncEntry struct {
+	size    int64
+	modTime time.Time
+}
+
+// listLocalFiles returns the regular files in the local directory, keyed by the relative path with slashes.
+func listLocalFiles(dir string) (map[string]syncEntry, error) {
+	files := make(map[string]syncEntry)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return files, nil
+	}
+	err := filepath.WalkDir(dir, func(p string, d gofs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = syncEntry{fi.Size(), fi.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// listRemoteFiles returns the files in the directory of Charm FS, keyed by the relative path. The file itself is keyed by the empty path,
+// it's looked up in the listing of its parent without opening, since opening downloads the whole file.
+func listRemoteFiles(cf *fs.FS, dir string) (map[string]syncEntry, error) {
+	files := make(map[string]syncEntry)
+	fi, err := statPath(cf, dir)
+	if errors.Is(err, gofs.ErrNotExist) {
+		return files, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		files[""] = syncEntry{fi.Size(), fi.ModTime()}
+		return files, nil
+	}
+	err = gofs.WalkDir(cf, dir, func(p string, d gofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[strings.TrimPrefix(strings.TrimPrefix(p, dir), "/")] = syncEntry{fi.Size(), fi.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// sameFile reports whether the local and remote files are the same, by the size and the modification time in seconds,
+// or by the checksums if the sizes are the same and checksum is set.
+func sameFile(cf *fs.FS, local, remote syncEntry, localPath, remotePath string, checksum bool) (bool, error) {
+	if local.size != remote.size {
+		return false, nil
+	}
+	if local.modTime.Truncate(time.Second).Equal(remote.modTime.Truncate(time.Second)) {
+		return true, nil
+	}
+	if !checksum {
+		return false, nil
+	}
+	ls, err := localChecksum(localPath)
+	if err != nil {
+		return false, err
+	}
+	rs, err := fileChecksum(cf, remotePath, "sha256")
+	if err != nil {
+		return false, err
+	}
+	return ls == rs, nil
+}
+
+// localChecksum returns the hex digest of sha256 of the local file.
+func localChecksum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() // nolint:errcheck
+	return hashReader(f, "sha256")
+}
+
+// alignModTime sets the modification time of the local file to the remote one after transferring, so it's unchanged in the next sync.
+func alignModTime(cf *fs.FS, localPath, remotePath string) error {
+	fi, err := statPath(cf, remotePath)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(localPath, fi.ModTime(), fi.ModTime())
+}
+
+// syncDirs syncs the files between the local directory and the directory in Charm FS, only the changed files are transferred.
+// The direction is push for local to remote, pull for remote to local, or both for the newer one to win.
+// With delete, the files missing in the source are removed from the target, it's not allowed for both directions.
+func (m *Module) syncDirs(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		localDir  tps.StringOrBytes
+		remoteDir tps.StringOrBytes
+		direction = "push"
+		del       bool
+		checksum  bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "local_dir", &localDir, "remote_dir", &remoteDir, "direction?", &direction, "delete?", &del, "checksum?", &checksum); err != nil {
+		return nil, err
+	}
+	push, pull := false, false
+	switch direction {
+	case "push":
+		push = true
+	case "pull":
+		pull = true
+	case "both":
+		push, pull = true, true
+		if del {
+			return nil, fmt.Errorf("%s: delete is not allowed for both directions", b.Name())
+		}
+	default:
+		return nil, fmt.Errorf("%s: direction must be push, pull or both, got %q", b.Name(), direction)
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// list both sides
+	ld, rd := localDir.GoString(), path.Clean(remoteDir.GoString())
+	locals, err := listLocalFiles(ld)
+	if err != nil {
+		return nil, err
+	}
+	remotes, err := listRemoteFiles(cf, rd)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(locals)+len(remotes))
+	for n := range locals {
+		names = append(names, n)
+	}
+	for n := range remotes {
+		if _, ok := locals[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	// compare and transfer
+	var (
+		uploaded, downloaded, deleted []string
+		skipped                       int
+	)
+	for _, n := range names {
+		lp, rp := filepath.Join(ld, filepath.FromSlash(n)), path.Join(rd, n)
+		le, inLocal := locals[n]
+		re, inRemote := remotes[n]
+
+		// decide the action
+		up, down, rm := false, false, false
+		switch {
+		case inLocal && inRemote:
+			same, err := sameFile(cf, le, re, lp, rp, checksum)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case same:
+			case push && pull:
+				up, down = le.modTime.After(re.modTime), !le.modTime.After(re.modTime)
+			default:
+				up, down = push, pull
+			}
+		case inLocal:
+			up, rm = push, pull && del
+		case inRemote:
+			down, rm = pull, push && del
+		}
+
+		// take the action
+		switch {
+		case up:
+			if err := uploadFile(cf, lp, rp); err != nil {
+				return nil, fmt.Errorf("%s: upload %q: %w", b.Name(), n, err)
+			}
+			if err := alignModTime(cf, lp, rp); err != nil {
+				return nil, err
+			}
+			uploaded = append(uploaded, n)
+		case down:
+			if err := downloadFile(cf, rp, lp); err != nil {
+				return nil, fmt.Errorf("%s: download %q: %w", b.Name(), n, err)
+			}
+			if err := os.Chtimes(lp, re.modTime, re.modTime); err != nil {
+				return nil, err
+			}
+			downloaded = append(downloaded, n)
+		case rm && inLocal:
+			if err := os.Remove(lp); err != nil {
+				return nil, err
+			}
+			deleted = append(deleted, lp)
+		case rm && inRemote:
+			if err := cf.Remove(rp); err != nil {
+				return nil, err
+			}
+			deleted = append(deleted, rp)
+		default:
+			skipped++
+		}
+	}
+
+	// return the summary
+	res := starlark.NewDict(4)
+	_ = res.SetKey(starlark.String("uploaded"), core.StringsToStarlarkList(uploaded))
+	_ = res.SetKey(starlark.String("downloaded"), core.StringsToStarlarkList(downloaded))
+	_ = res.SetKey(starlark.String("deleted"), core.StringsToStarlarkList(deleted))
+	_ = res.SetKey(starlark.String("skipped"), starlark.MakeInt(skipped))
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package cfs
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	gofs "io/fs"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"go.starlark.net/starlark"
+)
+
+// defaultTempPrefix is the default prefix of the temporary paths, which puts them in the "tmp" directory.
+const defaultTempPrefix = "tmp/"
+
+// newTempPath returns the unique path with the prefix, ordered by the time in nanoseconds, with the random suffix to avoid collisions
+// of paths created by different devices at the same time.
+func newTempPath(prefix string) (string, error) {
+	b := make([]byte, 4)
+	if err := base.RandRead(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d-%s", prefix, base.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
+
+// makeTemp returns a unique path in Charm FS for scratch files, the file is not created.
+// If cleanup is set, the path is only registered, the module can't tell when a Starlark run ends since it's shared across runs.
+// The host application must call Cleanup after the run to remove the registered paths, otherwise they are kept.
+func (m *Module) makeTemp(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		prefix  = tps.StringOrBytes(defaultTempPrefix)
+		cleanup bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "prefix?", &prefix, "cleanup?", &cleanup); err != nil {
+		return nil, err
+	}
+
+	// generate the path
+	p, err := newTempPath(strings.TrimPrefix(prefix.GoString(), "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	// register for cleanup
+	if cleanup {
+		m.mu.Lock()
+		m.temps = append(m.temps, p)
+		m.mu.Unlock()
+	}
+	return starlark.String(p), nil
+}
+
+// Cleanup removes the temporary paths registered by mktemp with cleanup, and clears the registration.
+// Nothing calls it automatically, the host application calls it when the Starlark run is done, e.g. deferred after starlet's Machine.Run.
+// The paths never written are skipped.
+func (m *Module) Cleanup() error {
+	m.mu.Lock()
+	temps := m.temps
+	m.temps = nil
+	m.mu.Unlock()
+	if len(temps) == 0 {
+		return nil
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return err
+	}
+
+	// remove the paths
+	var errs []string
+	for _, p := range temps {
+		if err := cf.Remove(p); err != nil && !errors.Is(err, gofs.ErrNotExist) {
+			errs = append(errs, fmt.Sprintf("%s: %v", p, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("remove temporary paths: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package cfs
+
+import (
+	"fmt"
+	"io"
+	gofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/charmbracelet/charm/fs"
+	"go.starlark.net/starlark"
+)
+
+// uploadFile copies the local file to Charm FS, the file is passed to the client as is, without reading it into Starlark values.
+func uploadFile(cf *fs.FS, localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint:errcheck
+	return cf.WriteFile(remotePath, f)
+}
+
+// downloadFile copies the file in Charm FS to the local path, and creates the parent directories if needed.
+func downloadFile(cf *fs.FS, remotePath, localPath string) error {
+	// open remote file
+	rf, err := cf.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer rf.Close() // nolint:errcheck
+	fi, err := rf.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("is a directory: %s", remotePath)
+	}
+
+	// write to local file with the same permissions
+	perm := fi.Mode().Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	lf, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(lf, rf); err != nil {
+		lf.Close() // nolint:errcheck
+		return err
+	}
+	return lf.Close()
+}
+
+// uploadFiles copies the local file or directory to Charm FS, it returns the number of files uploaded.
+func (m *Module) uploadFiles(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		localPath  tps.StringOrBytes
+		remotePath tps.StringOrBytes
+		recursive  bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "local_path", &localPath, "remote_path", &remotePath, "recursive?", &recursive); err != nil {
+		return nil, err
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// upload single file
+	lp, rp := localPath.GoString(), remotePath.GoString()
+	fi, err := os.Stat(lp)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		if err := uploadFile(cf, lp, rp); err != nil {
+			return nil, err
+		}
+		return starlark.MakeInt(1), nil
+	}
+	if !recursive {
+		return nil, fmt.Errorf("%s: %s is a directory, set recursive=True to upload it", b.Name(), lp)
+	}
+
+	// upload all files in the directory
+	cnt := 0
+	if err := filepath.WalkDir(lp, func(p string, d gofs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(lp, p)
+		if err != nil {
+			return err
+		}
+		if err := uploadFile(cf, p, path.Join(rp, filepath.ToSlash(rel))); err != nil {
+			return fmt.Errorf("upload %q: %w", p, err)
+		}
+		cnt++
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.MakeInt(cnt), nil
+}
+
+// downloadFiles copies the file or directory in Charm FS to the local path, it returns the number of files downloaded.
+func (m *Module) downloadFiles(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		remotePath tps.StringOrBytes
+		localPath  tps.StringOrBytes
+		recursive  bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "remote_path", &remotePath, "local_path", &localPath, "recursive?", &recursive); err != nil {
+		return nil, err
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// download single file
+	rp, lp := remotePath.GoString(), localPath.GoString()
+	fi, err := statPath(cf, rp)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		if err := downloadFile(cf, rp, lp); err != nil {
+			return nil, err
+		}
+		return starlark.MakeInt(1), nil
+	}
+	if !recursive {
+		return nil, fmt.Errorf("%s: %s is a directory, set recursive=True to download it", b.Name(), rp)
+	}
+
+	// download all files in the directory
+	cnt := 0
+	if err := gofs.WalkDir(cf, rp, func(p string, d gofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, rp), "/")
+		if err := downloadFile(cf, p, filepath.Join(lp, filepath.FromSlash(rel))); err != nil {
+			return fmt.Errorf("download %q: %w", p, err)
+		}
+		cnt++
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.MakeInt(cnt), nil
+}
@@ -10,6 +10,7 @@ import (
 type VirtualFile struct {
 	*bytes.Reader
 	name string
+	mode fs.FileMode
 }
 
 // Close implements fs.File.Close
@@ -22,6 +23,7 @@ func (f *VirtualFile) Stat() (fs.FileInfo, error) {
 	return &VirtualFileInfo{
 		name: f.name,
 		size: int64(f.Len()),
+		mode: f.mode,
 	}, nil
 }
 
@@ -29,15 +31,23 @@ func (f *VirtualFile) Stat() (fs.FileInfo, error) {
 type VirtualFileInfo struct {
 	name string
 	size int64
+	mode fs.FileMode
 }
 
 func (fi *VirtualFileInfo) Name() string       { return fi.name }
 func (fi *VirtualFileInfo) Size() int64        { return fi.size }
-func (fi *VirtualFileInfo) Mode() fs.FileMode  { return 0444 } // read-only
 func (fi *VirtualFileInfo) ModTime() time.Time { return time.Time{} }
-func (fi *VirtualFileInfo) IsDir() bool        { return false }
+func (fi *VirtualFileInfo) IsDir() bool        { return fi.mode.IsDir() }
 func (fi *VirtualFileInfo) Sys() interface{}   { return nil }
 
+// Mode returns the file mode, it's read-only if not set.
+func (fi *VirtualFileInfo) Mode() fs.FileMode {
+	if fi.mode == 0 {
+		return 0444
+	}
+	return fi.mode
+}
+
 // CreateVirtualFile creates a virtual fs.File from bytes
 func CreateVirtualFile(name string, data []byte) fs.File {
 	return &VirtualFile{
@@ -45,3 +55,12 @@ func CreateVirtualFile(name string, data []byte) fs.File {
 		name:   name,
 	}
 }
+
+// CreateVirtualDir creates a virtual fs.File of an empty directory, Charm FS creates the directory with its parents when it's written.
+func CreateVirtualDir(name string) fs.File {
+	return &VirtualFile{
+		Reader: bytes.NewReader(nil),
+		name:   name,
+		mode:   fs.ModeDir | 0755,
+	}
+}
@@ -0,0 +1,110 @@
+package cfs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+)
+
+// defaultWatchInterval is the default interval in seconds of polling for changes.
+const defaultWatchInterval = 5
+
+// fileChange is a change of the file found by comparing the snapshots.
+type fileChange struct {
+	event string
+	path  string
+}
+
+// diffSnapshots returns the changes from the old to the new snapshot of files, sorted by the path.
+func diffSnapshots(root string, old, cur map[string]syncEntry) []fileChange {
+	var changes []fileChange
+	for p, e := range cur {
+		if o, ok := old[p]; !ok {
+			changes = append(changes, fileChange{"created", path.Join(root, p)})
+		} else if o.size != e.size || !o.modTime.Equal(e.modTime) {
+			changes = append(changes, fileChange{"modified", path.Join(root, p)})
+		}
+	}
+	for p := range old {
+		if _, ok := cur[p]; !ok {
+			changes = append(changes, fileChange{"removed", path.Join(root, p)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+	return changes
+}
+
+// watchPath polls the file or the files in the directory, and calls the Starlark callable with the event and the path for each file
+// created, removed or modified in size or modification time. The event is one of "created", "removed" and "modified".
+// Only the directory listings are polled, the files are never opened, since opening downloads the whole file in Charm FS.
+// It stops when the callable returns False, or timeout. It returns the number of changes handled.
+func (m *Module) watchPath(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name     tps.StringOrBytes
+		callback starlark.Callable
+		interval tps.FloatOrInt = defaultWatchInterval
+		timeout  tps.FloatOrInt
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &name, "callback", &callback, "interval?", &interval, "timeout?", &timeout); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("%s: interval must be positive, got %v", b.Name(), interval)
+	}
+
+	// get the client
+	cf, err := m.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// take the initial snapshot
+	root := name.GoString()
+	prev, err := listRemoteFiles(cf, root)
+	if err != nil {
+		return nil, err
+	}
+
+	// poll until done
+	ctx := dataconv.GetThreadContext(thread)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout.GoFloat64()*float64(time.Second)))
+		defer cancel()
+	}
+	t := time.NewTicker(time.Duration(interval.GoFloat64() * float64(time.Second)))
+	defer t.Stop()
+	cnt := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return starlark.MakeInt(cnt), nil
+		case <-t.C:
+		}
+
+		// compare with the previous snapshot
+		cur, err := listRemoteFiles(cf, root)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range diffSnapshots(root, prev, cur) {
+			cnt++
+			res, err := starlark.Call(thread, callback, starlark.Tuple{starlark.String(c.event), starlark.String(c.path)}, nil)
+			if err != nil {
+				return nil, err
+			}
+			if res == starlark.False {
+				return starlark.MakeInt(cnt), nil
+			}
+		}
+		prev = cur
+	}
+}
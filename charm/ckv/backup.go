@@ -0,0 +1,127 @@
+package ckv
+
+import (
+	"bufio"
+	"os"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// restoreChunkSize is the number of entries written in each transaction when restoring, to stay under the transaction size limit.
+const restoreChunkSize = 1000
+
+// writeEntries writes the entries in one transaction of the database.
+func (m *Module) writeEntries(db string, entries []*badger.Entry) error {
+	return m.updateDB(db, func(txn *badger.Txn) error {
+		for _, e := range entries {
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Module) backupDB(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		path tps.StringOrBytes
+		db   tps.StringOrBytes
+		sync = true
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "db?", &db, "sync?", &sync); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// sync before backup
+	if sync {
+		if err := m.autoSync(db.GoString(), dc); err != nil {
+			return none, err
+		}
+	}
+
+	// dump all entries to the file, the values are decrypted in the backup
+	f, err := os.OpenFile(path.GoString(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return none, err
+	}
+	w := bufio.NewWriter(f)
+	if _, err := dc.NewStream().Backup(w, 0); err != nil {
+		f.Close() // nolint:errcheck
+		return none, err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close() // nolint:errcheck
+		return none, err
+	}
+	return none, f.Close()
+}
+
+func (m *Module) restoreDB(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		path tps.StringOrBytes
+		db   tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// load the backup into a temporary in-memory database
+	f, err := os.Open(path.GoString())
+	if err != nil {
+		return none, err
+	}
+	defer f.Close() // nolint:errcheck
+	tmp, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		return none, err
+	}
+	defer tmp.Close() // nolint:errcheck
+	if err := tmp.Load(f, 256); err != nil {
+		return none, err
+	}
+
+	// write the entries in chunks of transactions, so the diffs are synced to Charm Cloud like other writes
+	var (
+		cnt     int
+		pending []*badger.Entry
+	)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := m.writeEntries(db.GoString(), pending)
+		cnt += len(pending)
+		pending = pending[:0]
+		return err
+	}
+	if err := tmp.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			e := badger.NewEntry(item.KeyCopy(nil), v)
+			e.ExpiresAt = item.ExpiresAt()
+			if pending = append(pending, e); len(pending) >= restoreChunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return flush()
+	}); err != nil {
+		return none, err
+	}
+	return starlark.MakeInt(cnt), nil
+}
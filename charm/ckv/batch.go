@@ -0,0 +1,87 @@
+package ckv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+func (m *Module) multiGet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		keys = tps.NewOneOrManyNoDefault[starlark.String]()
+		db   tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "keys", keys, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// get values in one read transaction, None for missing keys
+	res := starlark.NewDict(keys.Len())
+	if err := dc.View(func(txn *badger.Txn) error {
+		for _, k := range keys.Slice() {
+			var v starlark.Value = none
+			item, err := txn.Get([]byte(k))
+			switch {
+			case errors.Is(err, badger.ErrKeyNotFound):
+			case err != nil:
+				return err
+			default:
+				bs, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				v = starlark.String(bs)
+			}
+			if err := res.SetKey(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return none, err
+	}
+	return res, nil
+}
+
+func (m *Module) multiSet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		items *starlark.Dict
+		db    tps.StringOrBytes
+		ttl   tps.FloatOrInt
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "items", &items, "db?", &db, "ttl?", &ttl); err != nil {
+		return none, err
+	}
+	exp, err := parseTTL(ttl)
+	if err != nil {
+		return none, err
+	}
+
+	// write all items in one transaction, with string representations of values
+	return none, m.updateDB(db.GoString(), func(txn *badger.Txn) error {
+		for _, it := range items.Items() {
+			k, ok := starlark.AsString(it[0])
+			if !ok {
+				return fmt.Errorf("%s: key must be a string, got %s", b.Name(), it[0].Type())
+			}
+			e := badger.NewEntry([]byte(k), []byte(dataconv.StarString(it[1])))
+			if exp > 0 {
+				e = e.WithTTL(exp)
+			}
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,205 @@
+package ckv
+
+import (
+	"bytes"
+	"fmt"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+	"go.starlark.net/starlark"
+)
+
+// encodeMsgpack serializes the Starlark value in msgpack, which keeps ints, floats, strings and bytes apart, and the order of dict items.
+// Tuples and sets are encoded as lists.
+func encodeMsgpack(v starlark.Value) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := encodeStarlarkValue(enc, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeStarlarkValue(enc *msgpack.Encoder, v starlark.Value) error {
+	switch t := v.(type) {
+	case starlark.NoneType:
+		return enc.EncodeNil()
+	case starlark.Bool:
+		return enc.EncodeBool(bool(t))
+	case starlark.Int:
+		if i, ok := t.Int64(); ok {
+			return enc.EncodeInt(i)
+		}
+		if u, ok := t.Uint64(); ok {
+			return enc.EncodeUint(u)
+		}
+		return fmt.Errorf("int is too large for msgpack: %s", t)
+	case starlark.Float:
+		return enc.EncodeFloat64(float64(t))
+	case starlark.String:
+		return enc.EncodeString(string(t))
+	case starlark.Bytes:
+		return enc.EncodeBytes([]byte(t))
+	case *starlark.Dict:
+		if err := enc.EncodeMapLen(t.Len()); err != nil {
+			return err
+		}
+		for _, it := range t.Items() {
+			if err := encodeStarlarkValue(enc, it[0]); err != nil {
+				return err
+			}
+			if err := encodeStarlarkValue(enc, it[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case starlark.Iterable:
+		var items []starlark.Value
+		iter := t.Iterate()
+		defer iter.Done()
+		var x starlark.Value
+		for iter.Next(&x) {
+			items = append(items, x)
+		}
+		if err := enc.EncodeArrayLen(len(items)); err != nil {
+			return err
+		}
+		for _, x := range items {
+			if err := encodeStarlarkValue(enc, x); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type for msgpack: %s", v.Type())
+	}
+}
+
+// decodeMsgpack deserializes the msgpack data to the Starlark value, arrays are decoded as lists and maps as dicts.
+func decodeMsgpack(data []byte) (starlark.Value, error) {
+	return decodeStarlarkValue(msgpack.NewDecoder(bytes.NewReader(data)))
+}
+
+func decodeStarlarkValue(dec *msgpack.Decoder) (starlark.Value, error) {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return none, err
+	}
+
+	// containers and bytes, which are decoded as strings in interface
+	switch {
+	case msgpcode.IsFixedMap(code) || code == msgpcode.Map16 || code == msgpcode.Map32:
+		n, err := dec.DecodeMapLen()
+		if err != nil {
+			return none, err
+		}
+		d := starlark.NewDict(n)
+		for i := 0; i < n; i++ {
+			k, err := decodeStarlarkValue(dec)
+			if err != nil {
+				return none, err
+			}
+			v, err := decodeStarlarkValue(dec)
+			if err != nil {
+				return none, err
+			}
+			if err := d.SetKey(k, v); err != nil {
+				return none, err
+			}
+		}
+		return d, nil
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return none, err
+		}
+		l := make([]starlark.Value, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := decodeStarlarkValue(dec)
+			if err != nil {
+				return none, err
+			}
+			l = append(l, v)
+		}
+		return starlark.NewList(l), nil
+	case msgpcode.IsBin(code):
+		bs, err := dec.DecodeBytes()
+		if err != nil {
+			return none, err
+		}
+		return starlark.Bytes(bs), nil
+	}
+
+	// scalars
+	v, err := dec.DecodeInterfaceLoose()
+	if err != nil {
+		return none, err
+	}
+	switch t := v.(type) {
+	case nil:
+		return none, nil
+	case bool:
+		return starlark.Bool(t), nil
+	case int64:
+		return starlark.MakeInt64(t), nil
+	case uint64:
+		return starlark.MakeUint64(t), nil
+	case float64:
+		return starlark.Float(t), nil
+	case string:
+		return starlark.String(t), nil
+	case []byte:
+		return starlark.Bytes(t), nil
+	default:
+		return none, fmt.Errorf("unsupported msgpack type: %T", v)
+	}
+}
+
+func (m *Module) getObject(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key           tps.StringOrBytes
+		failOnMissing bool
+		db            tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "fail_missing?", &failOnMissing, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// get value as bytes
+	vs, err := m.getValue(db.GoString(), key.GoBytes(), failOnMissing)
+	if err != nil {
+		return none, err
+	}
+
+	// for unset key, return None
+	if vs == nil {
+		return none, nil
+	}
+
+	// parse msgpack
+	return decodeMsgpack(vs)
+}
+
+func (m *Module) setObject(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key   tps.StringOrBytes
+		value starlark.Value
+		db    tps.StringOrBytes
+		ttl   tps.FloatOrInt
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "db?", &db, "ttl?", &ttl); err != nil {
+		return none, err
+	}
+	exp, err := parseTTL(ttl)
+	if err != nil {
+		return none, err
+	}
+
+	// convert value to msgpack and set
+	bs, err := encodeMsgpack(value)
+	if err != nil {
+		return none, err
+	}
+	return none, m.setValue(db.GoString(), key.GoBytes(), bs, exp)
+}
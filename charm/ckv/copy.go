@@ -0,0 +1,181 @@
+package ckv
+
+import (
+	"fmt"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// readEntries returns the entries of the key, or all the keys with the prefix, with the values and expiry copied.
+func (m *Module) readEntries(db string, key []byte, byPrefix bool) ([]*badger.Entry, error) {
+	// get db client
+	dc, err := m.getDBClient(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// collect entries
+	var entries []*badger.Entry
+	add := func(item *badger.Item) error {
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		e := badger.NewEntry(item.KeyCopy(nil), v)
+		e.ExpiresAt = item.ExpiresAt()
+		entries = append(entries, e)
+		return nil
+	}
+	err = dc.View(func(txn *badger.Txn) error {
+		if !byPrefix {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			return add(item)
+		}
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = key
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(key); it.ValidForPrefix(key); it.Next() {
+			if err := add(it.Item()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// genCopyFunc generates the Starlark callable function to copy or move the key, or the keys with the prefix, between databases.
+// The expiry is kept, and the existing keys in the target database are overwritten. It returns the number of keys copied or moved.
+func (m *Module) genCopyFunc(move, byPrefix bool) func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	keyArg := "key"
+	if byPrefix {
+		keyArg = "prefix"
+	}
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			key    tps.StringOrBytes
+			fromDB tps.StringOrBytes
+			toDB   tps.StringOrBytes
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, keyArg, &key, "from_db", &fromDB, "to_db", &toDB); err != nil {
+			return none, err
+		}
+		if dbName(fromDB.GoString()) == dbName(toDB.GoString()) {
+			return none, fmt.Errorf("%s: from_db and to_db must be different, got %s", b.Name(), dbName(fromDB.GoString()))
+		}
+		if move {
+			if err := m.checkWritable(fromDB.GoString()); err != nil {
+				return none, err
+			}
+		}
+
+		// read from the source
+		entries, err := m.readEntries(fromDB.GoString(), key.GoBytes(), byPrefix)
+		if err != nil {
+			return none, err
+		}
+
+		// write to the target and remove from the source in chunks
+		for i := 0; i < len(entries); i += restoreChunkSize {
+			end := i + restoreChunkSize
+			if end > len(entries) {
+				end = len(entries)
+			}
+			chunk := entries[i:end]
+			// keep the keys before writing, since Badger appends the version to the keys of entries in the commit
+			keys := make([][]byte, len(chunk))
+			for j, e := range chunk {
+				keys[j] = e.Key
+			}
+			if err := m.writeEntries(toDB.GoString(), chunk); err != nil {
+				return none, err
+			}
+			if !move {
+				continue
+			}
+			if err := m.updateDB(fromDB.GoString(), func(txn *badger.Txn) error {
+				for _, k := range keys {
+					if err := txn.Delete(k); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return none, err
+			}
+		}
+		return starlark.MakeInt(len(entries)), nil
+	}
+}
+
+// deletePrefix deletes all the keys with the prefix in batches of transactions, so the deletions are synced to Charm Cloud.
+// The local database in offline mode is dropped by prefix directly. It returns the number of keys deleted.
+func (m *Module) deletePrefix(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		prefix tps.StringOrBytes
+		db     tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "prefix", &prefix, "db?", &db); err != nil {
+		return none, err
+	}
+	pf := prefix.GoBytes()
+	if len(pf) == 0 {
+		return none, fmt.Errorf("%s: prefix must not be empty, use delete_db to remove the whole database", b.Name())
+	}
+	if err := m.checkWritable(db.GoString()); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// collect keys without values
+	var keys [][]byte
+	if err := dc.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = pf
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(pf); it.ValidForPrefix(pf); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	}); err != nil {
+		return none, err
+	}
+
+	// drop or delete in batches
+	if m.isLocal(db.GoString()) {
+		if err := dc.DB.DropPrefix(pf); err != nil {
+			return none, err
+		}
+		return starlark.MakeInt(len(keys)), nil
+	}
+	for i := 0; i < len(keys); i += restoreChunkSize {
+		end := i + restoreChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := m.updateDB(db.GoString(), func(txn *badger.Txn) error {
+			for _, k := range keys[i:end] {
+				if err := txn.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return none, err
+		}
+	}
+	return starlark.MakeInt(len(keys)), nil
+}
@@ -0,0 +1,79 @@
+package ckv
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// maxCounterRetries is the maximum times to retry the counter update on transaction conflicts.
+const maxCounterRetries = 10
+
+// addCounter adds the delta to the integer value of the key in a transaction, and returns the new value.
+// The missing key counts from zero, and the expiry of the existing key is kept. The update is retried on transaction conflicts.
+func (m *Module) addCounter(db string, key []byte, delta int64) (int64, error) {
+	var (
+		res int64
+		err error
+	)
+	for i := 0; i < maxCounterRetries; i++ {
+		err = m.updateDB(db, func(txn *badger.Txn) error {
+			// read the current value
+			var (
+				cur       int64
+				expiresAt uint64
+			)
+			item, err := txn.Get(key)
+			switch {
+			case errors.Is(err, badger.ErrKeyNotFound):
+			case err != nil:
+				return err
+			default:
+				expiresAt = item.ExpiresAt()
+				v, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if cur, err = strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64); err != nil {
+					return fmt.Errorf("value of key %q is not an integer: %q", key, v)
+				}
+			}
+
+			// write the new value
+			res = cur + delta
+			e := badger.NewEntry(key, []byte(strconv.FormatInt(res, 10)))
+			e.ExpiresAt = expiresAt
+			return txn.SetEntry(e)
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+		log.Debugw("retry counter update on conflict", "key", string(key), "attempt", i+1)
+	}
+	return res, err
+}
+
+func (m *Module) genCounterFunc(sign int64) func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			key tps.StringOrBytes
+			by  = 1
+			db  tps.StringOrBytes
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "by?", &by, "db?", &db); err != nil {
+			return none, err
+		}
+
+		// update counter
+		n, err := m.addCounter(db.GoString(), key.GoBytes(), sign*int64(by))
+		if err != nil {
+			return none, err
+		}
+		return starlark.MakeInt64(n), nil
+	}
+}
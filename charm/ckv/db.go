@@ -0,0 +1,216 @@
+package ckv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"github.com/charmbracelet/charm/fs"
+	"github.com/charmbracelet/charm/kv"
+	"go.starlark.net/starlark"
+)
+
+// dbName returns the name of the database, empty name means the default database.
+func dbName(name string) string {
+	if name == "" {
+		return defaultDB
+	}
+	return name
+}
+
+// isReadOnly returns true if the database is opened read-only.
+func (m *Module) isReadOnly(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.readOnly[dbName(name)]
+}
+
+// isLocal returns true if the database is opened without Charm client in offline mode.
+func (m *Module) isLocal(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.local[dbName(name)]
+}
+
+// dbLock returns the mutex to serialize the commits and syncs of the database.
+func (m *Module) dbLock(name string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = dbName(name)
+	mu, ok := m.locks[name]
+	if !ok {
+		mu = &sync.Mutex{}
+		m.locks[name] = mu
+	}
+	return mu
+}
+
+// checkWritable returns error if the database is opened read-only.
+func (m *Module) checkWritable(name string) error {
+	if m.isReadOnly(name) {
+		return fmt.Errorf("database %s is opened read-only", dbName(name))
+	}
+	return nil
+}
+
+// autoSync syncs the database before reading, it's skipped for the read-only database since the synced diffs can't be written,
+// and for the local database in offline mode.
+func (m *Module) autoSync(name string, dc *kv.KV) error {
+	if m.isLocal(name) {
+		return nil
+	}
+	if m.isReadOnly(name) {
+		log.Debugw("skip syncing read-only database", "db", dbName(name))
+		return nil
+	}
+	return m.syncWith(name, dc)
+}
+
+// syncWith syncs the database with Charm Cloud, and records the time for stats.
+func (m *Module) syncWith(name string, dc *kv.KV) error {
+	mu := m.dbLock(name)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := dc.Sync(); err != nil {
+		return err
+	}
+	m.markSynced(name)
+	return nil
+}
+
+// markSynced records the time of syncing the database, the commits are synced with Charm Cloud as well.
+func (m *Module) markSynced(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.synced[dbName(name)] = base.Now()
+}
+
+// openDB opens the database in the mode, it reopens the cached one if the mode is changed.
+func (m *Module) openDB(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		db       tps.StringOrBytes
+		readOnly bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "read_only?", &readOnly); err != nil {
+		return none, err
+	}
+
+	// close the cached one in the other mode, and set the mode
+	name := dbName(db.GoString())
+	m.mu.Lock()
+	if _, ok := m.dbs[name]; ok && m.readOnly[name] != readOnly {
+		if err := m.closeCachedDB(name); err != nil {
+			m.mu.Unlock()
+			return none, err
+		}
+	}
+	m.readOnly[name] = readOnly
+	m.mu.Unlock()
+
+	// open it now to report errors early, e.g. locked by another process
+	if _, err := m.getDBClient(name); err != nil {
+		m.mu.Lock()
+		delete(m.readOnly, name)
+		m.mu.Unlock()
+		return none, err
+	}
+	return none, nil
+}
+
+// Close closes all the opened databases, it's for the host application to release the file locks when it's done.
+func (m *Module) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []string
+	for name, db := range m.dbs {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+		delete(m.dbs, name)
+		delete(m.local, name)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("close databases: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// closeDB closes the database if it's opened, and removes it from the cache.
+func (m *Module) closeDB(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closeCachedDB(name)
+}
+
+// closeCachedDB is closeDB with the lock held by the caller.
+func (m *Module) closeCachedDB(name string) error {
+	name = dbName(name)
+	db, ok := m.dbs[name]
+	if !ok {
+		return nil
+	}
+	delete(m.dbs, name)
+	delete(m.local, name)
+	return db.Close()
+}
+
+func (m *Module) closeDBs(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var db tps.NullableStringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// close all if db is not given
+	if db.IsNull() {
+		return none, m.Close()
+	}
+	return none, m.closeDB(db.GoString())
+}
+
+func (m *Module) deleteDB(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name   tps.StringOrBytes
+		remote bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "remote?", &remote); err != nil {
+		return none, err
+	}
+	n := name.GoString()
+	if strings.TrimSpace(n) == "" || strings.ContainsAny(n, `/\`) || n == "." || n == ".." {
+		return none, fmt.Errorf("%s: invalid database name: %q", b.Name(), n)
+	}
+
+	// close it before removing files
+	if err := m.closeDB(n); err != nil {
+		return none, err
+	}
+
+	// remove the local copy
+	dd, err := m.DataPath()
+	if err != nil {
+		return none, err
+	}
+	if err := os.RemoveAll(filepath.Join(dd, kvDirName(m.IsOffline()), n)); err != nil {
+		return none, err
+	}
+
+	// remove the synced diffs in Charm Cloud, so it won't be restored on other machines
+	if remote {
+		cc, err := m.InitializeClient()
+		if err != nil {
+			return none, err
+		}
+		cfs, err := fs.NewFSWithClient(cc)
+		if err != nil {
+			return none, err
+		}
+		if err := cfs.Remove(n); err != nil {
+			return none, err
+		}
+	}
+	return none, nil
+}
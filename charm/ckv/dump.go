@@ -0,0 +1,111 @@
+package ckv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// dumpJSON returns the JSON object of all the key-value pairs with the prefix, the values are dumped as strings.
+// If path is given, it writes the JSON to the file and returns the number of pairs instead.
+func (m *Module) dumpJSON(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		db     tps.StringOrBytes
+		prefix tps.StringOrBytes
+		path   tps.StringOrBytes
+		sync   = true
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "prefix?", &prefix, "path?", &path, "sync?", &sync); err != nil {
+		return none, err
+	}
+
+	// sync before dumping
+	if sync {
+		dc, err := m.getDBClient(db.GoString())
+		if err != nil {
+			return none, err
+		}
+		if err := m.autoSync(db.GoString(), dc); err != nil {
+			return none, err
+		}
+	}
+
+	// read and encode the pairs, keys are sorted by encoding/json
+	entries, err := m.readEntries(db.GoString(), prefix.GoBytes(), true)
+	if err != nil {
+		return none, err
+	}
+	pairs := make(map[string]string, len(entries))
+	for _, e := range entries {
+		pairs[string(e.Key)] = string(e.Value)
+	}
+	js, err := json.Marshal(pairs)
+	if err != nil {
+		return none, err
+	}
+
+	// return or write the JSON
+	if path.GoString() == "" {
+		return starlark.String(js), nil
+	}
+	if err := os.WriteFile(path.GoString(), js, 0600); err != nil {
+		return none, err
+	}
+	return starlark.MakeInt(len(pairs)), nil
+}
+
+// loadJSON writes the key-value pairs of the JSON object to the database, and returns the number of pairs.
+// The string values are stored as is, and the others are stored as their JSON encoding, so they can be read by get_json().
+func (m *Module) loadJSON(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		data tps.StringOrBytes
+		db   tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "data", &data, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// parse the JSON object
+	var pairs map[string]json.RawMessage
+	if err := json.Unmarshal(data.GoBytes(), &pairs); err != nil {
+		return none, fmt.Errorf("%s: data must be a JSON object: %w", b.Name(), err)
+	}
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// convert to entries
+	entries := make([]*badger.Entry, 0, len(keys))
+	for _, k := range keys {
+		raw := bytes.TrimSpace(pairs[k])
+		v := []byte(raw)
+		if len(raw) > 0 && raw[0] == '"' {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return none, err
+			}
+			v = []byte(s)
+		}
+		entries = append(entries, badger.NewEntry([]byte(k), v))
+	}
+
+	// write in chunks
+	for i := 0; i < len(entries); i += restoreChunkSize {
+		end := i + restoreChunkSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := m.writeEntries(db.GoString(), entries[i:end]); err != nil {
+			return none, err
+		}
+	}
+	return starlark.MakeInt(len(entries)), nil
+}
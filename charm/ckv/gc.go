@@ -0,0 +1,99 @@
+package ckv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// maxGCRounds bounds the rounds of value log GC in one call, each round rewrites at most one value log file.
+const maxGCRounds = 100
+
+// diskUsage returns the sizes of the LSM tree and value log files in the database folder. It's calculated from the files
+// instead of db.Size(), since the latter is only refreshed periodically by Badger.
+func diskUsage(db *badger.DB) (lsm, vlog int64, err error) {
+	dir := db.Opts().Dir
+	if dir == "" {
+		return 0, 0, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return 0, 0, err
+		}
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".sst":
+			lsm += fi.Size()
+		case ".vlog":
+			vlog += fi.Size()
+		}
+	}
+	return lsm, vlog, nil
+}
+
+// runGC runs the value log GC repeatedly until nothing is rewritten, and reports the rounds, the reclaimed bytes and the sizes after GC.
+func (m *Module) runGC(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		db    tps.StringOrBytes
+		ratio = tps.FloatOrInt(0.5)
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "discard_ratio?", &ratio); err != nil {
+		return none, err
+	}
+	if ratio <= 0 || ratio >= 1 {
+		return none, fmt.Errorf("%s: discard_ratio must be between 0 and 1, got %v", b.Name(), ratio)
+	}
+	if err := m.checkWritable(db.GoString()); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// run gc and measure the space before and after
+	lsm0, vlog0, err := diskUsage(dc.DB)
+	if err != nil {
+		return none, err
+	}
+	rounds := 0
+	for ; rounds < maxGCRounds; rounds++ {
+		if err := dc.DB.RunValueLogGC(ratio.GoFloat64()); err != nil {
+			if errors.Is(err, badger.ErrNoRewrite) {
+				break
+			}
+			return none, err
+		}
+	}
+	lsm, vlog, err := diskUsage(dc.DB)
+	if err != nil {
+		return none, err
+	}
+
+	// return the report
+	reclaimed := lsm0 + vlog0 - lsm - vlog
+	if reclaimed < 0 {
+		reclaimed = 0
+	}
+	res := starlark.NewDict(4)
+	_ = res.SetKey(starlark.String("rounds"), starlark.MakeInt(rounds))
+	_ = res.SetKey(starlark.String("reclaimed"), starlark.MakeInt64(reclaimed))
+	_ = res.SetKey(starlark.String("lsm_size"), starlark.MakeInt64(lsm))
+	_ = res.SetKey(starlark.String("vlog_size"), starlark.MakeInt64(vlog))
+	return res, nil
+}
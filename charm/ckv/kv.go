@@ -2,10 +2,16 @@
 package ckv
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/1set/starlet"
 	"github.com/1set/starlet/dataconv"
@@ -21,53 +27,147 @@ import (
 const ModuleName = "ckv"
 
 // Module wraps the ConfigurableModule with specific functionality for Charm KV.
+// It's safe for concurrent use by multiple Starlark threads, e.g. shared across starlet machines.
 type Module struct {
 	*core.CommonModule
-	dbs map[string]*kv.KV
+	mu       sync.Mutex // guards the maps below and opening databases
+	dbs      map[string]*kv.KV
+	readOnly map[string]bool
+	local    map[string]bool        // opened without Charm client in offline mode
+	synced   map[string]time.Time   // last time of syncing with Charm Cloud
+	locks    map[string]*sync.Mutex // serializes the commits and syncs of each database
 }
 
-// NewModule creates a new instance of Module. It doesn't set any configuration values, nor provide any setters.
-func NewModule() *Module {
+func newModule(cm *core.CommonModule) *Module {
 	return &Module{
-		core.NewCommonModule(),
-		make(map[string]*kv.KV),
+		CommonModule: cm,
+		dbs:          make(map[string]*kv.KV),
+		readOnly:     make(map[string]bool),
+		local:        make(map[string]bool),
+		synced:       make(map[string]time.Time),
+		locks:        make(map[string]*sync.Mutex),
 	}
 }
 
+// NewModule creates a new instance of Module. It doesn't set any configuration values, nor provide any setters.
+func NewModule() *Module {
+	return newModule(core.NewCommonModule())
+}
+
 // NewModuleWithConfig creates a new instance of Module with the given configuration values.
 func NewModuleWithConfig(host, dataDirPath, keyFilePath string, sshPort, httpPort uint16) *Module {
-	return &Module{
-		core.NewCommonModuleWithConfig(host, dataDirPath, keyFilePath, sshPort, httpPort),
-		make(map[string]*kv.KV),
-	}
+	return newModule(core.NewCommonModuleWithConfig(host, dataDirPath, keyFilePath, sshPort, httpPort))
 }
 
 // NewModuleWithGetter creates a new instance of Module with the given configuration getters.
 func NewModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort base.ConfigGetter[string]) *Module {
-	return &Module{
-		core.NewCommonModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort),
-		make(map[string]*kv.KV),
-	}
+	return newModule(core.NewCommonModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort))
+}
+
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"get":           {"key", "fail_missing", "db"},
+	"set":           {"key", "value", "db", "ttl"},
+	"get_json":      {"key", "fail_missing", "db"},
+	"set_json":      {"key", "value", "db", "ttl"},
+	"get_obj":       {"key", "fail_missing", "db"},
+	"set_obj":       {"key", "value", "db", "ttl"},
+	"get_or_set":    {"key", "fn", "ttl", "db"},
+	"delete":        {"key", "db"},
+	"delete_prefix": {"prefix", "db"},
+	"list":          {"db", "sync", "reverse", "limit", "prefix", "after_key", "match", "regex", "start", "end"},
+	"list_keys":     {"db", "sync", "reverse", "limit", "prefix", "after_key", "match", "regex", "start", "end"},
+	"list_values":   {"db", "sync", "reverse", "limit", "prefix", "after_key", "match", "regex", "start", "end"},
+	"scan":          {"fn", "db", "prefix", "sync", "reverse"},
+	"ttl":           {"key", "fail_missing", "db"},
+	"stat":          {"key", "fail_missing", "db"},
+	"incr":          {"key", "by", "db"},
+	"decr":          {"key", "by", "db"},
+	"txn":           {"fn", "db"},
+	"mget":          {"keys", "db"},
+	"mset":          {"items", "db", "ttl"},
+	"cas":           {"key", "old", "new", "db"},
+	"exists":        {"key", "db"},
+	"count":         {"prefix", "db", "sync"},
+	"watch":         {"prefix", "callback", "timeout", "interval", "db"},
+	"lock":          {"name", "ttl", "owner", "db"},
+	"unlock":        {"name", "owner", "db"},
+	"push":          {"queue", "value", "db"},
+	"pop":           {"queue", "db", "sync"},
+	"peek":          {"queue", "db", "sync"},
+	"ns":            {"name", "db"},
+	"sync":          {"db"},
+	"reset":         {"db"},
+	"open":          {"db", "read_only"},
+	"close":         {"db"},
+	"delete_db":     {"name", "remote"},
+	"backup":        {"path", "db", "sync"},
+	"restore":       {"path", "db"},
+	"dump_json":     {"db", "prefix", "path", "sync"},
+	"load_json":     {"data", "db"},
+	"gc":            {"db", "discard_ratio"},
+	"stats":         {"db"},
+	"sync_status":   {"db"},
+	"copy":          {"key", "from_db", "to_db"},
+	"move":          {"key", "from_db", "to_db"},
+	"copy_prefix":   {"prefix", "from_db", "to_db"},
+	"move_prefix":   {"prefix", "from_db", "to_db"},
 }
 
 // LoadModule returns the Starlark module loader with the email-specific functions.
 func (m *Module) LoadModule() starlet.ModuleLoader {
 	additionalFuncs := starlark.StringDict{
 		// kv ops
-		"get":         starlark.NewBuiltin(ModuleName+".get", m.getString),
-		"set":         starlark.NewBuiltin(ModuleName+".set", m.setString),
-		"get_json":    starlark.NewBuiltin(ModuleName+".get_json", m.getJSON),
-		"set_json":    starlark.NewBuiltin(ModuleName+".set_json", m.setJSON),
-		"delete":      starlark.NewBuiltin(ModuleName+".delete", m.deleteKey),
-		"list":        starlark.NewBuiltin(ModuleName+".list", m.listAll),
-		"list_keys":   starlark.NewBuiltin(ModuleName+".list_keys", m.listKeys),
-		"list_values": starlark.NewBuiltin(ModuleName+".list_values", m.listValues),
+		"get":           starlark.NewBuiltin(ModuleName+".get", m.getString),
+		"set":           starlark.NewBuiltin(ModuleName+".set", m.setString),
+		"get_json":      starlark.NewBuiltin(ModuleName+".get_json", m.getJSON),
+		"set_json":      starlark.NewBuiltin(ModuleName+".set_json", m.setJSON),
+		"get_obj":       starlark.NewBuiltin(ModuleName+".get_obj", m.getObject),
+		"set_obj":       starlark.NewBuiltin(ModuleName+".set_obj", m.setObject),
+		"get_or_set":    starlark.NewBuiltin(ModuleName+".get_or_set", m.getOrSet),
+		"delete":        starlark.NewBuiltin(ModuleName+".delete", m.deleteKey),
+		"delete_prefix": starlark.NewBuiltin(ModuleName+".delete_prefix", m.deletePrefix),
+		"list":          starlark.NewBuiltin(ModuleName+".list", m.listAll),
+		"list_keys":     starlark.NewBuiltin(ModuleName+".list_keys", m.listKeys),
+		"list_values":   starlark.NewBuiltin(ModuleName+".list_values", m.listValues),
+		"scan":          starlark.NewBuiltin(ModuleName+".scan", m.scanItems),
+		"ttl":           starlark.NewBuiltin(ModuleName+".ttl", m.getTTL),
+		"stat":          starlark.NewBuiltin(ModuleName+".stat", m.statKey),
+		"incr":          starlark.NewBuiltin(ModuleName+".incr", m.genCounterFunc(1)),
+		"decr":          starlark.NewBuiltin(ModuleName+".decr", m.genCounterFunc(-1)),
+		"txn":           starlark.NewBuiltin(ModuleName+".txn", m.runTxn),
+		"mget":          starlark.NewBuiltin(ModuleName+".mget", m.multiGet),
+		"mset":          starlark.NewBuiltin(ModuleName+".mset", m.multiSet),
+		"cas":           starlark.NewBuiltin(ModuleName+".cas", m.compareAndSwap),
+		"exists":        starlark.NewBuiltin(ModuleName+".exists", m.existsKey),
+		"count":         starlark.NewBuiltin(ModuleName+".count", m.countKeys),
+		"watch":         starlark.NewBuiltin(ModuleName+".watch", m.watchKeys),
+		"lock":          starlark.NewBuiltin(ModuleName+".lock", m.acquireLock),
+		"unlock":        starlark.NewBuiltin(ModuleName+".unlock", m.releaseLock),
+		"push":          starlark.NewBuiltin(ModuleName+".push", m.pushQueue),
+		"pop":           starlark.NewBuiltin(ModuleName+".pop", m.genQueueFunc(true)),
+		"peek":          starlark.NewBuiltin(ModuleName+".peek", m.genQueueFunc(false)),
+		"ns":            starlark.NewBuiltin(ModuleName+".ns", m.newNamespace),
 		// db ops
-		"list_db": starlark.NewBuiltin(ModuleName+".list_db", m.listDB),
-		"sync":    starlark.NewBuiltin(ModuleName+".sync", m.syncDB),
-		"reset":   starlark.NewBuiltin(ModuleName+".reset", m.resetLocalCopy),
-	}
-	return m.ExtendModuleLoader(ModuleName, additionalFuncs)
+		"list_db":     starlark.NewBuiltin(ModuleName+".list_db", m.listDB),
+		"sync":        starlark.NewBuiltin(ModuleName+".sync", m.syncDB),
+		"reset":       starlark.NewBuiltin(ModuleName+".reset", m.resetLocalCopy),
+		"open":        starlark.NewBuiltin(ModuleName+".open", m.openDB),
+		"close":       starlark.NewBuiltin(ModuleName+".close", m.closeDBs),
+		"delete_db":   starlark.NewBuiltin(ModuleName+".delete_db", m.deleteDB),
+		"backup":      starlark.NewBuiltin(ModuleName+".backup", m.backupDB),
+		"restore":     starlark.NewBuiltin(ModuleName+".restore", m.restoreDB),
+		"dump_json":   starlark.NewBuiltin(ModuleName+".dump_json", m.dumpJSON),
+		"load_json":   starlark.NewBuiltin(ModuleName+".load_json", m.loadJSON),
+		"gc":          starlark.NewBuiltin(ModuleName+".gc", m.runGC),
+		"stats":       starlark.NewBuiltin(ModuleName+".stats", m.getStats),
+		"sync_status": starlark.NewBuiltin(ModuleName+".sync_status", m.getSyncStatus),
+		"copy":        starlark.NewBuiltin(ModuleName+".copy", m.genCopyFunc(false, false)),
+		"move":        starlark.NewBuiltin(ModuleName+".move", m.genCopyFunc(true, false)),
+		"copy_prefix": starlark.NewBuiltin(ModuleName+".copy_prefix", m.genCopyFunc(false, true)),
+		"move_prefix": starlark.NewBuiltin(ModuleName+".move_prefix", m.genCopyFunc(true, true)),
+	}
+	return m.ExtendModuleLoader(ModuleName, additionalFuncs, funcParams)
 }
 
 var (
@@ -76,31 +176,128 @@ var (
 	defaultDB = "starcli.kv.user.default"
 )
 
-func (m *Module) getDBClient(name string) (*kv.KV, error) {
-	// use default db if name is empty
-	if name == "" {
-		name = defaultDB
+// OpenDB returns the cached Charm KV database with the given name, or opens it if not cached yet.
+// It's for other modules built on top of Charm KV, empty name means the default database.
+// It returns core.ErrOffline in offline mode, since the local database has no Charm client for the writes and syncs of the handle,
+// use View, Update, Delete and Sync instead.
+func (m *Module) OpenDB(name string) (*kv.KV, error) {
+	if m.IsOffline() {
+		return nil, core.ErrOffline
 	}
-	// check if db is already opened
-	if db, ok := m.dbs[name]; ok {
-		return db, nil
+	return m.getDBClient(name)
+}
+
+// Get returns the value of the key in the database, and whether it's found.
+// It's for other modules caching data in Charm KV, e.g. as the embedding cache of llm module.
+func (m *Module) Get(db, key string) ([]byte, bool, error) {
+	val, err := m.getValue(db, []byte(key), false)
+	if err != nil {
+		return nil, false, err
 	}
+	return val, val != nil, nil
+}
 
-	// get client for opening db
-	cc, err := m.InitializeClient()
+// Set stores the value of the key in the database.
+func (m *Module) Set(db, key string, value []byte) error {
+	return m.setValue(db, []byte(key), value, 0)
+}
+
+// Delete deletes the key in the database, it works in offline mode as well.
+func (m *Module) Delete(db, key string) error {
+	return m.deleteValue(db, []byte(key))
+}
+
+// Sync syncs the database with Charm Cloud, it returns core.ErrOffline in offline mode.
+func (m *Module) Sync(db string) error {
+	if m.IsOffline() {
+		return core.ErrOffline
+	}
+	dc, err := m.getDBClient(db)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return m.syncWith(db, dc)
+}
+
+// View runs the function in a read-only transaction of the database, after syncing with Charm Cloud unless it's offline or read-only.
+func (m *Module) View(db string, fn func(txn *badger.Txn) error) error {
+	dc, err := m.getDBClient(db)
+	if err != nil {
+		return err
+	}
+	if err := m.autoSync(db, dc); err != nil {
+		return err
+	}
+	return dc.View(fn)
+}
+
+// Update runs the function in an update transaction of the database and commits it, it works in offline mode as well.
+// The database is synced before each try to see the changes of other devices, and the update is retried on transaction conflicts.
+// The function returning ErrSkipCommit discards the transaction without error.
+func (m *Module) Update(db string, fn func(txn *badger.Txn) error) error {
+	dc, err := m.getDBClient(db)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < maxCounterRetries; i++ {
+		if err = m.autoSync(db, dc); err != nil {
+			return err
+		}
+		err = m.updateDB(db, fn)
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+		log.Debugw("retry update on conflict", "db", dbName(db), "attempt", i+1)
+	}
+	return err
+}
+
+// getDBClient returns the cached database, or opens it. The lock is held while opening, so concurrent callers wait for the same one.
+func (m *Module) getDBClient(name string) (*kv.KV, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// use default db if name is empty
+	name = dbName(name)
+	// check if db is already opened, and reopen it if the offline mode is changed
+	offline := m.IsOffline()
+	if db, ok := m.dbs[name]; ok {
+		if m.local[name] == offline {
+			return db, nil
+		}
+		if err := m.closeCachedDB(name); err != nil {
+			return nil, err
+		}
+	}
+
 	// get data path
-	dd, err := cc.DataPath()
+	dd, err := m.DataPath()
 	if err != nil {
 		return nil, err
 	}
-	pn := filepath.Join(dd, "/kv/", name)
+	pn := filepath.Join(dd, kvDirName(offline), name)
 	// BadgerDB options
 	opts := badger.DefaultOptions(pn).WithLoggingLevel(badger.ERROR)
 	opts.Logger = nil
 	opts = opts.WithValueLogFileSize(10000000)
+	opts = opts.WithReadOnly(m.readOnly[name])
+
+	// open local db directly in offline mode
+	if offline {
+		db, err := openLocalDB(opts)
+		if err != nil {
+			return nil, err
+		}
+		m.dbs[name] = db
+		m.local[name] = true
+		return db, nil
+	}
+
+	// get client for opening db
+	cc, err := m.InitializeClient()
+	if err != nil {
+		return nil, err
+	}
 
 	// open db & save to cache
 	db, err := kv.Open(cc, name, opts)
@@ -116,17 +313,12 @@ func (m *Module) listDB(thread *starlark.Thread, b *starlark.Builtin, args starl
 		return none, err
 	}
 
-	cc, err := m.InitializeClient()
-	if err != nil {
-		return none, err
-	}
-
 	// get data path
-	dd, err := cc.DataPath()
+	dd, err := m.DataPath()
 	if err != nil {
 		return none, err
 	}
-	dp := filepath.Join(dd, "kv")
+	dp := filepath.Join(dd, kvDirName(m.IsOffline()))
 
 	// list db folders
 	entries, err := os.ReadDir(dp)
@@ -167,7 +359,22 @@ func (m *Module) getValue(db string, key []byte, failOnMissing bool) ([]byte, er
 	return val, nil
 }
 
-func (m *Module) setValue(db string, key, value []byte) error {
+func (m *Module) setValue(db string, key, value []byte, ttl time.Duration) error {
+	if err := m.checkWritable(db); err != nil {
+		return err
+	}
+
+	// set value with expiry or to the local db in a transaction
+	if ttl > 0 || m.IsOffline() {
+		return m.updateDB(db, func(txn *badger.Txn) error {
+			e := badger.NewEntry(key, value)
+			if ttl > 0 {
+				e = e.WithTTL(ttl)
+			}
+			return txn.SetEntry(e)
+		})
+	}
+
 	// get db client
 	dc, err := m.getDBClient(db)
 	if err != nil {
@@ -175,13 +382,71 @@ func (m *Module) setValue(db string, key, value []byte) error {
 	}
 
 	// set value
+	mu := m.dbLock(db)
+	mu.Lock()
+	defer mu.Unlock()
 	err = dc.Set(key, value)
 	if err != nil {
 		return err
 	}
+	m.markSynced(db)
+	return nil
+}
+
+// ErrSkipCommit is returned by the function of Update or updateDB to discard the transaction without error, e.g. nothing is written.
+var ErrSkipCommit = errors.New("skip commit")
+
+// updateDB runs the function in a new update transaction of the database, and commits it synchronously with the diff synced to Charm Cloud.
+// The transaction is discarded if the function fails.
+func (m *Module) updateDB(db string, fn func(txn *badger.Txn) error) error {
+	if err := m.checkWritable(db); err != nil {
+		return err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db)
+	if err != nil {
+		return err
+	}
+
+	// run and commit the transaction, the local db is committed without syncing
+	local := m.isLocal(db)
+	mu := m.dbLock(db)
+	var txn *badger.Txn
+	if local {
+		mu.Lock()
+		txn = newLocalTxn(dc)
+		mu.Unlock()
+	} else if txn, err = dc.NewTransaction(true); err != nil {
+		return err
+	}
+	defer txn.Discard()
+	if err := fn(txn); err != nil {
+		if errors.Is(err, ErrSkipCommit) {
+			return nil
+		}
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if local {
+		return commitLocalTxn(dc, txn)
+	}
+	if err := dc.Commit(txn, nil); err != nil {
+		return err
+	}
+	m.markSynced(db)
 	return nil
 }
 
+// parseTTL converts the ttl argument in seconds to duration, zero means no expiry.
+func parseTTL(ttl tps.FloatOrInt) (time.Duration, error) {
+	if ttl < 0 {
+		return 0, fmt.Errorf("ttl must be non-negative, got %v", ttl)
+	}
+	return time.Duration(ttl.GoFloat64() * float64(time.Second)), nil
+}
+
 func (m *Module) getString(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		key           tps.StringOrBytes
@@ -205,13 +470,18 @@ func (m *Module) setString(thread *starlark.Thread, b *starlark.Builtin, args st
 		key   tps.StringOrBytes
 		value starlark.Value
 		db    tps.StringOrBytes
+		ttl   tps.FloatOrInt
 	)
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "db?", &db); err != nil {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "db?", &db, "ttl?", &ttl); err != nil {
+		return none, err
+	}
+	exp, err := parseTTL(ttl)
+	if err != nil {
 		return none, err
 	}
 
 	// set string representation of value
-	err := m.setValue(db.GoString(), key.GoBytes(), []byte(dataconv.StarString(value)))
+	err = m.setValue(db.GoString(), key.GoBytes(), []byte(dataconv.StarString(value)), exp)
 	return none, err
 }
 
@@ -245,8 +515,13 @@ func (m *Module) setJSON(thread *starlark.Thread, b *starlark.Builtin, args star
 		key   tps.StringOrBytes
 		value starlark.Value
 		db    tps.StringOrBytes
+		ttl   tps.FloatOrInt
 	)
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "db?", &db); err != nil {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "db?", &db, "ttl?", &ttl); err != nil {
+		return none, err
+	}
+	exp, err := parseTTL(ttl)
+	if err != nil {
 		return none, err
 	}
 
@@ -255,7 +530,7 @@ func (m *Module) setJSON(thread *starlark.Thread, b *starlark.Builtin, args star
 	if err != nil {
 		return none, err
 	}
-	return none, m.setValue(db.GoString(), key.GoBytes(), []byte(js))
+	return none, m.setValue(db.GoString(), key.GoBytes(), []byte(js), exp)
 }
 
 func (m *Module) deleteKey(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -267,18 +542,264 @@ func (m *Module) deleteKey(thread *starlark.Thread, b *starlark.Builtin, args st
 		return none, err
 	}
 
+	// delete key
+	return none, m.deleteValue(db.GoString(), key.GoBytes())
+}
+
+func (m *Module) deleteValue(db string, key []byte) error {
+	if err := m.checkWritable(db); err != nil {
+		return err
+	}
+
+	// delete from the local db in a transaction
+	if m.IsOffline() {
+		return m.updateDB(db, func(txn *badger.Txn) error {
+			return txn.Delete(key)
+		})
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db)
+	if err != nil {
+		return err
+	}
+
+	// delete key
+	mu := m.dbLock(db)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := dc.Delete(key); err != nil {
+		return err
+	}
+	m.markSynced(db)
+	return nil
+}
+
+func (m *Module) getTTL(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key           tps.StringOrBytes
+		failOnMissing bool
+		db            tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "fail_missing?", &failOnMissing, "db?", &db); err != nil {
+		return none, err
+	}
+
 	// get db client
 	dc, err := m.getDBClient(db.GoString())
 	if err != nil {
 		return none, err
 	}
 
-	// delete key
-	err = dc.Delete(key.GoBytes())
-	return none, err
+	// get expiry of the key in unix time, zero means no expiry
+	var expiresAt uint64
+	if err := dc.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key.GoBytes())
+		if err != nil {
+			return err
+		}
+		expiresAt = item.ExpiresAt()
+		return nil
+	}); err != nil {
+		if !failOnMissing && errors.Is(err, badger.ErrKeyNotFound) {
+			return none, nil
+		}
+		return none, err
+	}
+
+	// return remaining seconds, or None for no expiry
+	if expiresAt == 0 {
+		return none, nil
+	}
+	left := time.Unix(int64(expiresAt), 0).Sub(base.Now()).Seconds()
+	if left < 0 {
+		left = 0
+	}
+	return starlark.Float(left), nil
+}
+
+func (m *Module) statKey(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key           tps.StringOrBytes
+		failOnMissing bool
+		db            tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "fail_missing?", &failOnMissing, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// get metadata of the item without reading value
+	res := starlark.NewDict(5)
+	if err := dc.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key.GoBytes())
+		if err != nil {
+			return err
+		}
+		var expiresAt starlark.Value = none
+		if e := item.ExpiresAt(); e > 0 {
+			expiresAt = starlark.MakeUint64(e)
+		}
+		_ = res.SetKey(starlark.String("key"), starlark.String(item.Key()))
+		_ = res.SetKey(starlark.String("version"), starlark.MakeUint64(item.Version()))
+		_ = res.SetKey(starlark.String("expires_at"), expiresAt)
+		_ = res.SetKey(starlark.String("size"), starlark.MakeInt64(item.EstimatedSize()))
+		_ = res.SetKey(starlark.String("value_size"), starlark.MakeInt64(int64(item.ValueSize())))
+		return nil
+	}); err != nil {
+		if !failOnMissing && errors.Is(err, badger.ErrKeyNotFound) {
+			return none, nil
+		}
+		return none, err
+	}
+	return res, nil
+}
+
+func (m *Module) existsKey(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key tps.StringOrBytes
+		db  tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// check key without reading value
+	err = dc.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key.GoBytes())
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return starlark.False, nil
+	}
+	if err != nil {
+		return none, err
+	}
+	return starlark.True, nil
+}
+
+func (m *Module) countKeys(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		prefix tps.StringOrBytes
+		db     tps.StringOrBytes
+		sync   = true
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "prefix?", &prefix, "db?", &db, "sync?", &sync); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// sync before counting
+	if sync {
+		if err := m.autoSync(db.GoString(), dc); err != nil {
+			return none, err
+		}
+	}
+
+	// count keys without fetching values
+	cnt := 0
+	if err := dc.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix.GoBytes()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(opts.Prefix); it.ValidForPrefix(opts.Prefix); it.Next() {
+			cnt++
+		}
+		return nil
+	}); err != nil {
+		return none, err
+	}
+	return starlark.MakeInt(cnt), nil
+}
+
+// listOptions are the options of listing items in the database.
+type listOptions struct {
+	syncFirst bool
+	keyOnly   bool
+	valueOnly bool
+	reverse   bool
+	limit     int
+	prefix    []byte
+	after     []byte // exclusive start key for pagination
+	start     []byte // inclusive lower bound of keys
+	end       []byte // exclusive upper bound of keys
+	match     func(key []byte) bool
+	trim      bool // strip the prefix from the returned keys
+}
+
+// newKeyMatcher returns the function to filter keys by the glob pattern, or the regular expression if regex is set.
+// It returns nil if the pattern is empty.
+func newKeyMatcher(pattern string, regex bool) (func(key []byte) bool, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if regex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.Match, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	return func(key []byte) bool {
+		ok, _ := path.Match(pattern, string(key))
+		return ok
+	}, nil
+}
+
+// seekKey returns the key to start iterating from, which is the latest one of the prefix, the range bound and the after key in the listing order.
+func (o *listOptions) seekKey() []byte {
+	start := o.prefix
+	if o.reverse && len(o.prefix) > 0 {
+		start = append(append([]byte{}, o.prefix...), 0xFF)
+	}
+	bound := o.start
+	if o.reverse {
+		bound = o.end
+	}
+	for _, k := range [][]byte{bound, o.after} {
+		if len(k) == 0 {
+			continue
+		}
+		if c := bytes.Compare(k, start); len(start) == 0 || (!o.reverse && c > 0) || (o.reverse && c < 0) {
+			start = k
+		}
+	}
+	return start
 }
 
-func (m *Module) listItems(db string, syncFirst, keyOnly, valueOnly, reverse bool, limit int) (starlark.Value, error) {
+// inRange reports whether the key is within the range bounds, and whether the iteration should stop since it's past the range in the listing order.
+func (o *listOptions) inRange(key []byte) (ok, stop bool) {
+	if len(o.end) > 0 && bytes.Compare(key, o.end) >= 0 {
+		return false, !o.reverse
+	}
+	if len(o.start) > 0 && bytes.Compare(key, o.start) < 0 {
+		return false, o.reverse
+	}
+	return true, false
+}
+
+func (m *Module) listItems(db string, lo listOptions) (starlark.Value, error) {
 	// get db client
 	dc, err := m.getDBClient(db)
 	if err != nil {
@@ -286,9 +807,8 @@ func (m *Module) listItems(db string, syncFirst, keyOnly, valueOnly, reverse boo
 	}
 
 	// sync before listing
-	if syncFirst {
-		err = dc.Sync()
-		if err != nil {
+	if lo.syncFirst {
+		if err := m.autoSync(db, dc); err != nil {
 			return none, err
 		}
 	}
@@ -296,34 +816,52 @@ func (m *Module) listItems(db string, syncFirst, keyOnly, valueOnly, reverse boo
 	// list items
 	var (
 		cnt = 0
-		res = make([]starlark.Value, 0, limit)
+		res = make([]starlark.Value, 0, lo.limit)
 	)
 	if err := dc.View(func(txn *badger.Txn) error {
 		// set iterator options
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 10
-		opts.Reverse = reverse
-		opts.PrefetchValues = !keyOnly
+		opts.Reverse = lo.reverse
+		opts.PrefetchValues = !lo.keyOnly
+		opts.Prefix = lo.prefix
 		it := txn.NewIterator(opts)
 		defer it.Close()
 
-		// iterate and collect items
-		for it.Rewind(); it.Valid(); it.Next() {
+		// iterate and collect items, start from the end of prefix for reverse order, and skip the after key itself
+		it.Seek(lo.seekKey())
+		if len(lo.after) > 0 && it.ValidForPrefix(lo.prefix) && bytes.Equal(it.Item().Key(), lo.after) {
+			it.Next()
+		}
+		for ; it.ValidForPrefix(lo.prefix); it.Next() {
+			// check the range and filter keys before counting
+			if ok, stop := lo.inRange(it.Item().Key()); stop {
+				break
+			} else if !ok {
+				continue
+			}
+			if lo.match != nil && !lo.match(it.Item().Key()) {
+				continue
+			}
+
 			// check limit
-			if cnt++; limit > 0 && cnt > limit {
+			if cnt++; lo.limit > 0 && cnt > lo.limit {
 				break
 			}
 
 			// get key
 			item := it.Item()
 			k := item.Key()
-			if keyOnly {
+			if lo.trim {
+				k = k[len(lo.prefix):]
+			}
+			if lo.keyOnly {
 				res = append(res, starlark.String(k))
 				continue
 			}
 			// get value
 			err := item.Value(func(v []byte) error {
-				if valueOnly {
+				if lo.valueOnly {
 					res = append(res, starlark.String(v))
 				} else {
 					res = append(res, starlark.Tuple{starlark.String(k), starlark.String(v)})
@@ -349,13 +887,24 @@ func (m *Module) listKeys(thread *starlark.Thread, b *starlark.Builtin, args sta
 		sync    = true
 		reverse bool
 		limit   = 0
+		prefix  tps.StringOrBytes
+		after   tps.StringOrBytes
+		match   tps.StringOrBytes
+		regex   bool
+		start   tps.StringOrBytes
+		end     tps.StringOrBytes
 	)
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "sync?", &sync, "reverse?", &reverse, "limit?", &limit); err != nil {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "sync?", &sync, "reverse?", &reverse, "limit?", &limit, "prefix?", &prefix, "after_key?", &after,
+		"match?", &match, "regex?", &regex, "start?", &start, "end?", &end); err != nil {
+		return none, err
+	}
+	matcher, err := newKeyMatcher(match.GoString(), regex)
+	if err != nil {
 		return none, err
 	}
 
 	// list keys
-	return m.listItems(db.GoString(), sync, true, false, reverse, limit)
+	return m.listItems(db.GoString(), listOptions{syncFirst: sync, keyOnly: true, reverse: reverse, limit: limit, prefix: prefix.GoBytes(), after: after.GoBytes(), start: start.GoBytes(), end: end.GoBytes(), match: matcher})
 }
 
 func (m *Module) listValues(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -364,13 +913,24 @@ func (m *Module) listValues(thread *starlark.Thread, b *starlark.Builtin, args s
 		sync    = true
 		reverse bool
 		limit   = 0
+		prefix  tps.StringOrBytes
+		after   tps.StringOrBytes
+		match   tps.StringOrBytes
+		regex   bool
+		start   tps.StringOrBytes
+		end     tps.StringOrBytes
 	)
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "sync?", &sync, "reverse?", &reverse, "limit?", &limit); err != nil {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "sync?", &sync, "reverse?", &reverse, "limit?", &limit, "prefix?", &prefix, "after_key?", &after,
+		"match?", &match, "regex?", &regex, "start?", &start, "end?", &end); err != nil {
+		return none, err
+	}
+	matcher, err := newKeyMatcher(match.GoString(), regex)
+	if err != nil {
 		return none, err
 	}
 
 	// list values
-	return m.listItems(db.GoString(), sync, false, true, reverse, limit)
+	return m.listItems(db.GoString(), listOptions{syncFirst: sync, valueOnly: true, reverse: reverse, limit: limit, prefix: prefix.GoBytes(), after: after.GoBytes(), start: start.GoBytes(), end: end.GoBytes(), match: matcher})
 }
 
 func (m *Module) listAll(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -379,13 +939,24 @@ func (m *Module) listAll(thread *starlark.Thread, b *starlark.Builtin, args star
 		sync    = true
 		reverse bool
 		limit   = 0
+		prefix  tps.StringOrBytes
+		after   tps.StringOrBytes
+		match   tps.StringOrBytes
+		regex   bool
+		start   tps.StringOrBytes
+		end     tps.StringOrBytes
 	)
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "sync?", &sync, "reverse?", &reverse, "limit?", &limit); err != nil {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db, "sync?", &sync, "reverse?", &reverse, "limit?", &limit, "prefix?", &prefix, "after_key?", &after,
+		"match?", &match, "regex?", &regex, "start?", &start, "end?", &end); err != nil {
+		return none, err
+	}
+	matcher, err := newKeyMatcher(match.GoString(), regex)
+	if err != nil {
 		return none, err
 	}
 
 	// list items
-	return m.listItems(db.GoString(), sync, false, false, reverse, limit)
+	return m.listItems(db.GoString(), listOptions{syncFirst: sync, reverse: reverse, limit: limit, prefix: prefix.GoBytes(), after: after.GoBytes(), start: start.GoBytes(), end: end.GoBytes(), match: matcher})
 }
 
 func (m *Module) syncDB(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -394,6 +965,13 @@ func (m *Module) syncDB(thread *starlark.Thread, b *starlark.Builtin, args starl
 		return none, err
 	}
 
+	if m.IsOffline() {
+		return none, core.ErrOffline
+	}
+	if err := m.checkWritable(db.GoString()); err != nil {
+		return none, err
+	}
+
 	// get db client
 	dc, err := m.getDBClient(db.GoString())
 	if err != nil {
@@ -401,8 +979,7 @@ func (m *Module) syncDB(thread *starlark.Thread, b *starlark.Builtin, args starl
 	}
 
 	// sync db
-	err = dc.Sync()
-	return none, err
+	return none, m.syncWith(db.GoString(), dc)
 }
 
 func (m *Module) resetLocalCopy(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -411,6 +988,13 @@ func (m *Module) resetLocalCopy(thread *starlark.Thread, b *starlark.Builtin, ar
 		return none, err
 	}
 
+	if m.IsOffline() {
+		return none, core.ErrOffline
+	}
+	if err := m.checkWritable(db.GoString()); err != nil {
+		return none, err
+	}
+
 	// get db client
 	dc, err := m.getDBClient(db.GoString())
 	if err != nil {
@@ -418,11 +1002,16 @@ func (m *Module) resetLocalCopy(thread *starlark.Thread, b *starlark.Builtin, ar
 	}
 
 	// reset local copy
+	mu := m.dbLock(db.GoString())
+	mu.Lock()
+	defer mu.Unlock()
 	if err := dc.Reset(); err != nil {
 		return none, err
 	}
 
 	// remove from cache
-	delete(m.dbs, db.GoString())
+	m.mu.Lock()
+	delete(m.dbs, dbName(db.GoString()))
+	m.mu.Unlock()
 	return none, nil
 }
@@ -0,0 +1,123 @@
+package ckv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// lockKeyPrefix is the prefix of keys holding the locks, to keep them apart from the user keys.
+const lockKeyPrefix = "__ckv_lock__/"
+
+// defaultLockOwner returns the owner of locks for this process, i.e. the hostname and the process ID.
+func defaultLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// updateLock runs the function with the current owner of the lock in a transaction, empty owner means it's free or expired.
+// The database is synced first to see the locks of other devices, and the update is retried on transaction conflicts.
+func (m *Module) updateLock(db, name string, fn func(txn *badger.Txn, key []byte, owner string) error) error {
+	if name == "" {
+		return errors.New("lock name must not be empty")
+	}
+
+	// sync to get the latest locks
+	dc, err := m.getDBClient(db)
+	if err != nil {
+		return err
+	}
+	if err := m.autoSync(db, dc); err != nil {
+		return err
+	}
+
+	// check and update in a transaction
+	key := []byte(lockKeyPrefix + name)
+	for i := 0; i < maxCounterRetries; i++ {
+		err = m.updateDB(db, func(txn *badger.Txn) error {
+			h := &txnHandle{txn: txn}
+			cur, err := h.getValue(key, false)
+			if err != nil {
+				return err
+			}
+			return fn(txn, key, string(cur))
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+		log.Debugw("retry lock update on conflict", "lock", name, "attempt", i+1)
+	}
+	return err
+}
+
+// acquireLock acquires the lock with expiry for the owner, it returns False if it's held by others.
+// The lock held by the same owner is renewed with the new expiry.
+func (m *Module) acquireLock(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name  tps.StringOrBytes
+		ttl   = tps.FloatOrInt(60)
+		owner tps.StringOrBytes
+		db    tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "ttl?", &ttl, "owner?", &owner, "db?", &db); err != nil {
+		return none, err
+	}
+	exp, err := parseTTL(ttl)
+	if err != nil {
+		return none, err
+	}
+	if exp <= 0 {
+		return none, fmt.Errorf("%s: ttl must be positive, got %v", b.Name(), ttl)
+	}
+	who := owner.GoString()
+	if who == "" {
+		who = defaultLockOwner()
+	}
+
+	// set the owner if it's free or held by the same owner
+	acquired := false
+	if err := m.updateLock(db.GoString(), name.GoString(), func(txn *badger.Txn, key []byte, cur string) error {
+		if acquired = cur == "" || cur == who; !acquired {
+			return ErrSkipCommit
+		}
+		return txn.SetEntry(badger.NewEntry(key, []byte(who)).WithTTL(exp))
+	}); err != nil {
+		return none, err
+	}
+	return starlark.Bool(acquired), nil
+}
+
+// releaseLock releases the lock held by the owner, it returns False if it's not held by the owner.
+func (m *Module) releaseLock(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name  tps.StringOrBytes
+		owner tps.StringOrBytes
+		db    tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "owner?", &owner, "db?", &db); err != nil {
+		return none, err
+	}
+	who := owner.GoString()
+	if who == "" {
+		who = defaultLockOwner()
+	}
+
+	// delete the key if it's held by the owner
+	released := false
+	if err := m.updateLock(db.GoString(), name.GoString(), func(txn *badger.Txn, key []byte, cur string) error {
+		if released = cur == who; !released {
+			return ErrSkipCommit
+		}
+		return txn.Delete(key)
+	}); err != nil {
+		return none, err
+	}
+	return starlark.Bool(released), nil
+}
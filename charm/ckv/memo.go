@@ -0,0 +1,65 @@
+package ckv
+
+import (
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// getOrSet returns the cached value of the key as JSON, or calls the Starlark callable to compute, store and return the value.
+// If the key is set by others while computing, the stored value wins and is returned, so all callers see the same value.
+func (m *Module) getOrSet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key tps.StringOrBytes
+		fn  starlark.Callable
+		ttl tps.FloatOrInt
+		db  tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "fn", &fn, "ttl?", &ttl, "db?", &db); err != nil {
+		return none, err
+	}
+	exp, err := parseTTL(ttl)
+	if err != nil {
+		return none, err
+	}
+
+	// return the cached value
+	vs, err := m.getValue(db.GoString(), key.GoBytes(), false)
+	if err != nil {
+		return none, err
+	}
+	if vs != nil {
+		return dataconv.DecodeStarlarkJSON(vs)
+	}
+
+	// compute the value
+	res, err := starlark.Call(thread, fn, nil, nil)
+	if err != nil {
+		return none, err
+	}
+	js, err := dataconv.EncodeStarlarkJSON(res)
+	if err != nil {
+		return none, err
+	}
+
+	// store it unless it's set by others meanwhile
+	var stored []byte
+	if err := m.updateDB(db.GoString(), func(txn *badger.Txn) error {
+		h := &txnHandle{txn: txn}
+		var err error
+		if stored, err = h.getValue(key.GoBytes(), false); err != nil {
+			return err
+		}
+		if stored != nil {
+			return ErrSkipCommit
+		}
+		return h.setValue(key.GoBytes(), []byte(js), exp)
+	}); err != nil {
+		return none, err
+	}
+	if stored != nil {
+		return dataconv.DecodeStarlarkJSON(stored)
+	}
+	return res, nil
+}
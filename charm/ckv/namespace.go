@@ -0,0 +1,149 @@
+package ckv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// namespace prefixes the keys with the path like "app/feature/", so scripts sharing the same database won't collide.
+type namespace struct {
+	m      *Module
+	db     string
+	prefix string
+}
+
+// newNamespacePrefix normalizes the namespace path to the key prefix ending with a slash.
+func newNamespacePrefix(name string) (string, error) {
+	name = strings.Trim(name, "/")
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("namespace must not be empty")
+	}
+	return name + "/", nil
+}
+
+func (m *Module) newNamespace(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name tps.StringOrBytes
+		db   tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "db?", &db); err != nil {
+		return none, err
+	}
+	prefix, err := newNamespacePrefix(name.GoString())
+	if err != nil {
+		return none, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return (&namespace{m: m, db: db.GoString(), prefix: prefix}).toStarlark(), nil
+}
+
+func (n *namespace) key(k tps.StringOrBytes) []byte {
+	return []byte(n.prefix + k.GoString())
+}
+
+// toStarlark returns the struct of bound functions working on the keys under the namespace.
+func (n *namespace) toStarlark() starlark.Value {
+	getArgs := func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) ([]byte, error) {
+		var (
+			key           tps.StringOrBytes
+			failOnMissing bool
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "fail_missing?", &failOnMissing); err != nil {
+			return nil, err
+		}
+		return n.m.getValue(n.db, n.key(key), failOnMissing)
+	}
+	setArgs := func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, encode func(starlark.Value) ([]byte, error)) error {
+		var (
+			key   tps.StringOrBytes
+			value starlark.Value
+			ttl   tps.FloatOrInt
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "ttl?", &ttl); err != nil {
+			return err
+		}
+		exp, err := parseTTL(ttl)
+		if err != nil {
+			return err
+		}
+		bs, err := encode(value)
+		if err != nil {
+			return err
+		}
+		return n.m.setValue(n.db, n.key(key), bs, exp)
+	}
+	listArgs := func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, lo listOptions) (starlark.Value, error) {
+		var (
+			sync    = true
+			reverse bool
+			limit   = 0
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "sync?", &sync, "reverse?", &reverse, "limit?", &limit); err != nil {
+			return none, err
+		}
+		lo.syncFirst, lo.reverse, lo.limit = sync, reverse, limit
+		lo.prefix, lo.trim = []byte(n.prefix), true
+		return n.m.listItems(n.db, lo)
+	}
+
+	fields := starlark.StringDict{
+		"prefix": starlark.String(n.prefix),
+		"get": starlark.NewBuiltin("ckv_ns.get", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			vs, err := getArgs(b, args, kwargs)
+			if err != nil {
+				return none, err
+			}
+			return starlark.String(vs), nil
+		}),
+		"get_json": starlark.NewBuiltin("ckv_ns.get_json", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			vs, err := getArgs(b, args, kwargs)
+			if err != nil || vs == nil {
+				return none, err
+			}
+			return dataconv.DecodeStarlarkJSON(vs)
+		}),
+		"set": starlark.NewBuiltin("ckv_ns.set", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return none, setArgs(b, args, kwargs, func(v starlark.Value) ([]byte, error) {
+				return []byte(dataconv.StarString(v)), nil
+			})
+		}),
+		"set_json": starlark.NewBuiltin("ckv_ns.set_json", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return none, setArgs(b, args, kwargs, func(v starlark.Value) ([]byte, error) {
+				js, err := dataconv.EncodeStarlarkJSON(v)
+				return []byte(js), err
+			})
+		}),
+		"delete": starlark.NewBuiltin("ckv_ns.delete", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key tps.StringOrBytes
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key); err != nil {
+				return none, err
+			}
+			return none, n.m.deleteValue(n.db, n.key(key))
+		}),
+		"list": starlark.NewBuiltin("ckv_ns.list", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return listArgs(b, args, kwargs, listOptions{})
+		}),
+		"list_keys": starlark.NewBuiltin("ckv_ns.list_keys", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return listArgs(b, args, kwargs, listOptions{keyOnly: true})
+		}),
+		"list_values": starlark.NewBuiltin("ckv_ns.list_values", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return listArgs(b, args, kwargs, listOptions{valueOnly: true})
+		}),
+		"ns": starlark.NewBuiltin("ckv_ns.ns", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var name tps.StringOrBytes
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name); err != nil {
+				return none, err
+			}
+			sub, err := newNamespacePrefix(name.GoString())
+			if err != nil {
+				return none, fmt.Errorf("%s: %w", b.Name(), err)
+			}
+			return (&namespace{m: n.m, db: n.db, prefix: n.prefix + sub}).toStarlark(), nil
+		}),
+	}
+	return starlarkstruct.FromStringDict(starlark.String("ckv_ns"), fields)
+}
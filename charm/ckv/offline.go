@@ -0,0 +1,35 @@
+package ckv
+
+import (
+	"github.com/charmbracelet/charm/kv"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// kvDirName returns the folder name of databases in the data path. The local databases of offline mode are kept apart,
+// since they're not encrypted with the Charm keys nor synced to Charm Cloud.
+func kvDirName(offline bool) string {
+	if offline {
+		return "kv-local"
+	}
+	return "kv"
+}
+
+// openLocalDB opens the Badger database directly without Charm client, it's in managed mode like the Charm ones,
+// so the reads, streams and subscriptions work the same way.
+func openLocalDB(opts badger.Options) (*kv.KV, error) {
+	db, err := badger.OpenManaged(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &kv.KV{DB: db}, nil
+}
+
+// newLocalTxn creates an update transaction of the local database, reading at the latest version.
+func newLocalTxn(dc *kv.KV) *badger.Txn {
+	return dc.DB.NewTransactionAt(dc.DB.MaxVersion(), true)
+}
+
+// commitLocalTxn commits the transaction of the local database at the next version.
+func commitLocalTxn(dc *kv.KV, txn *badger.Txn) error {
+	return txn.CommitAt(dc.DB.MaxVersion()+1, nil)
+}
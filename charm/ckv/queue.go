@@ -0,0 +1,139 @@
+package ckv
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// queueKeyPrefix is the prefix of keys holding the queued items, to keep them apart from the user keys.
+const queueKeyPrefix = "__ckv_queue__/"
+
+// queuePrefix returns the key prefix of items in the queue.
+func queuePrefix(queue string) ([]byte, error) {
+	if queue == "" {
+		return nil, errors.New("queue name must not be empty")
+	}
+	return []byte(queueKeyPrefix + queue + "/"), nil
+}
+
+// newQueueKey returns the key of the new item in the queue, which is ordered by the time in nanoseconds,
+// with the random suffix to avoid collisions of items pushed by different devices at the same time.
+func newQueueKey(prefix []byte) ([]byte, error) {
+	b := make([]byte, 4)
+	if err := base.RandRead(b); err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s%020d-%s", prefix, base.Now().UnixNano(), hex.EncodeToString(b))), nil
+}
+
+// firstQueueItem returns the key and value of the oldest item in the queue, or nil key if the queue is empty.
+func firstQueueItem(txn *badger.Txn, prefix []byte) ([]byte, []byte, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = 1
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	if it.Seek(prefix); !it.ValidForPrefix(prefix) {
+		return nil, nil, nil
+	}
+	item := it.Item()
+	v, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item.KeyCopy(nil), v, nil
+}
+
+func (m *Module) pushQueue(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		queue tps.StringOrBytes
+		value starlark.Value
+		db    tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "queue", &queue, "value", &value, "db?", &db); err != nil {
+		return none, err
+	}
+	prefix, err := queuePrefix(queue.GoString())
+	if err != nil {
+		return none, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+
+	// store the value as JSON to keep its type
+	js, err := dataconv.EncodeStarlarkJSON(value)
+	if err != nil {
+		return none, err
+	}
+	key, err := newQueueKey(prefix)
+	if err != nil {
+		return none, err
+	}
+	return none, m.setValue(db.GoString(), key, []byte(js), 0)
+}
+
+// genQueueFunc generates the Starlark callable function to return the oldest item in the queue, and remove it if pop is set.
+// It returns None if the queue is empty.
+func (m *Module) genQueueFunc(pop bool) func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			queue tps.StringOrBytes
+			db    tps.StringOrBytes
+			sync  = true
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "queue", &queue, "db?", &db, "sync?", &sync); err != nil {
+			return none, err
+		}
+		prefix, err := queuePrefix(queue.GoString())
+		if err != nil {
+			return none, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+
+		// sync to get the items pushed by other devices
+		dc, err := m.getDBClient(db.GoString())
+		if err != nil {
+			return none, err
+		}
+		if sync {
+			if err := m.autoSync(db.GoString(), dc); err != nil {
+				return none, err
+			}
+		}
+
+		// read the oldest item
+		var val []byte
+		if !pop {
+			err = dc.View(func(txn *badger.Txn) error {
+				_, val, err = firstQueueItem(txn, prefix)
+				return err
+			})
+		} else {
+			// read and remove in a transaction, and retry on conflicts with other consumers
+			for i := 0; i < maxCounterRetries; i++ {
+				err = m.updateDB(db.GoString(), func(txn *badger.Txn) error {
+					var key []byte
+					if key, val, err = firstQueueItem(txn, prefix); err != nil {
+						return err
+					}
+					if key == nil {
+						return ErrSkipCommit
+					}
+					return txn.Delete(key)
+				})
+				if !errors.Is(err, badger.ErrConflict) {
+					break
+				}
+				log.Debugw("retry queue pop on conflict", "queue", queue.GoString(), "attempt", i+1)
+			}
+		}
+		if err != nil || val == nil {
+			return none, err
+		}
+		return dataconv.DecodeStarlarkJSON(val)
+	}
+}
@@ -0,0 +1,69 @@
+package ckv
+
+import (
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// scanItems calls the Starlark callable with the key and value of each item during iteration without building a list,
+// the iteration stops early if the callable returns False. It returns the number of items visited.
+func (m *Module) scanItems(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		fn      starlark.Callable
+		db      tps.StringOrBytes
+		prefix  tps.StringOrBytes
+		sync    = true
+		reverse bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fn", &fn, "db?", &db, "prefix?", &prefix, "sync?", &sync, "reverse?", &reverse); err != nil {
+		return none, err
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// sync before scanning
+	if sync {
+		if err := m.autoSync(db.GoString(), dc); err != nil {
+			return none, err
+		}
+	}
+
+	// iterate and call
+	var (
+		cnt = 0
+		lo  = listOptions{reverse: reverse, prefix: prefix.GoBytes()}
+	)
+	if err := dc.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 10
+		opts.Reverse = lo.reverse
+		opts.Prefix = lo.prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(lo.seekKey()); it.ValidForPrefix(lo.prefix); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			cnt++
+			res, err := starlark.Call(thread, fn, starlark.Tuple{starlark.String(item.Key()), starlark.String(v)}, nil)
+			if err != nil {
+				return err
+			}
+			if res == starlark.False {
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		return none, err
+	}
+	return starlark.MakeInt(cnt), nil
+}
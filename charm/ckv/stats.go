@@ -0,0 +1,104 @@
+package ckv
+
+import (
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/charm/core"
+	startime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+// getStats returns the statistics of the database, including the disk usage, the estimated number of keys,
+// and the last time of syncing with Charm Cloud in this session, or None if it's never synced.
+func (m *Module) getStats(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var db tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// get db client
+	name := dbName(db.GoString())
+	dc, err := m.getDBClient(name)
+	if err != nil {
+		return none, err
+	}
+
+	// collect the statistics, the key count is estimated from the LSM tables, which may include the old versions and deleted keys
+	lsm, vlog, err := diskUsage(dc.DB)
+	if err != nil {
+		return none, err
+	}
+	mu := m.dbLock(name)
+	mu.Lock()
+	maxVersion := dc.DB.MaxVersion()
+	mu.Unlock()
+	var keys uint64
+	for _, ti := range dc.DB.Tables() {
+		keys += uint64(ti.KeyCount)
+	}
+	var lastSync starlark.Value = none
+	m.mu.Lock()
+	t, synced := m.synced[name]
+	readOnly, local := m.readOnly[name], m.local[name]
+	m.mu.Unlock()
+	if synced {
+		lastSync = startime.Time(t)
+	}
+
+	res := starlark.NewDict(8)
+	_ = res.SetKey(starlark.String("name"), starlark.String(name))
+	_ = res.SetKey(starlark.String("lsm_size"), starlark.MakeInt64(lsm))
+	_ = res.SetKey(starlark.String("vlog_size"), starlark.MakeInt64(vlog))
+	_ = res.SetKey(starlark.String("key_count"), starlark.MakeUint64(keys))
+	_ = res.SetKey(starlark.String("max_version"), starlark.MakeUint64(maxVersion))
+	_ = res.SetKey(starlark.String("last_sync"), lastSync)
+	_ = res.SetKey(starlark.String("read_only"), starlark.Bool(readOnly))
+	_ = res.SetKey(starlark.String("offline"), starlark.Bool(local))
+	return res, nil
+}
+
+// getSyncStatus returns the latest sequence numbers of the local copy and Charm Cloud, and whether the local copy is behind,
+// so scripts can sync only when it's needed.
+func (m *Module) getSyncStatus(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var db tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "db?", &db); err != nil {
+		return none, err
+	}
+	if m.IsOffline() {
+		return none, core.ErrOffline
+	}
+
+	// get db client
+	name := dbName(db.GoString())
+	dc, err := m.getDBClient(name)
+	if err != nil {
+		return none, err
+	}
+
+	// the read timestamp of the update transaction is the latest sequence number in Charm Cloud
+	txn, err := dc.NewTransaction(true)
+	if err != nil {
+		return none, err
+	}
+	remote := txn.ReadTs()
+	txn.Discard()
+	mu := m.dbLock(name)
+	mu.Lock()
+	local := dc.DB.MaxVersion()
+	mu.Unlock()
+
+	var lastSync starlark.Value = none
+	m.mu.Lock()
+	t, synced := m.synced[name]
+	m.mu.Unlock()
+	if synced {
+		lastSync = startime.Time(t)
+	}
+
+	res := starlark.NewDict(5)
+	_ = res.SetKey(starlark.String("name"), starlark.String(name))
+	_ = res.SetKey(starlark.String("local_seq"), starlark.MakeUint64(local))
+	_ = res.SetKey(starlark.String("remote_seq"), starlark.MakeUint64(remote))
+	_ = res.SetKey(starlark.String("behind"), starlark.Bool(remote > local))
+	_ = res.SetKey(starlark.String("last_sync"), lastSync)
+	return res, nil
+}
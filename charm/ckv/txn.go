@@ -0,0 +1,200 @@
+package ckv
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// txnHandle wraps the Badger transaction for the Starlark callable of ckv.txn, it's closed after the callable returns.
+type txnHandle struct {
+	txn     *badger.Txn
+	closed  bool
+	written bool
+}
+
+func (h *txnHandle) check(name string) error {
+	if h.closed {
+		return fmt.Errorf("%s: transaction is already closed", name)
+	}
+	return nil
+}
+
+func (h *txnHandle) getValue(key []byte, failOnMissing bool) ([]byte, error) {
+	item, err := h.txn.Get(key)
+	if err != nil {
+		if !failOnMissing && errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (h *txnHandle) setValue(key, value []byte, ttl time.Duration) error {
+	e := badger.NewEntry(key, value)
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
+	h.written = true
+	return h.txn.SetEntry(e)
+}
+
+// toStarlark returns the struct of bound functions to read and write in the transaction.
+func (h *txnHandle) toStarlark() starlark.Value {
+	getArgs := func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) ([]byte, error) {
+		var (
+			key           tps.StringOrBytes
+			failOnMissing bool
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "fail_missing?", &failOnMissing); err != nil {
+			return nil, err
+		}
+		if err := h.check(b.Name()); err != nil {
+			return nil, err
+		}
+		return h.getValue(key.GoBytes(), failOnMissing)
+	}
+	setArgs := func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, encode func(starlark.Value) ([]byte, error)) error {
+		var (
+			key   tps.StringOrBytes
+			value starlark.Value
+			ttl   tps.FloatOrInt
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value, "ttl?", &ttl); err != nil {
+			return err
+		}
+		if err := h.check(b.Name()); err != nil {
+			return err
+		}
+		exp, err := parseTTL(ttl)
+		if err != nil {
+			return err
+		}
+		bs, err := encode(value)
+		if err != nil {
+			return err
+		}
+		return h.setValue(key.GoBytes(), bs, exp)
+	}
+
+	fields := starlark.StringDict{
+		"get": starlark.NewBuiltin("ckv_txn.get", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			vs, err := getArgs(b, args, kwargs)
+			if err != nil {
+				return none, err
+			}
+			return starlark.String(vs), nil
+		}),
+		"get_json": starlark.NewBuiltin("ckv_txn.get_json", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			vs, err := getArgs(b, args, kwargs)
+			if err != nil || vs == nil {
+				return none, err
+			}
+			return dataconv.DecodeStarlarkJSON(vs)
+		}),
+		"set": starlark.NewBuiltin("ckv_txn.set", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return none, setArgs(b, args, kwargs, func(v starlark.Value) ([]byte, error) {
+				return []byte(dataconv.StarString(v)), nil
+			})
+		}),
+		"set_json": starlark.NewBuiltin("ckv_txn.set_json", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return none, setArgs(b, args, kwargs, func(v starlark.Value) ([]byte, error) {
+				js, err := dataconv.EncodeStarlarkJSON(v)
+				return []byte(js), err
+			})
+		}),
+		"delete": starlark.NewBuiltin("ckv_txn.delete", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key tps.StringOrBytes
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key); err != nil {
+				return none, err
+			}
+			if err := h.check(b.Name()); err != nil {
+				return none, err
+			}
+			h.written = true
+			return none, h.txn.Delete(key.GoBytes())
+		}),
+	}
+	return starlarkstruct.FromStringDict(starlark.String("ckv_txn"), fields)
+}
+
+// runTxn calls the Starlark callable with a transactional handle, and commits the writes atomically after it returns.
+// Nothing is written if the callable fails, or the transaction conflicts with others.
+func (m *Module) runTxn(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		fn starlark.Callable
+		db tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fn", &fn, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// run the callable in the transaction
+	var res starlark.Value
+	err := m.updateDB(db.GoString(), func(txn *badger.Txn) error {
+		h := &txnHandle{txn: txn}
+		defer func() { h.closed = true }()
+		var err error
+		if res, err = starlark.Call(thread, fn, starlark.Tuple{h.toStarlark()}, nil); err != nil {
+			return err
+		}
+		if !h.written {
+			return ErrSkipCommit
+		}
+		return nil
+	})
+	if err != nil {
+		return none, err
+	}
+	return res, nil
+}
+
+func (m *Module) compareAndSwap(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key    tps.StringOrBytes
+		oldVal starlark.Value
+		newVal starlark.Value
+		db     tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "old", &oldVal, "new", &newVal, "db?", &db); err != nil {
+		return none, err
+	}
+
+	// compare the string representations, None for the missing key, and retry on transaction conflicts
+	var (
+		swapped bool
+		err     error
+	)
+	for i := 0; i < maxCounterRetries; i++ {
+		err = m.updateDB(db.GoString(), func(txn *badger.Txn) error {
+			h := &txnHandle{txn: txn}
+			cur, err := h.getValue(key.GoBytes(), false)
+			if err != nil {
+				return err
+			}
+			if oldVal == none {
+				swapped = cur == nil
+			} else {
+				swapped = cur != nil && string(cur) == dataconv.StarString(oldVal)
+			}
+			if !swapped {
+				return ErrSkipCommit
+			}
+			return txn.Set(key.GoBytes(), []byte(dataconv.StarString(newVal)))
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return none, err
+	}
+	return starlark.Bool(swapped), nil
+}
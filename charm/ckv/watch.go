@@ -0,0 +1,103 @@
+package ckv
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/charm/core"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+	"go.starlark.net/starlark"
+)
+
+// watchKeys calls the Starlark callable with the key and value for each change of the keys with the prefix, including the changes
+// from other devices restored by syncing. The value of a deleted key is empty. It stops when the callable returns False, or timeout.
+// If interval is set, the database is synced periodically to receive the remote changes. It returns the number of changes handled.
+func (m *Module) watchKeys(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		prefix   tps.StringOrBytes
+		callback starlark.Callable
+		timeout  tps.FloatOrInt
+		interval tps.FloatOrInt
+		db       tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "prefix", &prefix, "callback", &callback, "timeout?", &timeout, "interval?", &interval, "db?", &db); err != nil {
+		return none, err
+	}
+
+	if interval > 0 {
+		if m.IsOffline() {
+			return none, core.ErrOffline
+		}
+		if err := m.checkWritable(db.GoString()); err != nil {
+			return none, err
+		}
+	}
+
+	// get db client
+	dc, err := m.getDBClient(db.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// subscribe in background until done, the changes are passed to the thread of the callable
+	ctx, cancel := context.WithCancel(dataconv.GetThreadContext(thread))
+	defer cancel()
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(timeout.GoFloat64()*float64(time.Second)))
+		defer cancelTimeout()
+	}
+	var (
+		changes = make(chan *pb.KV, 64)
+		subErr  = make(chan error, 1)
+	)
+	go func() {
+		subErr <- dc.DB.Subscribe(ctx, func(l *badger.KVList) error {
+			for _, kv := range l.Kv {
+				select {
+				case changes <- kv:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		}, []pb.Match{{Prefix: prefix.GoBytes()}})
+	}()
+
+	// sync periodically if required
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(time.Duration(interval.GoFloat64() * float64(time.Second)))
+		defer t.Stop()
+		tick = t.C
+	}
+
+	// handle the changes until stopped
+	cnt := 0
+	for {
+		select {
+		case kv := <-changes:
+			cnt++
+			res, err := starlark.Call(thread, callback, starlark.Tuple{starlark.String(kv.Key), starlark.String(kv.Value)}, nil)
+			if err != nil {
+				return none, err
+			}
+			if res == starlark.False {
+				return starlark.MakeInt(cnt), nil
+			}
+		case <-tick:
+			if err := m.syncWith(db.GoString(), dc); err != nil {
+				return none, err
+			}
+		case err := <-subErr:
+			if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+				return none, err
+			}
+			return starlark.MakeInt(cnt), nil
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -45,19 +46,64 @@ func NewCommonModuleWithGetter(host, dataDirPath, keyFilePath, sshPort, httpPort
 	return &CommonModule{cfgMod: cm}
 }
 
-// ExtendModuleLoader extends the module loader with given name and additional functions.
-func (m *CommonModule) ExtendModuleLoader(name string, addons starlark.StringDict) starlet.ModuleLoader {
+// ExtendModuleLoader extends the module loader with given name and additional functions, params lists the parameter names of the functions.
+func (m *CommonModule) ExtendModuleLoader(name string, addons starlark.StringDict, params map[string][]string) starlet.ModuleLoader {
 	commonFuncs := starlark.StringDict{
 		"get_config": starlark.NewBuiltin("charm.get_config", m.getConfig),
 	}
 	for k, v := range addons {
 		commonFuncs[k] = v
 	}
-	return m.cfgMod.LoadModule(name, commonFuncs)
+	return m.cfgMod.LoadModule(name, commonFuncs, params)
 }
 
-// InitializeClient creates a new Charm API client with the given configuration values.
+// SetDefaultKwarg sets the default value of the keyword argument for the function, e.g. db for the ckv functions. Nil value removes the default.
+func (m *CommonModule) SetDefaultKwarg(funcName, argName string, value starlark.Value) {
+	m.cfgMod.SetDefaultKwarg(funcName, argName, value)
+}
+
+// ErrOffline is returned for the operations requiring Charm Cloud in offline mode.
+var ErrOffline = errors.New("offline mode: Charm Cloud is not available")
+
+// SetOffline sets whether to work without connecting to Charm Cloud, e.g. on airplanes or in CI where the Charm host is unreachable.
+func (m *CommonModule) SetOffline(offline bool) {
+	m.cfgMod.SetConfigValue("offline", strconv.FormatBool(offline))
+}
+
+// IsOffline returns true if the module is set to work without connecting to Charm Cloud.
+func (m *CommonModule) IsOffline() bool {
+	v, err := m.cfgMod.GetConfig("offline")
+	if err != nil {
+		return false
+	}
+	offline, _ := strconv.ParseBool(v)
+	return offline
+}
+
+// InitializeClient creates a new Charm API client with the given configuration values. It fails with ErrOffline in offline mode.
 func (m *CommonModule) InitializeClient() (*cmcli.Client, error) {
+	if m.IsOffline() {
+		return nil, ErrOffline
+	}
+	cfg, err := m.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	// create a new client
+	return cmcli.NewClient(cfg)
+}
+
+// DataPath returns the local data path of Charm without creating the client, so it works in offline mode.
+func (m *CommonModule) DataPath() (string, error) {
+	cfg, err := m.loadConfig()
+	if err != nil {
+		return "", err
+	}
+	return (&cmcli.Client{Config: cfg}).DataPath()
+}
+
+// loadConfig returns the Charm client configuration from environment variables and the module configuration values.
+func (m *CommonModule) loadConfig() (*cmcli.Config, error) {
 	// get default configuration from environment variables
 	cfg, err := cmcli.ConfigFromEnv()
 	if err != nil {
@@ -85,8 +131,7 @@ func (m *CommonModule) InitializeClient() (*cmcli.Client, error) {
 			return nil, fmt.Errorf("invalid HTTP port: %w", err)
 		}
 	}
-	// create a new client
-	return cmcli.NewClient(cfg)
+	return cfg, nil
 }
 
 var (
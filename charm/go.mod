@@ -5,9 +5,10 @@ go 1.18
 require (
 	bitbucket.org/neiku/hlog v0.1.2
 	github.com/1set/starlet v0.1.3-0.20240812175751-6f896086c469
-	github.com/PureMature/starport/base v0.0.4
+	github.com/PureMature/starport/base v0.0.5
 	github.com/charmbracelet/charm v0.12.7-0.20240611121908-2785ee19555c
 	github.com/dgraph-io/badger/v3 v3.2103.2
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 	go.starlark.net v0.0.0-20240123142251-f86470692795
 	go.uber.org/zap v1.24.0
 )
@@ -57,6 +58,7 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.4.6 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	go.opencensus.io v0.22.5 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.9.0 // indirect
@@ -69,3 +71,5 @@ require (
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
+
+replace github.com/PureMature/starport/base => ../base
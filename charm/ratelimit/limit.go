@@ -0,0 +1,213 @@
+// Package ratelimit provides a Starlark module for fixed-window rate limiting, with counters stored in Charm KV.
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/1set/starlet"
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"github.com/PureMature/starport/charm/ckv"
+	"github.com/dgraph-io/badger/v3"
+	"go.starlark.net/starlark"
+)
+
+// ModuleName defines the expected name for this module when used in Starlark's load() function, e.g., load('ratelimit', 'allow')
+const ModuleName = "ratelimit"
+
+// Module provides rate limiting functions, the counters are stored in the given Charm KV module and shared by all runners of the Charm account.
+type Module struct {
+	store *ckv.Module
+	mu    sync.Mutex
+}
+
+// NewModule creates a new instance of Module with the Charm KV module as the counter storage.
+func NewModule(store *ckv.Module) *Module {
+	return &Module{store: store}
+}
+
+// LoadModule returns the Starlark module loader with the ratelimit-specific functions.
+func (m *Module) LoadModule() starlet.ModuleLoader {
+	sd := starlark.StringDict{
+		"allow":     starlark.NewBuiltin(ModuleName+".allow", m.allow),
+		"remaining": starlark.NewBuiltin(ModuleName+".remaining", m.remaining),
+		"reset":     starlark.NewBuiltin(ModuleName+".reset", m.reset),
+	}
+	return dataconv.WrapModuleData(ModuleName, sd)
+}
+
+var (
+	none         = starlark.None
+	limitDB      = "starport.ratelimit"
+	limitPrefix  = "limit/"
+	errBadWindow = errors.New("window must be positive seconds or a duration string like \"24h\"")
+)
+
+// counter is the stored state of a rate limiter key in the current window.
+type counter struct {
+	Start int64 `json:"start"`
+	Count int   `json:"count"`
+}
+
+// parseWindow converts the number of seconds or the duration string to time.Duration.
+func parseWindow(v starlark.Value) (time.Duration, error) {
+	var d time.Duration
+	switch w := v.(type) {
+	case starlark.Int, starlark.Float:
+		var sec tps.FloatOrInt
+		if err := sec.Unpack(w); err != nil {
+			return 0, err
+		}
+		d = time.Duration(sec.GoFloat64() * float64(time.Second))
+	case starlark.String:
+		pd, err := time.ParseDuration(string(w))
+		if err != nil {
+			return 0, errBadWindow
+		}
+		d = pd
+	default:
+		return 0, errBadWindow
+	}
+	if d <= 0 {
+		return 0, errBadWindow
+	}
+	return d, nil
+}
+
+// unpackLimit unpacks the common arguments of key, limit and window.
+func unpackLimit(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (string, int, time.Duration, error) {
+	var (
+		key    tps.StringOrBytes
+		limit  int
+		window starlark.Value
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "limit", &limit, "window", &window); err != nil {
+		return "", 0, 0, err
+	}
+	if key.IsEmpty() {
+		return "", 0, 0, errors.New("key must be non-empty")
+	}
+	if limit <= 0 {
+		return "", 0, 0, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	w, err := parseWindow(window)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return key.GoString(), limit, w, nil
+}
+
+func (m *Module) allow(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	key, limit, window, err := unpackLimit(b, args, kwargs)
+	if err != nil {
+		return none, err
+	}
+	ok, err := m.increase(key, limit, window)
+	if err != nil {
+		return none, err
+	}
+	return starlark.Bool(ok), nil
+}
+
+func (m *Module) remaining(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	key, limit, window, err := unpackLimit(b, args, kwargs)
+	if err != nil {
+		return none, err
+	}
+
+	// count of the current window
+	cnt := 0
+	err = m.store.View(limitDB, func(txn *badger.Txn) error {
+		c, err := loadCounter(txn, key, windowStart(window))
+		cnt = c.Count
+		return err
+	})
+	if err != nil {
+		return none, err
+	}
+	if left := limit - cnt; left > 0 {
+		return starlark.MakeInt(left), nil
+	}
+	return starlark.MakeInt(0), nil
+}
+
+func (m *Module) reset(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key); err != nil {
+		return none, err
+	}
+	if err := m.store.Delete(limitDB, limitPrefix+key.GoString()); err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return none, err
+	}
+	return none, nil
+}
+
+// windowStart returns the start time of the current fixed window.
+func windowStart(window time.Duration) time.Time {
+	return base.Now().Truncate(window)
+}
+
+// loadCounter loads the counter of the key in the transaction, the counter of a previous window is treated as empty.
+func loadCounter(txn *badger.Txn, key string, start time.Time) (counter, error) {
+	c := counter{Start: start.Unix()}
+	item, err := txn.Get([]byte(limitPrefix + key))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return c, nil
+		}
+		return c, err
+	}
+	var stored counter
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &stored)
+	}); err != nil {
+		return c, err
+	}
+	if stored.Start == c.Start {
+		c.Count = stored.Count
+	}
+	return c, nil
+}
+
+// increase increases the counter of the key if it's under the limit in the current window, and reports whether it's increased.
+// The read and write are in one transaction after syncing with Charm Cloud, and retried on conflicts.
+func (m *Module) increase(key string, limit int, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ok bool
+	err := m.store.Update(limitDB, func(txn *badger.Txn) error {
+		// check the counter of current window
+		ok = false
+		start := windowStart(window)
+		c, err := loadCounter(txn, key, start)
+		if err != nil {
+			return err
+		}
+		if c.Count >= limit {
+			return ckv.ErrSkipCommit
+		}
+
+		// increase and save with TTL till the end of window
+		c.Count++
+		bs, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		e := badger.NewEntry([]byte(limitPrefix+key), bs).WithTTL(start.Add(window).Sub(base.Now()))
+		if err := txn.SetEntry(e); err != nil {
+			return err
+		}
+		ok = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
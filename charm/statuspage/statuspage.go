@@ -0,0 +1,315 @@
+// Package statuspage provides a Starlark module that reads public status pages, and publishes incidents to a self-hosted status page stored in Charm FS.
+package statuspage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	gofs "io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet"
+	"github.com/1set/starlet/dataconv"
+	tps "github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"github.com/PureMature/starport/charm/cfs"
+	"go.starlark.net/starlark"
+)
+
+// ModuleName defines the expected name for this module when used in Starlark's load() function, e.g., load('statuspage', 'fetch')
+const ModuleName = "statuspage"
+
+// Module provides status page functions, the self-hosted pages are stored with the given Charm FS module.
+type Module struct {
+	store *cfs.Module
+	hc    *http.Client
+}
+
+// NewModule creates a new instance of Module with the Charm FS module as the page storage.
+func NewModule(store *cfs.Module) *Module {
+	return &Module{
+		store: store,
+		hc:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// LoadModule returns the Starlark module loader with the status page functions.
+func (m *Module) LoadModule() starlet.ModuleLoader {
+	sd := starlark.StringDict{
+		"fetch":           starlark.NewBuiltin(ModuleName+".fetch", m.fetchStatus),
+		"get_page":        starlark.NewBuiltin(ModuleName+".get_page", m.getPage),
+		"open_incident":   starlark.NewBuiltin(ModuleName+".open_incident", m.openIncident),
+		"update_incident": starlark.NewBuiltin(ModuleName+".update_incident", m.updateIncident),
+	}
+	return dataconv.WrapModuleData(ModuleName, sd)
+}
+
+var (
+	none = starlark.None
+	// knownPages maps the names of well-known Statuspage.io pages to their URLs.
+	knownPages = map[string]string{
+		"github":     "https://www.githubstatus.com",
+		"openai":     "https://status.openai.com",
+		"cloudflare": "https://www.cloudflarestatus.com",
+		"discord":    "https://discordstatus.com",
+		"atlassian":  "https://status.atlassian.com",
+	}
+	pageDir          = "statuspage"
+	incidentStatuses = []string{"investigating", "identified", "monitoring", "resolved"}
+)
+
+// summary is the subset of Statuspage.io summary API response.
+type summary struct {
+	Page struct {
+		Name      string `json:"name"`
+		URL       string `json:"url"`
+		UpdatedAt string `json:"updated_at"`
+	} `json:"page"`
+	Status struct {
+		Indicator   string `json:"indicator"`
+		Description string `json:"description"`
+	} `json:"status"`
+	Components []struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	} `json:"components"`
+	Incidents []struct {
+		Name      string `json:"name"`
+		Status    string `json:"status"`
+		Impact    string `json:"impact"`
+		Shortlink string `json:"shortlink"`
+		CreatedAt string `json:"created_at"`
+		UpdatedAt string `json:"updated_at"`
+	} `json:"incidents"`
+}
+
+func (m *Module) fetchStatus(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var page tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "page", &page); err != nil {
+		return none, err
+	}
+
+	// resolve the API URL
+	pageURL := page.GoString()
+	if u, ok := knownPages[strings.ToLower(pageURL)]; ok {
+		pageURL = u
+	}
+	if !strings.HasPrefix(pageURL, "http://") && !strings.HasPrefix(pageURL, "https://") {
+		return none, fmt.Errorf("unknown status page: %s", pageURL)
+	}
+	apiURL := strings.TrimRight(pageURL, "/") + "/api/v2/summary.json"
+
+	// request the summary
+	req, err := http.NewRequestWithContext(dataconv.GetThreadContext(thread), http.MethodGet, apiURL, nil)
+	if err != nil {
+		return none, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := m.hc.Do(req)
+	if err != nil {
+		return none, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return none, fmt.Errorf("status page %s: unexpected status %s", apiURL, resp.Status)
+	}
+	var sum summary
+	if err := json.NewDecoder(resp.Body).Decode(&sum); err != nil {
+		return none, err
+	}
+	return dataconv.GoToStarlarkViaJSON(sum)
+}
+
+// pageData is the self-hosted status page stored in Charm FS.
+type pageData struct {
+	Name      string      `json:"name"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Incidents []*incident `json:"incidents"`
+}
+
+// incident is an incident on the self-hosted status page.
+type incident struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Status     string            `json:"status"`
+	Impact     string            `json:"impact"`
+	Components []string          `json:"components"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+	Updates    []*incidentUpdate `json:"updates"`
+}
+
+// incidentUpdate is a status update of an incident.
+type incidentUpdate struct {
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// pagePath returns the path of the page file in Charm FS.
+func pagePath(name string) string {
+	return pageDir + "/" + name + ".json"
+}
+
+// loadPage reads the page from Charm FS, and returns an empty page if not found.
+func (m *Module) loadPage(name string) (*pageData, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid page name: %q", name)
+	}
+	cf, err := m.store.Client()
+	if err != nil {
+		return nil, err
+	}
+	f, err := cf.Open(pagePath(name))
+	if err != nil {
+		if errors.Is(err, gofs.ErrNotExist) {
+			return &pageData{Name: name}, nil
+		}
+		return nil, err
+	}
+	defer f.Close() // nolint:errcheck
+
+	bs, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var pd pageData
+	if err := json.Unmarshal(bs, &pd); err != nil {
+		return nil, err
+	}
+	return &pd, nil
+}
+
+// savePage writes the page to Charm FS.
+func (m *Module) savePage(pd *pageData) error {
+	cf, err := m.store.Client()
+	if err != nil {
+		return err
+	}
+	pd.UpdatedAt = base.Now().UTC()
+	bs, err := json.MarshalIndent(pd, "", "  ")
+	if err != nil {
+		return err
+	}
+	fp := pagePath(pd.Name)
+	return cf.WriteFile(fp, cfs.CreateVirtualFile(fp, bs))
+}
+
+func (m *Module) getPage(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var page tps.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "page", &page); err != nil {
+		return none, err
+	}
+
+	pd, err := m.loadPage(page.GoString())
+	if err != nil {
+		return none, err
+	}
+	return dataconv.GoToStarlarkViaJSON(pd)
+}
+
+func (m *Module) openIncident(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		page       tps.StringOrBytes
+		title      tps.StringOrBytes
+		message    tps.StringOrBytes
+		impact     = tps.NewNullableStringOrBytes("minor")
+		components = tps.NewOneOrManyNoDefault[starlark.String]()
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "page", &page, "title", &title, "message?", &message, "impact?", impact, "components?", components); err != nil {
+		return none, err
+	}
+	if title.IsEmpty() {
+		return none, errors.New("title must be non-empty")
+	}
+
+	// load the page
+	pd, err := m.loadPage(page.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// add the incident
+	idb := make([]byte, 6)
+	if err := base.RandRead(idb); err != nil {
+		return none, err
+	}
+	now := base.Now().UTC()
+	inc := &incident{
+		ID:        hex.EncodeToString(idb),
+		Title:     title.GoString(),
+		Status:    incidentStatuses[0],
+		Impact:    impact.GoString(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Updates: []*incidentUpdate{
+			{Status: incidentStatuses[0], Message: message.GoString(), CreatedAt: now},
+		},
+	}
+	for _, c := range components.Slice() {
+		inc.Components = append(inc.Components, c.GoString())
+	}
+	pd.Incidents = append(pd.Incidents, inc)
+
+	// save the page
+	if err := m.savePage(pd); err != nil {
+		return none, err
+	}
+	return starlark.String(inc.ID), nil
+}
+
+func (m *Module) updateIncident(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		page    tps.StringOrBytes
+		id      tps.StringOrBytes
+		status  tps.StringOrBytes
+		message tps.StringOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "page", &page, "id", &id, "status", &status, "message?", &message); err != nil {
+		return none, err
+	}
+
+	// check the status
+	st := strings.ToLower(status.GoString())
+	valid := false
+	for _, s := range incidentStatuses {
+		if s == st {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return none, fmt.Errorf("invalid status %q, want one of %s", st, strings.Join(incidentStatuses, ", "))
+	}
+
+	// find the incident
+	pd, err := m.loadPage(page.GoString())
+	if err != nil {
+		return none, err
+	}
+	var inc *incident
+	for _, i := range pd.Incidents {
+		if i.ID == id.GoString() {
+			inc = i
+			break
+		}
+	}
+	if inc == nil {
+		return none, fmt.Errorf("incident not found: %s", id.GoString())
+	}
+
+	// update and save
+	now := base.Now().UTC()
+	inc.Status = st
+	inc.UpdatedAt = now
+	if st == "resolved" {
+		inc.ResolvedAt = &now
+	}
+	inc.Updates = append(inc.Updates, &incidentUpdate{Status: st, Message: message.GoString(), CreatedAt: now})
+	return none, m.savePage(pd)
+}
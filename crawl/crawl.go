@@ -0,0 +1,440 @@
+// Package crawl provides a Starlark module that crawls websites via sitemaps, respecting robots.txt and rate limits.
+package crawl
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet"
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// ModuleName defines the expected name for this module when used in Starlark's load() function, e.g., load('crawl', 'run')
+const ModuleName = "crawl"
+
+// Module wraps the ConfigurableModule with specific functionality for crawling websites.
+type Module struct {
+	cfgMod *base.ConfigurableModule[string]
+}
+
+// NewModule creates a new instance of Module.
+func NewModule() *Module {
+	cm := base.NewConfigurableModule[string]()
+	return &Module{cfgMod: cm}
+}
+
+// NewModuleWithConfig creates a new instance of Module with the given configuration values.
+func NewModuleWithConfig(userAgent string) *Module {
+	cm := base.NewConfigurableModule[string]()
+	cm.SetConfigValue("user_agent", userAgent)
+	return &Module{cfgMod: cm}
+}
+
+// NewModuleWithGetter creates a new instance of Module with the given configuration getters.
+func NewModuleWithGetter(userAgent base.ConfigGetter[string]) *Module {
+	cm := base.NewConfigurableModule[string]()
+	cm.SetConfig("user_agent", userAgent)
+	return &Module{cfgMod: cm}
+}
+
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"allowed": {"url"},
+	"sitemap": {"url", "limit", "delay"},
+	"run":     {"start", "callback", "max_pages", "delay", "same_host", "use_sitemap", "follow_links"},
+}
+
+// LoadModule returns the Starlark module loader with the crawl-specific functions.
+func (m *Module) LoadModule() starlet.ModuleLoader {
+	additionalFuncs := starlark.StringDict{
+		"allowed": starlark.NewBuiltin(ModuleName+".allowed", m.robotsAllowed),
+		"sitemap": starlark.NewBuiltin(ModuleName+".sitemap", m.fetchSitemap),
+		"run":     starlark.NewBuiltin(ModuleName+".run", m.runCrawl),
+	}
+	return m.cfgMod.LoadModule(ModuleName, additionalFuncs, funcParams)
+}
+
+var (
+	none             = starlark.None
+	defaultUserAgent = "StarportCrawler/1.0"
+	maxBodySize      = int64(5 << 20)
+	maxSitemapDepth  = 3
+	linkPattern      = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*["']([^"'#]+)`)
+)
+
+// crawler holds the state of a crawl, i.e. cached robots.txt and the last request time of each host.
+type crawler struct {
+	ctx       context.Context
+	hc        *http.Client
+	userAgent string
+	delay     time.Duration
+	robots    map[string]*robotsData
+	lastReq   map[string]time.Time
+}
+
+// newCrawler creates a new crawler with the module configuration.
+func (m *Module) newCrawler(ctx context.Context, delay time.Duration) *crawler {
+	ua, _ := m.cfgMod.GetConfig("user_agent")
+	if ua == "" {
+		ua = defaultUserAgent
+	}
+	return &crawler{
+		ctx:       ctx,
+		hc:        &http.Client{Timeout: 30 * time.Second},
+		userAgent: ua,
+		delay:     delay,
+		robots:    make(map[string]*robotsData),
+		lastReq:   make(map[string]time.Time),
+	}
+}
+
+// wait sleeps until the next request to the host is allowed by the delay and crawl-delay.
+func (c *crawler) wait(u *url.URL) error {
+	delay := c.delay
+	if rd := c.robots[u.Host]; rd != nil {
+		if cd := rd.crawlDelay(c.userAgent); cd > delay {
+			delay = cd
+		}
+	}
+	last, ok := c.lastReq[u.Host]
+	if ok {
+		if d := time.Until(last.Add(delay)); d > 0 {
+			select {
+			case <-c.ctx.Done():
+				return c.ctx.Err()
+			case <-time.After(d):
+			}
+		}
+	}
+	c.lastReq[u.Host] = time.Now()
+	return nil
+}
+
+// get fetches the URL with rate limit, and returns the response with the body read.
+func (c *crawler) get(u *url.URL) (*http.Response, []byte, error) {
+	if err := c.wait(u); err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// robotsFor returns the parsed robots.txt of the host, missing or unreadable robots.txt allows everything.
+func (c *crawler) robotsFor(u *url.URL) *robotsData {
+	if rd, ok := c.robots[u.Host]; ok {
+		return rd
+	}
+	ru := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	rd := &robotsData{}
+	if resp, body, err := c.get(ru); err != nil {
+		log.Debugw("fail to fetch robots.txt", "url", ru.String(), "error", err)
+	} else if resp.StatusCode == http.StatusOK {
+		rd = parseRobots(bytes.NewReader(body))
+	}
+	c.robots[u.Host] = rd
+	return rd
+}
+
+// allowed reports whether the URL is allowed to crawl by robots.txt.
+func (c *crawler) allowed(u *url.URL) bool {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return c.robotsFor(u).allowed(c.userAgent, p)
+}
+
+// sitemapXML is either a urlset or a sitemapindex.
+type sitemapXML struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapURLs returns the page URLs in the sitemap, nested sitemap indexes are followed.
+func (c *crawler) sitemapURLs(u *url.URL, depth, limit int) ([]string, error) {
+	if depth > maxSitemapDepth {
+		return nil, nil
+	}
+	resp, body, err := c.get(u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap %s: unexpected status %s", u, resp.Status)
+	}
+	var sm sitemapXML
+	if err := xml.Unmarshal(body, &sm); err != nil {
+		return nil, fmt.Errorf("sitemap %s: %w", u, err)
+	}
+
+	var res []string
+	for _, e := range sm.URLs {
+		if limit > 0 && len(res) >= limit {
+			return res, nil
+		}
+		res = append(res, strings.TrimSpace(e.Loc))
+	}
+	for _, e := range sm.Sitemaps {
+		if limit > 0 && len(res) >= limit {
+			break
+		}
+		su, err := url.Parse(strings.TrimSpace(e.Loc))
+		if err != nil {
+			continue
+		}
+		sub, err := c.sitemapURLs(su, depth+1, limit-len(res))
+		if err != nil {
+			log.Debugw("fail to fetch nested sitemap", "url", su.String(), "error", err)
+			continue
+		}
+		res = append(res, sub...)
+	}
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// siteSitemaps returns the URLs of sitemaps of the site, from robots.txt or the default location.
+func (c *crawler) siteSitemaps(u *url.URL) []*url.URL {
+	var res []*url.URL
+	for _, s := range c.robotsFor(u).sitemaps {
+		if su, err := url.Parse(s); err == nil {
+			res = append(res, su)
+		}
+	}
+	if len(res) == 0 {
+		res = append(res, &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/sitemap.xml"})
+	}
+	return res
+}
+
+// parseHTTPURL parses the URL and checks it's an absolute HTTP(S) URL.
+func parseHTTPURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL: %s", s)
+	}
+	return u, nil
+}
+
+func (m *Module) robotsAllowed(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var rawURL types.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &rawURL); err != nil {
+		return none, err
+	}
+	u, err := parseHTTPURL(rawURL.GoString())
+	if err != nil {
+		return none, err
+	}
+	c := m.newCrawler(dataconv.GetThreadContext(thread), 0)
+	return starlark.Bool(c.allowed(u)), nil
+}
+
+func (m *Module) fetchSitemap(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		rawURL types.StringOrBytes
+		limit  = 0
+		delay  = types.FloatOrInt(0)
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &rawURL, "limit?", &limit, "delay?", &delay); err != nil {
+		return none, err
+	}
+	u, err := parseHTTPURL(rawURL.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// for site root, find sitemaps from robots.txt
+	c := m.newCrawler(dataconv.GetThreadContext(thread), secondsToDuration(delay))
+	sitemaps := []*url.URL{u}
+	if u.Path == "" || u.Path == "/" {
+		sitemaps = c.siteSitemaps(u)
+	}
+	var urls []string
+	for _, su := range sitemaps {
+		l, err := c.sitemapURLs(su, 0, limit-len(urls))
+		if err != nil {
+			return none, err
+		}
+		urls = append(urls, l...)
+		if limit > 0 && len(urls) >= limit {
+			break
+		}
+	}
+	return stringsToList(urls), nil
+}
+
+func (m *Module) runCrawl(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		start      types.StringOrBytes
+		callback   starlark.Callable
+		maxPages   = 100
+		delay      = types.FloatOrInt(1)
+		sameHost   = true
+		useSitemap = false
+		follow     = true
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "start", &start, "callback", &callback,
+		"max_pages?", &maxPages, "delay?", &delay, "same_host?", &sameHost, "use_sitemap?", &useSitemap, "follow_links?", &follow); err != nil {
+		return none, err
+	}
+	su, err := parseHTTPURL(start.GoString())
+	if err != nil {
+		return none, err
+	}
+
+	// seed the queue with the start URL or sitemap URLs
+	c := m.newCrawler(dataconv.GetThreadContext(thread), secondsToDuration(delay))
+	queue := []string{su.String()}
+	if useSitemap {
+		for _, sm := range c.siteSitemaps(su) {
+			l, err := c.sitemapURLs(sm, 0, maxPages)
+			if err != nil {
+				log.Debugw("fail to fetch sitemap", "url", sm.String(), "error", err)
+				continue
+			}
+			queue = append(queue, l...)
+		}
+	}
+
+	// crawl in breadth-first order
+	var (
+		seen    = make(map[string]bool)
+		crawled = 0
+	)
+	for len(queue) > 0 && (maxPages <= 0 || crawled < maxPages) {
+		raw := queue[0]
+		queue = queue[1:]
+		u, err := parseHTTPURL(raw)
+		if err != nil {
+			continue
+		}
+		u.Fragment = ""
+		key := u.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if sameHost && u.Host != su.Host {
+			continue
+		}
+		if !c.allowed(u) {
+			log.Debugw("disallowed by robots.txt", "url", key)
+			continue
+		}
+
+		// fetch the page
+		resp, body, err := c.get(u)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return none, err
+			}
+			log.Debugw("fail to fetch page", "url", key, "error", err)
+			continue
+		}
+		crawled++
+
+		// extract links from HTML pages
+		ct := resp.Header.Get("Content-Type")
+		var links []string
+		if strings.Contains(ct, "html") {
+			links = extractLinks(u, body)
+		}
+		if follow {
+			queue = append(queue, links...)
+		}
+
+		// yield the page to callback, stop if it returns False
+		page := starlarkstruct.FromStringDict(starlark.String("page"), starlark.StringDict{
+			"url":          starlark.String(key),
+			"status":       starlark.MakeInt(resp.StatusCode),
+			"content_type": starlark.String(ct),
+			"body":         starlark.String(body),
+			"links":        stringsToList(links),
+		})
+		ret, err := starlark.Call(thread, callback, starlark.Tuple{page}, nil)
+		if err != nil {
+			return none, err
+		}
+		if ret == starlark.False {
+			break
+		}
+	}
+	return starlark.MakeInt(crawled), nil
+}
+
+// extractLinks returns the absolute HTTP(S) links in the HTML page, the relative ones are resolved against the page URL.
+func extractLinks(pageURL *url.URL, body []byte) []string {
+	var (
+		res  []string
+		seen = make(map[string]bool)
+	)
+	for _, m := range linkPattern.FindAllSubmatch(body, -1) {
+		ref, err := url.Parse(strings.TrimSpace(string(m[1])))
+		if err != nil {
+			continue
+		}
+		u := pageURL.ResolveReference(ref)
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		u.Fragment = ""
+		if s := u.String(); !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// stringsToList converts a slice of strings to a Starlark list.
+func stringsToList(values []string) *starlark.List {
+	res := make([]starlark.Value, len(values))
+	for i, v := range values {
+		res[i] = starlark.String(v)
+	}
+	return starlark.NewList(res)
+}
+
+// secondsToDuration converts the seconds to time.Duration.
+func secondsToDuration(sec types.FloatOrInt) time.Duration {
+	return time.Duration(sec.GoFloat64() * float64(time.Second))
+}
@@ -0,0 +1,26 @@
+module github.com/PureMature/starport/crawl
+
+go 1.18
+
+require (
+	bitbucket.org/neiku/hlog v0.1.2
+	github.com/1set/starlet v0.1.3-0.20240812175751-6f896086c469
+	github.com/PureMature/starport/base v0.0.5
+	go.starlark.net v0.0.0-20240123142251-f86470692795
+	go.uber.org/zap v1.24.0
+)
+
+require (
+	github.com/1set/gut v0.0.0-20201117175203-a82363231997 // indirect
+	github.com/1set/starlight v0.1.2 // indirect
+	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/h2so5/here v0.0.0-20200815043652-5e14eb691fae // indirect
+	github.com/montanaflynn/stats v0.7.1 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	go.uber.org/multierr v1.9.0 // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+)
+
+replace github.com/PureMature/starport/base => ../base
@@ -0,0 +1,162 @@
+package crawl
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRule is an Allow or Disallow rule in robots.txt.
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsGroup is a group of rules for a set of user agents.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsData is the parsed robots.txt of a host.
+type robotsData struct {
+	groups   []*robotsGroup
+	sitemaps []string
+}
+
+// parseRobots parses the content of robots.txt, unknown lines are ignored.
+func parseRobots(r io.Reader) *robotsData {
+	var (
+		rd       = &robotsData{}
+		cur      *robotsGroup
+		inAgents bool
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+
+		switch key {
+		case "user-agent":
+			// consecutive user-agent lines share the same group
+			if !inAgents {
+				cur = &robotsGroup{}
+				rd.groups = append(rd.groups, cur)
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			// empty disallow means allow all
+			if val == "" {
+				continue
+			}
+			cur.rules = append(cur.rules, robotsRule{allow: key == "allow", pattern: val})
+		case "crawl-delay":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			if sec, err := strconv.ParseFloat(val, 64); err == nil && sec > 0 {
+				cur.crawlDelay = time.Duration(sec * float64(time.Second))
+			}
+		case "sitemap":
+			rd.sitemaps = append(rd.sitemaps, val)
+		default:
+			inAgents = false
+		}
+	}
+	return rd
+}
+
+// group returns the most specific group for the user agent, or nil if no group matches.
+func (rd *robotsData) group(userAgent string) *robotsGroup {
+	if rd == nil {
+		return nil
+	}
+	ua := strings.ToLower(userAgent)
+	var (
+		best    *robotsGroup
+		bestLen = -1
+	)
+	for _, g := range rd.groups {
+		for _, a := range g.agents {
+			if a == "*" && bestLen < 0 {
+				best, bestLen = g, 0
+			} else if a != "*" && strings.Contains(ua, a) && len(a) > bestLen {
+				best, bestLen = g, len(a)
+			}
+		}
+	}
+	return best
+}
+
+// allowed reports whether the path is allowed for the user agent, the longest matching rule wins and Allow wins ties.
+func (rd *robotsData) allowed(userAgent, path string) bool {
+	g := rd.group(userAgent)
+	if g == nil {
+		return true
+	}
+	var (
+		allow   = true
+		bestLen = -1
+	)
+	for _, r := range g.rules {
+		if !matchRobotsPattern(r.pattern, path) {
+			continue
+		}
+		if l := len(r.pattern); l > bestLen || (l == bestLen && r.allow) {
+			allow, bestLen = r.allow, l
+		}
+	}
+	return allow
+}
+
+// crawlDelay returns the crawl delay for the user agent, or 0 if not set.
+func (rd *robotsData) crawlDelay(userAgent string) time.Duration {
+	if g := rd.group(userAgent); g != nil {
+		return g.crawlDelay
+	}
+	return 0
+}
+
+// matchRobotsPattern reports whether the path matches the robots.txt pattern, which supports '*' wildcard and '$' end anchor.
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+
+	// the first part must be a prefix
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, p := range parts[1:] {
+		// the last part must be a suffix if anchored
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, p)
+		}
+		idx := strings.Index(rest, p)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(p):]
+	}
+	return !anchored || rest == ""
+}
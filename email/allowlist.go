@@ -0,0 +1,101 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"path"
+	"strings"
+)
+
+// SetAllowedRecipients sets the glob patterns of recipient addresses allowed to send to, e.g. "*@example.com", for staging environments.
+// The emails to other addresses are redirected to redirectTo if it's set, otherwise they are rejected. Empty patterns allow all.
+func (m *Module) SetAllowedRecipients(patterns []string, redirectTo string) {
+	m.cfgMod.SetConfigValue("email_allowed_recipients", strings.Join(patterns, ","))
+	m.cfgMod.SetConfigValue("email_redirect_to", redirectTo)
+}
+
+// getAllowedRecipients returns the glob patterns in email_allowed_recipients config, and the address in email_redirect_to config.
+func (m *Module) getAllowedRecipients() ([]string, string) {
+	s, err := m.cfgMod.GetConfig("email_allowed_recipients")
+	if err != nil || strings.TrimSpace(s) == "" {
+		return nil, ""
+	}
+	redirect, _ := m.cfgMod.GetConfig("email_redirect_to")
+	return splitList(strings.ToLower(s)), strings.TrimSpace(redirect)
+}
+
+// isAllowedRecipient reports whether the address matches any of the glob patterns, case-insensitively.
+func isAllowedRecipient(addr string, patterns []string) (bool, error) {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return false, fmt.Errorf("invalid recipient address %q: %w", addr, err)
+	}
+	for _, p := range patterns {
+		ok, err := path.Match(p, strings.ToLower(a.Address))
+		if err != nil {
+			return false, fmt.Errorf("invalid email_allowed_recipients pattern %q: %w", p, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// limitRecipients checks the recipients of the request against the allowlist in config. The disallowed ones are replaced by the
+// redirect address and listed in the X-Original-Recipients header, or rejected if there is no redirect address.
+func (m *Module) limitRecipients(req *sendEmailRequest) error {
+	patterns, redirect := m.getAllowedRecipients()
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	var (
+		blocked []string
+		seen    = make(map[string]bool)
+	)
+	filter := func(l []string) ([]string, error) {
+		var res []string
+		for _, addr := range l {
+			ok, err := isAllowedRecipient(addr, patterns)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				blocked = append(blocked, addr)
+				if redirect == "" {
+					continue
+				}
+				addr = redirect
+			}
+			if !seen[addr] {
+				seen[addr] = true
+				res = append(res, addr)
+			}
+		}
+		return res, nil
+	}
+
+	var err error
+	if req.To, err = filter(req.To); err != nil {
+		return err
+	}
+	if req.Cc, err = filter(req.Cc); err != nil {
+		return err
+	}
+	if req.Bcc, err = filter(req.Bcc); err != nil {
+		return err
+	}
+	if len(blocked) == 0 {
+		return nil
+	}
+	if redirect == "" {
+		return fmt.Errorf("recipients not allowed by email_allowed_recipients: %s", strings.Join(blocked, ", "))
+	}
+	log.Infow("redirect email recipients", "recipients", blocked, "redirect_to", redirect)
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	req.Headers["X-Original-Recipients"] = strings.Join(blocked, ", ")
+	return nil
+}
@@ -0,0 +1,108 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	assetModeCID     = "cid"
+	assetModeDataURI = "data"
+)
+
+// parseAssetMode converts the inline_assets argument to the mode: True or "cid" for inline attachments, "data" for data URIs,
+// and empty for None or False to keep the images as they are.
+func parseAssetMode(v starlark.Value) (string, error) {
+	switch t := v.(type) {
+	case starlark.NoneType:
+		return "", nil
+	case starlark.Bool:
+		if t {
+			return assetModeCID, nil
+		}
+		return "", nil
+	case starlark.String:
+		switch s := strings.ToLower(string(t)); s {
+		case assetModeCID, assetModeDataURI:
+			return s, nil
+		}
+		return "", fmt.Errorf(`inline_assets must be "cid" or "data", got %q`, string(t))
+	default:
+		return "", fmt.Errorf("inline_assets must be a bool or string, got %s", v.Type())
+	}
+}
+
+// embedAssets fetches the images referred in HTML, i.e. remote URLs or local and charm file paths, and embeds them as inline attachments
+// or data URIs by the mode. The ones already referred by "cid:" or data URIs are skipped, and the same source is embedded once.
+func (m *Module) embedAssets(ctx context.Context, html, mode string) (string, []*attachment, error) {
+	var (
+		atts []*attachment
+		refs = make(map[string]string)
+		err  error
+	)
+	res := imageSrcPattern.ReplaceAllStringFunc(html, func(s string) string {
+		mt := imageSrcPattern.FindStringSubmatch(s)
+		src := mt[2]
+		if err != nil || strings.HasPrefix(src, "cid:") || strings.HasPrefix(src, "data:") {
+			return s
+		}
+		if ref, ok := refs[src]; ok {
+			return mt[1] + ref + mt[3]
+		}
+
+		// load the image from the URL or file
+		var (
+			data []byte
+			name string
+		)
+		if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+			data, name, err = downloadAttachment(ctx, src)
+		} else {
+			data, err = m.readAttachmentFile(src)
+			name = path.Base(strings.TrimPrefix(filepath.ToSlash(src), charmFilePrefix))
+		}
+		if err != nil {
+			err = fmt.Errorf("inline asset %s: %w", src, err)
+			return s
+		}
+		ct := mime.TypeByExtension(path.Ext(name))
+		if ct == "" {
+			ct = http.DetectContentType(data)
+		}
+
+		// embed it
+		var ref string
+		if mode == assetModeDataURI {
+			ref = "data:" + ct + ";base64," + base64.StdEncoding.EncodeToString(data)
+		} else {
+			cid := fmt.Sprintf("asset%d", len(atts)+1)
+			if name == "" || path.Ext(name) == "" {
+				name = cid
+				if exts, _ := mime.ExtensionsByType(ct); len(exts) > 0 {
+					name += exts[0]
+				}
+			}
+			atts = append(atts, &attachment{
+				Filename:  name,
+				Content:   base64.StdEncoding.EncodeToString(data),
+				ContentID: cid,
+				data:      data,
+			})
+			ref = "cid:" + cid
+		}
+		refs[src] = ref
+		return mt[1] + ref + mt[3]
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return res, atts, nil
+}
@@ -0,0 +1,162 @@
+package email
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/1set/gut/ystring"
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"go.starlark.net/starlark"
+)
+
+// createBroadcastRequest is the request to create a broadcast to an audience, not supported by the SDK yet.
+type createBroadcastRequest struct {
+	AudienceID string `json:"audience_id"`
+	From       string `json:"from"`
+	Subject    string `json:"subject"`
+	ReplyTo    string `json:"reply_to,omitempty"`
+	Html       string `json:"html,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+// sendBroadcastRequest is the request to send a created broadcast now or at the scheduled time.
+type sendBroadcastRequest struct {
+	ScheduledAt string `json:"scheduled_at,omitempty"`
+}
+
+// broadcastResponse is the response of creating or sending a broadcast.
+type broadcastResponse struct {
+	ID string `json:"id"`
+}
+
+// genBroadcastFunc generates the Starlark callable function to send an email to all contacts of an audience via Resend Broadcasts.
+// It creates the broadcast and sends it right away or at the scheduled time, and returns the broadcast ID.
+func (m *Module) genBroadcastFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".broadcast", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		// broadcasts are only available in Resend
+		if provider, err := m.getProvider(); err != nil {
+			return starlark.None, err
+		} else if provider.name() != providerResend {
+			return starlark.None, fmt.Errorf("broadcast is only supported by resend provider, got %s", provider.name())
+		}
+		client, err := m.newClient()
+		if err != nil {
+			return starlark.None, err
+		}
+		senderDomain, _ := m.cfgMod.GetConfig("sender_domain")
+
+		// parse args
+		var (
+			audienceID   types.StringOrBytes
+			subject      types.StringOrBytes
+			bodyHTML     types.NullableStringOrBytes
+			bodyText     types.NullableStringOrBytes
+			bodyMarkdown types.NullableStringOrBytes
+			markdownOpts types.NullableDict
+			fromAddress  types.StringOrBytes
+			fromNameID   types.StringOrBytes
+			fromProfile  types.StringOrBytes
+			replyAddress types.StringOrBytes
+			replyNameID  types.StringOrBytes
+			name         types.StringOrBytes
+			scheduledAt  types.NullableStringOrBytes
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+			"audience", &audienceID, "subject", &subject,
+			"html?", &bodyHTML, "text?", &bodyText, "markdown?", &bodyMarkdown, "markdown_options?", &markdownOpts,
+			"from?", &fromAddress, "from_id?", &fromNameID, "from_profile?", &fromProfile,
+			"reply_to?", &replyAddress, "reply_id?", &replyNameID,
+			"name?", &name, "scheduled_at?", &scheduledAt); err != nil {
+			return starlark.None, err
+		}
+
+		// validate args
+		if ystring.IsBlank(audienceID.GoString()) {
+			return starlark.None, fmt.Errorf("audience must be non-blank")
+		}
+		if patterns, _ := m.getAllowedRecipients(); len(patterns) > 0 {
+			return starlark.None, fmt.Errorf("broadcast is not allowed when email_allowed_recipients is set")
+		}
+		if bodyHTML.IsNullOrEmpty() && bodyText.IsNullOrEmpty() && bodyMarkdown.IsNullOrEmpty() {
+			return starlark.None, fmt.Errorf("one of html, text, or markdown must be non-blank")
+		}
+		profileFrom, profileReply, err := m.resolveSenderProfile(fromProfile.GoString(), senderDomain)
+		if err != nil {
+			return starlark.None, err
+		}
+		sendAddr, err := resolveAddress(fromAddress.GoString(), fromNameID.GoString(), senderDomain, "from_id")
+		if err != nil {
+			return starlark.None, err
+		}
+		if sendAddr == "" {
+			sendAddr = profileFrom
+		}
+		if sendAddr == "" {
+			return starlark.None, fmt.Errorf("one of from, from_id or from_profile must be non-blank")
+		}
+		replyAddr, err := resolveAddress(replyAddress.GoString(), replyNameID.GoString(), senderDomain, "reply_id")
+		if err != nil {
+			return starlark.None, err
+		}
+		if replyAddr == "" {
+			replyAddr = profileReply
+		}
+
+		// prepare the broadcast
+		cr := &createBroadcastRequest{
+			AudienceID: audienceID.GoString(),
+			From:       sendAddr,
+			Subject:    subject.GoString(),
+			ReplyTo:    replyAddr,
+			Name:       name.GoString(),
+		}
+		if !bodyHTML.IsNullOrEmpty() {
+			cr.Html = bodyHTML.GoString()
+		} else if !bodyMarkdown.IsNullOrEmpty() {
+			opt, err := m.getMarkdownOptions(markdownOpts.Value())
+			if err != nil {
+				return starlark.None, err
+			}
+			if cr.Html, err = markdownToHTML(bodyMarkdown.GoString(), opt); err != nil {
+				return starlark.None, err
+			}
+		}
+		if !bodyText.IsNullOrEmpty() {
+			cr.Text = bodyText.GoString()
+		}
+		guarded, err := m.cfgMod.GuardSecrets(cr.Subject, cr.Html, cr.Text)
+		if err != nil {
+			return starlark.None, err
+		}
+		cr.Subject, cr.Html, cr.Text = guarded[0], guarded[1], guarded[2]
+		sr := &sendBroadcastRequest{}
+		if !scheduledAt.IsNullOrEmpty() {
+			if sr.ScheduledAt, err = parseScheduledAt(scheduledAt.GoString(), base.Now()); err != nil {
+				return starlark.None, err
+			}
+		}
+
+		// create and send it
+		ctx := dataconv.GetThreadContext(thread)
+		req, err := client.NewRequest(ctx, http.MethodPost, "broadcasts", cr)
+		if err != nil {
+			return starlark.None, fmt.Errorf("failed to create broadcast request: %w", err)
+		}
+		created := new(broadcastResponse)
+		if _, err = client.Perform(req, created); err != nil {
+			return starlark.None, err
+		}
+		req, err = client.NewRequest(ctx, http.MethodPost, "broadcasts/"+url.PathEscape(created.ID)+"/send", sr)
+		if err != nil {
+			return starlark.None, fmt.Errorf("failed to create broadcast send request: %w", err)
+		}
+		if _, err = client.Perform(req, new(broadcastResponse)); err != nil {
+			return starlark.None, fmt.Errorf("broadcast %s created but not sent: %w", created.ID, err)
+		}
+		return starlark.String(created.ID), nil
+	})
+}
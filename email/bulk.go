@@ -0,0 +1,154 @@
+package email
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"go.starlark.net/starlark"
+)
+
+// transientErrorHints are the parts of error messages of rate limits and server errors, which are worth retrying.
+var transientErrorHints = []string{
+	"too many requests", "rate limit", "429",
+	"internal server error", "bad gateway", "service unavailable", "gateway timeout", "500", "502", "503", "504",
+}
+
+// isTransientError reports whether the error of sending is temporary, i.e. network errors, rate limits and server errors.
+func isTransientError(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, h := range transientErrorHints {
+		if strings.Contains(msg, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// jitter returns the duration randomly scaled between 80% and 120%, to spread the requests of concurrent runners.
+func jitter(d time.Duration) time.Duration {
+	var b [2]byte
+	if err := base.RandRead(b[:]); err != nil {
+		return d
+	}
+	f := 0.8 + 0.4*float64(binary.BigEndian.Uint16(b[:]))/65535
+	return time.Duration(float64(d) * f)
+}
+
+// sleepContext waits for the duration, and returns early with error if the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// hasKwarg reports whether the keyword argument is given.
+func hasKwarg(kwargs []starlark.Tuple, name string) bool {
+	for _, kv := range kwargs {
+		if kv[0] == starlark.String(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// genSendAllFunc generates the Starlark callable function to send a list of emails with paced requests.
+// Each message is a dict of arguments of send(), and the transient failures like rate limits are retried with backoff.
+// The idempotency key is generated for the message without idempotency_key, set it to None to opt out.
+// It returns a list of results instead of failing on the first error, each result is a dict of index, ok, result, error and attempts.
+func (m *Module) genSendAllFunc() starlark.Callable {
+	sendFn := m.genSendFunc()
+	return starlark.NewBuiltin(ModuleName+".send_all", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			messages  = types.NewOneOrManyNoDefault[*starlark.Dict]()
+			perSecond = types.FloatOrInt(2)
+			retry     = 3
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "messages", messages, "per_second?", &perSecond, "retry?", &retry); err != nil {
+			return starlark.None, err
+		}
+		if perSecond <= 0 {
+			return starlark.None, fmt.Errorf("per_second must be positive, got %v", perSecond)
+		}
+		if retry < 0 {
+			return starlark.None, fmt.Errorf("retry must be non-negative, got %d", retry)
+		}
+		var (
+			ctx      = dataconv.GetThreadContext(thread)
+			interval = time.Duration(float64(time.Second) / perSecond.GoFloat64())
+			results  []starlark.Value
+		)
+
+		for i, md := range messages.Slice() {
+			// convert the dict to keyword arguments of send()
+			var msgArgs []starlark.Tuple
+			for _, it := range md.Items() {
+				if _, ok := it[0].(starlark.String); !ok {
+					return starlark.None, fmt.Errorf("message %d: argument name must be a string, got %s", i, it[0].Type())
+				}
+				msgArgs = append(msgArgs, starlark.Tuple{it[0], it[1]})
+			}
+			msgArgs = m.cfgMod.ApplyDefaultKwargs("send", msgArgs)
+
+			// generate the idempotency key if not given, so the retries of a sent but failed request don't send it again
+			if !hasKwarg(msgArgs, "idempotency_key") {
+				msgArgs = append(msgArgs, starlark.Tuple{starlark.String("idempotency_key"), starlark.True})
+			}
+
+			// send with retries on transient errors
+			var (
+				res      starlark.Value
+				err      error
+				attempts int
+				backoff  = time.Second
+			)
+			for attempts = 1; ; attempts++ {
+				if i > 0 || attempts > 1 {
+					if serr := sleepContext(ctx, jitter(interval)); serr != nil {
+						return starlark.None, serr
+					}
+				}
+				res, err = starlark.Call(thread, sendFn, nil, msgArgs)
+				if err == nil || attempts > retry || !isTransientError(err) {
+					break
+				}
+				log.Debugw("retry sending email", "index", i, "attempt", attempts, "error", err)
+				if serr := sleepContext(ctx, jitter(backoff)); serr != nil {
+					return starlark.None, serr
+				}
+				backoff *= 2
+			}
+
+			// collect the result
+			rd := starlark.NewDict(5)
+			_ = rd.SetKey(starlark.String("index"), starlark.MakeInt(i))
+			_ = rd.SetKey(starlark.String("ok"), starlark.Bool(err == nil))
+			_ = rd.SetKey(starlark.String("attempts"), starlark.MakeInt(attempts))
+			if err != nil {
+				_ = rd.SetKey(starlark.String("result"), starlark.None)
+				_ = rd.SetKey(starlark.String("error"), starlark.String(err.Error()))
+			} else {
+				_ = rd.SetKey(starlark.String("result"), res)
+				_ = rd.SetKey(starlark.String("error"), starlark.None)
+			}
+			results = append(results, rd)
+		}
+		return starlark.NewList(results), nil
+	})
+}
@@ -0,0 +1,99 @@
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// maxAttachmentsSize is the limit of all attachments in an email after base64 encoding, which is 40 MB for Resend.
+const maxAttachmentsSize = 40 << 20
+
+// attachmentsSize returns the total size of attachments after base64 encoding.
+func attachmentsSize(atts []*attachment) int {
+	n := 0
+	for _, a := range atts {
+		n += base64.StdEncoding.EncodedLen(len(a.data))
+	}
+	return n
+}
+
+// limitAttachments checks the total size of attachments against the limit. If it's over the limit and compress is set,
+// the regular attachments are zipped into one archive while inline images are kept, and checked again.
+func limitAttachments(atts []*attachment, compress bool) ([]*attachment, error) {
+	size := attachmentsSize(atts)
+	if size <= maxAttachmentsSize {
+		return atts, nil
+	}
+	if !compress {
+		return nil, fmt.Errorf("attachments are too large: %d bytes encoded, limit is %d, set compress=True to zip them", size, maxAttachmentsSize)
+	}
+
+	// split regular attachments and inline images
+	var regular, res []*attachment
+	for _, a := range atts {
+		if a.ContentID == "" {
+			regular = append(regular, a)
+		} else {
+			res = append(res, a)
+		}
+	}
+	if len(regular) == 0 {
+		return nil, fmt.Errorf("inline images are too large: %d bytes encoded, limit is %d", size, maxAttachmentsSize)
+	}
+
+	// zip the regular ones
+	zipped, err := zipAttachments(regular)
+	if err != nil {
+		return nil, err
+	}
+	res = append(res, zipped)
+	if size = attachmentsSize(res); size > maxAttachmentsSize {
+		return nil, fmt.Errorf("attachments are too large even compressed: %d bytes encoded, limit is %d", size, maxAttachmentsSize)
+	}
+	log.Debugw("attachments compressed", "files", len(regular), "name", zipped.Filename, "size", len(zipped.data))
+	return res, nil
+}
+
+// zipAttachments compresses the attachments into one zip archive, named after the file if there is only one.
+func zipAttachments(atts []*attachment) (*attachment, error) {
+	var (
+		buf  bytes.Buffer
+		zw   = zip.NewWriter(&buf)
+		seen = make(map[string]int)
+	)
+	for _, a := range atts {
+		// keep the names unique in the archive
+		name := a.Filename
+		if n := seen[name]; n > 0 {
+			ext := path.Ext(name)
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+		}
+		seen[a.Filename]++
+
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(a.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	name := "attachments.zip"
+	if len(atts) == 1 {
+		name = atts[0].Filename + ".zip"
+	}
+	data := buf.Bytes()
+	return &attachment{
+		Filename: name,
+		Content:  base64.StdEncoding.EncodeToString(data),
+		data:     data,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/1set/gut/ystring"
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/resend/resend-go/v2"
+	"go.starlark.net/starlark"
+)
+
+// domainInfo is the sender domain returned to Starlark, with the DNS records to add for verification.
+type domainInfo struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Status    string          `json:"status"`
+	Region    string          `json:"region"`
+	CreatedAt string          `json:"created_at"`
+	Records   []resend.Record `json:"records,omitempty"`
+}
+
+// domainToStarlark converts the domain info to a Starlark dict.
+func domainToStarlark(d *domainInfo) (starlark.Value, error) {
+	bs, err := json.Marshal(d)
+	if err != nil {
+		return starlark.None, err
+	}
+	return dataconv.UnmarshalStarlarkJSON(bs)
+}
+
+// genListDomainsFunc generates the Starlark callable function to list the sender domains of the account.
+func (m *Module) genListDomainsFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".list_domains", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+			return starlark.None, err
+		}
+		client, err := m.newClient()
+		if err != nil {
+			return starlark.None, err
+		}
+		resp, err := client.Domains.ListWithContext(dataconv.GetThreadContext(thread))
+		if err != nil {
+			return starlark.None, err
+		}
+
+		// convert to a list of dicts
+		res := make([]starlark.Value, 0, len(resp.Data))
+		for _, d := range resp.Data {
+			v, err := domainToStarlark(&domainInfo{
+				ID:        d.Id,
+				Name:      d.Name,
+				Status:    d.Status,
+				Region:    d.Region,
+				CreatedAt: d.CreatedAt,
+			})
+			if err != nil {
+				return starlark.None, err
+			}
+			res = append(res, v)
+		}
+		return starlark.NewList(res), nil
+	})
+}
+
+// genCreateDomainFunc generates the Starlark callable function to add a sender domain, it returns the DNS records to set up.
+func (m *Module) genCreateDomainFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".create_domain", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var name, region types.StringOrBytes
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "region?", &region); err != nil {
+			return starlark.None, err
+		}
+		if ystring.IsBlank(name.GoString()) {
+			return starlark.None, fmt.Errorf("name must be non-blank")
+		}
+		client, err := m.newClient()
+		if err != nil {
+			return starlark.None, err
+		}
+		resp, err := client.Domains.CreateWithContext(dataconv.GetThreadContext(thread), &resend.CreateDomainRequest{
+			Name:   name.GoString(),
+			Region: region.GoString(),
+		})
+		if err != nil {
+			return starlark.None, err
+		}
+		return domainToStarlark(&domainInfo{
+			ID:        resp.Id,
+			Name:      resp.Name,
+			Status:    resp.Status,
+			Region:    resp.Region,
+			CreatedAt: resp.CreatedAt,
+			Records:   resp.Records,
+		})
+	})
+}
+
+// genVerifyDomainFunc generates the Starlark callable function to start the verification of a sender domain.
+// The verification runs asynchronously, the status can be checked with list_domains() later.
+func (m *Module) genVerifyDomainFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".verify_domain", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var domainID types.StringOrBytes
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "id", &domainID); err != nil {
+			return starlark.None, err
+		}
+		if ystring.IsBlank(domainID.GoString()) {
+			return starlark.None, fmt.Errorf("id must be non-blank")
+		}
+		client, err := m.newClient()
+		if err != nil {
+			return starlark.None, err
+		}
+		ok, err := client.Domains.VerifyWithContext(dataconv.GetThreadContext(thread), domainID.GoString())
+		if err != nil {
+			return starlark.None, err
+		}
+		return starlark.Bool(ok), nil
+	})
+}
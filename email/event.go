@@ -0,0 +1,154 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"go.starlark.net/starlark"
+)
+
+// webhookTolerance is the maximum difference between the webhook timestamp and now, to prevent replay attacks.
+const webhookTolerance = 5 * time.Minute
+
+// webhookEvent is the event sent by Resend webhooks.
+type webhookEvent struct {
+	Type      string                 `json:"type"`
+	CreatedAt string                 `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// parsedEvent is the event returned to Starlark, with the common fields lifted from data.
+type parsedEvent struct {
+	Type      string                 `json:"type"`
+	Event     string                 `json:"event"`
+	CreatedAt string                 `json:"created_at"`
+	EmailID   interface{}            `json:"email_id"`
+	From      interface{}            `json:"from"`
+	To        interface{}            `json:"to"`
+	Subject   interface{}            `json:"subject"`
+	Bounce    interface{}            `json:"bounce,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// SetWebhookSecret sets the signing secret of Resend webhooks for verifying the events in parse_event().
+func (m *Module) SetWebhookSecret(secret string) {
+	m.cfgMod.SetConfigValue("webhook_secret", secret)
+}
+
+// verifyWebhook verifies the signature of the payload signed by Resend via Svix, with the headers of svix-id, svix-timestamp and svix-signature.
+// The secret is the signing secret of the webhook, starting with "whsec_".
+func verifyWebhook(payload []byte, headers map[string]string, secret string) error {
+	get := func(k string) string {
+		for hk, v := range headers {
+			if strings.EqualFold(hk, k) {
+				return v
+			}
+		}
+		return ""
+	}
+	msgID, ts, sigs := get("svix-id"), get("svix-timestamp"), get("svix-signature")
+	if msgID == "" || ts == "" || sigs == "" {
+		return errors.New("missing webhook signature headers: svix-id, svix-timestamp and svix-signature are required")
+	}
+
+	// check the timestamp
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp: %s", ts)
+	}
+	if d := base.Now().Sub(time.Unix(sec, 0)); d > webhookTolerance || d < -webhookTolerance {
+		return fmt.Errorf("webhook timestamp is out of tolerance: %s", ts)
+	}
+
+	// compute the expected signature
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return fmt.Errorf("invalid webhook secret: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msgID + "." + ts + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	// any of the space-separated "v1,<base64>" signatures matches
+	for _, s := range strings.Fields(sigs) {
+		ver, sig, ok := strings.Cut(s, ",")
+		if !ok || ver != "v1" {
+			continue
+		}
+		if bs, err := base64.StdEncoding.DecodeString(sig); err == nil && hmac.Equal(bs, expected) {
+			return nil
+		}
+	}
+	return errors.New("webhook signature mismatch")
+}
+
+// genParseEventFunc generates the Starlark callable function to parse the payload of Resend webhooks, e.g. email.delivered and email.bounced.
+// The signature is verified if the headers and the secret are given, the secret falls back to webhook_secret in config.
+func (m *Module) genParseEventFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".parse_event", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			payload   types.StringOrBytes
+			signature types.NullableDict
+			secret    types.StringOrBytes
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "payload", &payload, "signature?", &signature, "secret?", &secret); err != nil {
+			return starlark.None, err
+		}
+		key := secret.GoString()
+		if key == "" {
+			key, _ = m.cfgMod.GetConfig("webhook_secret")
+		}
+
+		// verify the signature with the headers
+		if sd := signature.Value(); sd != nil {
+			if key == "" {
+				return starlark.None, errors.New("secret or webhook_secret is required to verify the signature")
+			}
+			headers := make(map[string]string, sd.Len())
+			for _, it := range sd.Items() {
+				headers[dataconv.StarString(it[0])] = dataconv.StarString(it[1])
+			}
+			if err := verifyWebhook(payload.GoBytes(), headers, key); err != nil {
+				return starlark.None, err
+			}
+		} else if key != "" {
+			return starlark.None, errors.New("signature headers are required when the secret is set")
+		}
+
+		// parse the event
+		var ev webhookEvent
+		if err := json.Unmarshal(payload.GoBytes(), &ev); err != nil {
+			return starlark.None, fmt.Errorf("invalid webhook payload: %w", err)
+		}
+		if ev.Type == "" {
+			return starlark.None, errors.New("invalid webhook payload: missing type")
+		}
+		pe := &parsedEvent{
+			Type:      ev.Type,
+			Event:     strings.TrimPrefix(ev.Type, "email."),
+			CreatedAt: ev.CreatedAt,
+			EmailID:   ev.Data["email_id"],
+			From:      ev.Data["from"],
+			To:        ev.Data["to"],
+			Subject:   ev.Data["subject"],
+			Bounce:    ev.Data["bounce"],
+			Data:      ev.Data,
+		}
+		bs, err := json.Marshal(pe)
+		if err != nil {
+			return starlark.None, err
+		}
+		return dataconv.UnmarshalStarlarkJSON(bs)
+	})
+}
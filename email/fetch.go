@@ -0,0 +1,56 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// maxAttachmentURLSize is the maximum size of attachments downloaded from URLs.
+const maxAttachmentURLSize = 20 << 20
+
+// downloadAttachment downloads the attachment from the HTTP or HTTPS URL, and returns the content and the file name in URL.
+// It fails if the response is not successful or larger than maxAttachmentURLSize.
+func downloadAttachment(ctx context.Context, rawURL string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid attachment url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, "", fmt.Errorf("unsupported attachment url scheme: %q", u.Scheme)
+	}
+
+	// send the request
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", fmt.Errorf("download attachment %s: %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > maxAttachmentURLSize {
+		return nil, "", fmt.Errorf("attachment %s is too large: %d bytes, limit is %d", rawURL, resp.ContentLength, maxAttachmentURLSize)
+	}
+
+	// read with the size limit
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAttachmentURLSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxAttachmentURLSize {
+		return nil, "", fmt.Errorf("attachment %s is too large, limit is %d bytes", rawURL, maxAttachmentURLSize)
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = ""
+	}
+	return data, name, nil
+}
@@ -6,10 +6,12 @@ require (
 	bitbucket.org/neiku/hlog v0.1.2
 	github.com/1set/gut v0.0.0-20201117175203-a82363231997
 	github.com/1set/starlet v0.1.2-0.20240625041505-6d190fac7b11
-	github.com/PureMature/starport/base v0.0.4
+	github.com/PureMature/starport/base v0.0.5
+	github.com/alecthomas/chroma/v2 v2.2.0
 	github.com/resend/resend-go/v2 v2.6.0
 	github.com/samber/lo v1.39.0
 	github.com/yuin/goldmark v1.7.1
+	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc
 	go.starlark.net v0.0.0-20240123142251-f86470692795
 	go.uber.org/zap v1.24.0
 )
@@ -17,6 +19,7 @@ require (
 require (
 	github.com/1set/starlight v0.1.1 // indirect
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e // indirect
+	github.com/dlclark/regexp2 v1.7.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/h2so5/here v0.0.0-20200815043652-5e14eb691fae // indirect
 	go.uber.org/atomic v1.11.0 // indirect
@@ -25,3 +28,5 @@ require (
 	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
+
+replace github.com/PureMature/starport/base => ../base
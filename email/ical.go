@@ -0,0 +1,245 @@
+package email
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	startime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+const icalTimeLayout = "20060102T150405Z"
+
+// calendarEvent is the meeting invitation built from the ical dict of send().
+type calendarEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	Organizer   string
+	Attendees   []string
+}
+
+// parseCalendarEvent converts the ical dict to the event. The start is required with end or duration, and the organizer and attendees
+// default to the sender and the recipients.
+func parseCalendarEvent(d *starlark.Dict, req *sendEmailRequest) (*calendarEvent, error) {
+	ev := &calendarEvent{Organizer: req.From}
+	var duration time.Duration
+	for _, it := range d.Items() {
+		k, ok := starlark.AsString(it[0])
+		if !ok {
+			return nil, fmt.Errorf("ical field name must be a string, got %s", it[0].Type())
+		}
+		var err error
+		switch k {
+		case "uid":
+			ev.UID = dataconv.StarString(it[1])
+		case "summary":
+			ev.Summary = dataconv.StarString(it[1])
+		case "description":
+			ev.Description = dataconv.StarString(it[1])
+		case "location":
+			ev.Location = dataconv.StarString(it[1])
+		case "url":
+			ev.URL = dataconv.StarString(it[1])
+		case "organizer":
+			ev.Organizer = dataconv.StarString(it[1])
+		case "start":
+			ev.Start, err = icalTime(it[1])
+		case "end":
+			ev.End, err = icalTime(it[1])
+		case "duration":
+			duration, err = icalDuration(it[1])
+		case "attendees":
+			l := types.NewOneOrManyNoDefault[starlark.String]()
+			if err = l.Unpack(it[1]); err == nil {
+				ev.Attendees = make([]string, 0, l.Len())
+				for _, a := range l.Slice() {
+					ev.Attendees = append(ev.Attendees, a.GoString())
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ical %s: %w", k, err)
+		}
+	}
+
+	// check and fill the defaults
+	if strings.TrimSpace(ev.Summary) == "" {
+		return nil, fmt.Errorf("ical summary is required")
+	}
+	if ev.Start.IsZero() {
+		return nil, fmt.Errorf("ical start is required")
+	}
+	if ev.End.IsZero() {
+		if duration <= 0 {
+			return nil, fmt.Errorf("ical end or duration is required")
+		}
+		ev.End = ev.Start.Add(duration)
+	}
+	if !ev.End.After(ev.Start) {
+		return nil, fmt.Errorf("ical end must be after start")
+	}
+	if ev.Attendees == nil {
+		ev.Attendees = append(append([]string{}, req.To...), req.Cc...)
+	}
+	if ev.UID == "" {
+		b := make([]byte, 16)
+		if err := base.RandRead(b); err != nil {
+			return nil, err
+		}
+		ev.UID = hex.EncodeToString(b) + "@starport"
+	}
+	return ev, nil
+}
+
+// icalTime converts the time value or the RFC3339 string to time.Time.
+func icalTime(v starlark.Value) (time.Time, error) {
+	switch t := v.(type) {
+	case startime.Time:
+		return time.Time(t), nil
+	case starlark.String:
+		return time.Parse(time.RFC3339, string(t))
+	default:
+		return time.Time{}, fmt.Errorf("must be a time or RFC3339 string, got %s", v.Type())
+	}
+}
+
+// icalDuration converts the duration value, the string like "1h30m", or the number of minutes to time.Duration.
+func icalDuration(v starlark.Value) (time.Duration, error) {
+	switch d := v.(type) {
+	case startime.Duration:
+		return time.Duration(d), nil
+	case starlark.String:
+		return time.ParseDuration(string(d))
+	case starlark.Int:
+		n, ok := d.Int64()
+		if !ok {
+			return 0, fmt.Errorf("too large: %s", d)
+		}
+		return time.Duration(n) * time.Minute, nil
+	default:
+		return 0, fmt.Errorf("must be a duration, string or minutes, got %s", v.Type())
+	}
+}
+
+// icalendar renders the event as an iCalendar object with METHOD:REQUEST, so mail clients show it as an invitation.
+func (ev *calendarEvent) icalendar() (string, error) {
+	var lines []string
+	add := func(name, value string) {
+		lines = append(lines, foldICalLine(name+":"+value))
+	}
+	person := func(prop, addr string, attendee bool) error {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid ical address %q: %w", addr, err)
+		}
+		name := prop
+		if a.Name != "" {
+			name += ";CN=" + quoteICalParam(a.Name)
+		}
+		if attendee {
+			name += ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE"
+		}
+		add(name, "mailto:"+a.Address)
+		return nil
+	}
+
+	add("BEGIN", "VCALENDAR")
+	add("PRODID", "-//PureMature//Starport//EN")
+	add("VERSION", "2.0")
+	add("CALSCALE", "GREGORIAN")
+	add("METHOD", "REQUEST")
+	add("BEGIN", "VEVENT")
+	add("UID", ev.UID)
+	add("DTSTAMP", base.Now().UTC().Format(icalTimeLayout))
+	add("DTSTART", ev.Start.UTC().Format(icalTimeLayout))
+	add("DTEND", ev.End.UTC().Format(icalTimeLayout))
+	add("SUMMARY", escapeICalText(ev.Summary))
+	if ev.Description != "" {
+		add("DESCRIPTION", escapeICalText(ev.Description))
+	}
+	if ev.Location != "" {
+		add("LOCATION", escapeICalText(ev.Location))
+	}
+	if ev.URL != "" {
+		add("URL", ev.URL)
+	}
+	if err := person("ORGANIZER", ev.Organizer, false); err != nil {
+		return "", err
+	}
+	for _, a := range ev.Attendees {
+		if err := person("ATTENDEE", a, true); err != nil {
+			return "", err
+		}
+	}
+	add("SEQUENCE", "0")
+	add("STATUS", "CONFIRMED")
+	add("END", "VEVENT")
+	add("END", "VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
+
+// escapeICalText escapes the backslashes, semicolons, commas and newlines in text values.
+func escapeICalText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// quoteICalParam quotes the parameter value if it contains special characters, and drops the double quotes inside.
+func quoteICalParam(s string) string {
+	s = strings.ReplaceAll(s, `"`, "")
+	if strings.ContainsAny(s, ":;,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// foldICalLine folds the content line longer than 75 octets, the continuation lines start with a space.
+func foldICalLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+	var (
+		sb  strings.Builder
+		cur int
+	)
+	for _, r := range s {
+		n := len(string(r))
+		if cur+n > limit {
+			sb.WriteString("\r\n ")
+			cur = 1
+		}
+		sb.WriteRune(r)
+		cur += n
+	}
+	return sb.String()
+}
+
+// newInviteAttachment returns the invite.ics attachment of the event with the content type of text/calendar.
+func newInviteAttachment(ev *calendarEvent) (*attachment, error) {
+	ics, err := ev.icalendar()
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(ics)
+	return &attachment{
+		Filename:    "invite.ics",
+		Content:     base64.StdEncoding.EncodeToString(data),
+		ContentType: "text/calendar; charset=utf-8; method=REQUEST",
+		data:        data,
+	}, nil
+}
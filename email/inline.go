@@ -0,0 +1,103 @@
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/resend/resend-go/v2"
+	"go.starlark.net/starlark"
+)
+
+var imageSrcPattern = regexp.MustCompile(`(?i)(\ssrc\s*=\s*["'])([^"']+)(["'])`)
+
+// attachment is the attachment sent to Resend API, with the content ID for inline images not supported by the SDK yet.
+type attachment struct {
+	Filename    string `json:"filename,omitempty"`
+	Content     string `json:"content,omitempty"`
+	Path        string `json:"path,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+
+	data []byte // raw content for SMTP
+}
+
+// convertAttachments converts the attachments of the SDK to the ones sent to Resend API, the content is encoded in base64.
+func convertAttachments(atts []*resend.Attachment) []*attachment {
+	res := make([]*attachment, 0, len(atts))
+	for _, a := range atts {
+		res = append(res, &attachment{
+			Filename: a.Filename,
+			Content:  base64.StdEncoding.EncodeToString(a.Content),
+			Path:     a.Path,
+			data:     a.Content,
+		})
+	}
+	return res
+}
+
+// loadInlineImages converts the dict of content IDs and images to attachments. The image is either bytes of the content, or a string of the file path.
+// It also returns the file paths and names mapped to their content IDs, for rewriting the references in HTML body.
+func (m *Module) loadInlineImages(d *starlark.Dict) ([]*attachment, map[string]string, error) {
+	var (
+		atts []*attachment
+		refs = make(map[string]string)
+	)
+	for _, it := range d.Items() {
+		cid, ok := starlark.AsString(it[0])
+		if !ok || strings.TrimSpace(cid) == "" {
+			return nil, nil, fmt.Errorf("inline image content id must be a non-blank string, got %s", it[0])
+		}
+
+		var (
+			data []byte
+			name string
+		)
+		switch v := it[1].(type) {
+		case starlark.Bytes:
+			data = []byte(v)
+			name = cid
+			if exts, _ := mime.ExtensionsByType(http.DetectContentType(data)); len(exts) > 0 {
+				name += exts[0]
+			}
+		case starlark.String:
+			fp := string(v)
+			c, err := m.readAttachmentFile(fp)
+			if err != nil {
+				return nil, nil, err
+			}
+			data = c
+			name = path.Base(strings.TrimPrefix(filepath.ToSlash(fp), charmFilePrefix))
+			refs[fp] = cid
+			refs[name] = cid
+		default:
+			return nil, nil, fmt.Errorf("inline image %q must be bytes or a file path, got %s", cid, it[1].Type())
+		}
+		atts = append(atts, &attachment{
+			Filename:  name,
+			Content:   base64.StdEncoding.EncodeToString(data),
+			ContentID: cid,
+			data:      data,
+		})
+	}
+	return atts, refs, nil
+}
+
+// rewriteInlineRefs rewrites the src attributes in HTML referring to the file paths or names of inline images to "cid:" references.
+func rewriteInlineRefs(html string, refs map[string]string) string {
+	if len(refs) == 0 {
+		return html
+	}
+	return imageSrcPattern.ReplaceAllStringFunc(html, func(s string) string {
+		mt := imageSrcPattern.FindStringSubmatch(s)
+		if cid, ok := refs[mt[2]]; ok {
+			return mt[1] + "cid:" + cid + mt[3]
+		}
+		return s
+	})
+}
@@ -0,0 +1,151 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	renderer "github.com/yuin/goldmark/renderer/html"
+	"go.starlark.net/starlark"
+)
+
+// defaultMarkdownExtensions are the goldmark extensions enabled if markdown_extensions is not set.
+var defaultMarkdownExtensions = []string{"strikethrough", "table", "linkify"}
+
+// markdownExtensions are the supported goldmark extensions by name, except "highlight" which depends on the theme.
+var markdownExtensions = map[string]goldmark.Extender{
+	"strikethrough":   extension.Strikethrough,
+	"table":           extension.Table,
+	"linkify":         extension.Linkify,
+	"tasklist":        extension.TaskList,
+	"footnote":        extension.Footnote,
+	"definition_list": extension.DefinitionList,
+	"typographer":     extension.Typographer,
+	"gfm":             extension.GFM,
+}
+
+// markdownOptions are the options of rendering markdown to HTML.
+type markdownOptions struct {
+	extensions []string
+	theme      string
+	css        string
+}
+
+// SetMarkdownOptions sets the goldmark extensions, the syntax highlighting theme and the CSS stylesheet for rendering markdown bodies.
+// The extensions are strikethrough, table, linkify, tasklist, footnote, definition_list, typographer, gfm and highlight.
+func (m *Module) SetMarkdownOptions(extensions []string, theme, css string) {
+	m.cfgMod.SetConfigValue("markdown_extensions", strings.Join(extensions, ","))
+	m.cfgMod.SetConfigValue("markdown_theme", theme)
+	m.cfgMod.SetConfigValue("markdown_css", css)
+}
+
+// getMarkdownOptions returns the markdown options in config, overridden by the per-call dict with keys of "extensions", "theme" and "css".
+func (m *Module) getMarkdownOptions(d *starlark.Dict) (markdownOptions, error) {
+	opt := markdownOptions{extensions: defaultMarkdownExtensions}
+	if s, err := m.cfgMod.GetConfig("markdown_extensions"); err == nil && strings.TrimSpace(s) != "" {
+		opt.extensions = splitList(s)
+	}
+	opt.theme, _ = m.cfgMod.GetConfig("markdown_theme")
+	opt.css, _ = m.cfgMod.GetConfig("markdown_css")
+	if d == nil {
+		return opt, opt.validate()
+	}
+
+	// override with the per-call options
+	for _, it := range d.Items() {
+		k, ok := starlark.AsString(it[0])
+		if !ok {
+			return opt, fmt.Errorf("markdown option name must be a string, got %s", it[0].Type())
+		}
+		switch k {
+		case "extensions":
+			if s, ok := starlark.AsString(it[1]); ok {
+				opt.extensions = splitList(s)
+				break
+			}
+			l, ok := it[1].(starlark.Iterable)
+			if !ok {
+				return opt, fmt.Errorf("markdown extensions must be a string or a list of strings, got %s", it[1].Type())
+			}
+			opt.extensions = nil
+			var v starlark.Value
+			iter := l.Iterate()
+			for iter.Next(&v) {
+				opt.extensions = append(opt.extensions, strings.TrimSpace(dataconv.StarString(v)))
+			}
+			iter.Done()
+		case "theme":
+			opt.theme = dataconv.StarString(it[1])
+		case "css":
+			opt.css = dataconv.StarString(it[1])
+		default:
+			return opt, fmt.Errorf("unknown markdown option: %s", k)
+		}
+	}
+	return opt, opt.validate()
+}
+
+// validate checks the extension names and the theme.
+func (o markdownOptions) validate() error {
+	for _, e := range o.extensions {
+		if _, ok := markdownExtensions[e]; !ok && e != "highlight" {
+			return fmt.Errorf("unsupported markdown extension: %s", e)
+		}
+	}
+	if o.theme != "" && styles.Get(o.theme) == styles.Fallback && o.theme != "swapoff" {
+		return fmt.Errorf("unknown highlight theme: %s", o.theme)
+	}
+	return nil
+}
+
+// splitList splits the comma-separated list and trims the items, empty items are dropped.
+func splitList(s string) []string {
+	var res []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// markdownToHTML converts the markdown content to HTML with raw HTML kept, the extensions and stylesheet are set in the options.
+// Code blocks are highlighted with inline styles if the highlight extension is enabled, since many email clients drop style classes.
+func markdownToHTML(md string, opt markdownOptions) (string, error) {
+	var exts []goldmark.Extender
+	for _, e := range opt.extensions {
+		if e == "highlight" {
+			theme := opt.theme
+			if theme == "" {
+				theme = "github"
+			}
+			exts = append(exts, highlighting.NewHighlighting(
+				highlighting.WithStyle(theme),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(false)),
+			))
+			continue
+		}
+		exts = append(exts, markdownExtensions[e])
+	}
+	markdown := goldmark.New(
+		goldmark.WithRendererOptions(
+			renderer.WithUnsafe(),
+		),
+		goldmark.WithExtensions(exts...),
+	)
+	out := bytes.NewBufferString("")
+	if opt.css != "" {
+		// keep the stylesheet from closing the style element
+		out.WriteString("<style>" + strings.ReplaceAll(opt.css, "</", "<\\/") + "</style>\n")
+	}
+	if err := markdown.Convert([]byte(md), out); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,78 @@
+package email
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// plainTextWidth is the line width of the plain-text alternative generated from HTML.
+const plainTextWidth = 76
+
+var (
+	htmlInvisiblePattern = regexp.MustCompile(`(?is)<(head|script|style|title)\b[^>]*>.*?</(head|script|style|title)\s*>|<!--.*?-->`)
+	htmlLinkPattern      = regexp.MustCompile(`(?is)<a\b[^>]*\bhref\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a\s*>`)
+	htmlImagePattern     = regexp.MustCompile(`(?is)<img\b[^>]*\balt\s*=\s*["']([^"']*)["'][^>]*>`)
+	htmlListItemPattern  = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	htmlLineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlBlockEndPattern  = regexp.MustCompile(`(?i)</?(p|div|h[1-6]|ul|ol|table|tr|blockquote|pre|hr|section|article|header|footer)\b[^>]*>`)
+	htmlTagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRunPattern      = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLinesPattern    = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToPlainText converts the HTML body to a plain-text alternative: tags are stripped, links are kept as "text (url)",
+// block elements start new lines, and long lines are wrapped.
+func htmlToPlainText(s string) string {
+	// drop invisible parts, and keep the targets of links and the alt of images
+	s = htmlInvisiblePattern.ReplaceAllString(s, "")
+	s = htmlLinkPattern.ReplaceAllStringFunc(s, func(a string) string {
+		mt := htmlLinkPattern.FindStringSubmatch(a)
+		href, text := mt[1], strings.TrimSpace(htmlTagPattern.ReplaceAllString(mt[2], ""))
+		if text == "" || text == href || strings.HasPrefix(href, "cid:") {
+			return text
+		}
+		return text + " (" + href + ")"
+	})
+	s = htmlImagePattern.ReplaceAllString(s, "$1")
+
+	// collapse the source whitespace, and turn the structure into line breaks
+	s = strings.ReplaceAll(s, "\n", " ")
+	s = htmlListItemPattern.ReplaceAllString(s, "\n- ")
+	s = htmlLineBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlBlockEndPattern.ReplaceAllString(s, "\n\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = spaceRunPattern.ReplaceAllString(s, " ")
+
+	// trim and wrap the lines
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = wrapLine(strings.TrimSpace(l), plainTextWidth)
+	}
+	s = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(s) + "\n"
+}
+
+// wrapLine wraps the line at word boundaries to the width, words longer than the width are kept as they are.
+func wrapLine(line string, width int) string {
+	if len(line) <= width {
+		return line
+	}
+	var (
+		sb  strings.Builder
+		cur int
+	)
+	for _, w := range strings.Fields(line) {
+		if cur > 0 && cur+1+len(w) > width {
+			sb.WriteString("\n")
+			cur = 0
+		} else if cur > 0 {
+			sb.WriteString(" ")
+			cur++
+		}
+		sb.WriteString(w)
+		cur += len(w)
+	}
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/1set/gut/ystring"
+)
+
+// senderProfile is the named sender identity in sender_profiles config, which bundles the from address, reply-to address and display name.
+// The addresses are either full addresses or name IDs at the sender domain.
+type senderProfile struct {
+	From    string `json:"from"`
+	ReplyTo string `json:"reply_to,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// SetSenderProfile registers the sender profile by name, e.g. "alerts" or "billing", which is selected by from_profile in send and broadcast.
+// The from and reply-to addresses can be name IDs at the sender domain, and the display name is optional.
+func (m *Module) SetSenderProfile(profile, from, replyTo, displayName string) error {
+	profiles, err := m.getSenderProfiles()
+	if err != nil {
+		return err
+	}
+	if profiles == nil {
+		profiles = make(map[string]*senderProfile)
+	}
+	profiles[profile] = &senderProfile{From: from, ReplyTo: replyTo, Name: displayName}
+	bs, err := json.Marshal(profiles)
+	if err != nil {
+		return err
+	}
+	m.cfgMod.SetConfigValue("sender_profiles", string(bs))
+	return nil
+}
+
+// getSenderProfiles returns the sender profiles in sender_profiles config, which is a JSON object of profiles by name.
+func (m *Module) getSenderProfiles() (map[string]*senderProfile, error) {
+	s, err := m.cfgMod.GetConfig("sender_profiles")
+	if err != nil || strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var profiles map[string]*senderProfile
+	if err := json.Unmarshal([]byte(s), &profiles); err != nil {
+		return nil, fmt.Errorf("invalid sender_profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// resolveSenderProfile returns the from and reply-to addresses of the sender profile, with the display name of the profile.
+// It returns empty strings if the profile name is blank.
+func (m *Module) resolveSenderProfile(profile, senderDomain string) (from, replyTo string, err error) {
+	if ystring.IsBlank(profile) {
+		return "", "", nil
+	}
+	profiles, err := m.getSenderProfiles()
+	if err != nil {
+		return "", "", err
+	}
+	p, ok := profiles[profile]
+	if !ok || p == nil {
+		return "", "", fmt.Errorf("sender profile not found: %s", profile)
+	}
+
+	// the addresses without @ are name IDs at the sender domain
+	resolve := func(addr string) (string, error) {
+		if strings.Contains(addr, "@") {
+			return addr, nil
+		}
+		return resolveAddress("", addr, senderDomain, "from_profile")
+	}
+	if from, err = resolve(p.From); err != nil {
+		return "", "", err
+	}
+	if from == "" {
+		return "", "", fmt.Errorf("sender profile %s has no from address", profile)
+	}
+	if replyTo, err = resolve(p.ReplyTo); err != nil {
+		return "", "", err
+	}
+
+	// apply the display name to the from address
+	if p.Name != "" {
+		a, err := mail.ParseAddress(from)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid from address of sender profile %s: %w", profile, err)
+		}
+		a.Name = p.Name
+		from = a.String()
+	}
+	return from, replyTo, nil
+}
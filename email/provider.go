@@ -0,0 +1,164 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	"go.starlark.net/starlark"
+)
+
+const (
+	providerResend   = "resend"
+	providerSMTP     = "smtp"
+	providerSendGrid = "sendgrid"
+	providerSES      = "ses"
+)
+
+// provider sends the rendered emails via a mail service, the credentials are loaded from config when sending.
+type provider interface {
+	// name returns the name of provider in email_provider config.
+	name() string
+	// check reports the features in the request not supported by the provider, it's called before previewing or sending.
+	check(req *sendEmailRequest) error
+	// send sends the request, and returns the response with the message ID.
+	send(ctx context.Context, req *sendEmailRequest, idempotencyKey string) (*sendResponse, error)
+}
+
+// sendResponse is the response of the provider for the sent email, the HTTP status, headers and body are set for the providers of web API.
+type sendResponse struct {
+	Provider   string            `json:"provider"`
+	ID         string            `json:"id"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       interface{}       `json:"body,omitempty"`
+}
+
+// newHTTPSendResponse returns the response of the provider with the HTTP status, headers, and body decoded from JSON if possible.
+func newHTTPSendResponse(provider, id string, resp *http.Response, body []byte) *sendResponse {
+	sr := &sendResponse{Provider: provider, ID: id}
+	if resp == nil {
+		return sr
+	}
+	sr.StatusCode = resp.StatusCode
+	sr.Headers = make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		sr.Headers[k] = resp.Header.Get(k)
+	}
+	if len(body) > 0 {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			sr.Body = v
+		} else {
+			sr.Body = string(body)
+		}
+	}
+	return sr
+}
+
+// toStarlark converts the response to a Starlark dict.
+func (r *sendResponse) toStarlark() (starlark.Value, error) {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return starlark.None, err
+	}
+	return dataconv.UnmarshalStarlarkJSON(bs)
+}
+
+// getProvider returns the email provider in config, Resend is the default.
+func (m *Module) getProvider() (provider, error) {
+	p, err := m.cfgMod.GetConfig("email_provider")
+	if err != nil || p == "" {
+		return &resendProvider{m: m}, nil
+	}
+	switch p = strings.ToLower(strings.TrimSpace(p)); p {
+	case providerResend:
+		return &resendProvider{m: m}, nil
+	case providerSMTP:
+		return &smtpProvider{m: m}, nil
+	case providerSendGrid:
+		return &sendgridProvider{m: m}, nil
+	case providerSES:
+		return &sesProvider{m: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported email provider: %s", p)
+	}
+}
+
+// sendWithRetry sends the request via the provider for at most the given times, and waits with exponential backoff between the attempts.
+// Only the transient errors like network errors, rate limits and server errors are retried.
+func sendWithRetry(ctx context.Context, p provider, req *sendEmailRequest, idempotencyKey string, times int, backoff time.Duration) (resp *sendResponse, err error) {
+	for i := 0; i < times; i++ {
+		if i > 0 {
+			// wait longer for each retry, e.g. rate limited
+			if err := sleepContext(ctx, jitter(backoff<<(i-1))); err != nil {
+				return nil, err
+			}
+			log.Debugw("retry sending email", "provider", p.name(), "attempt", i+1, "error", err)
+		}
+		resp, err = p.send(ctx, req, idempotencyKey)
+		// if no error or not transient, break the loop, no need to retry
+		if err == nil || !isTransientError(err) {
+			break
+		}
+	}
+	return resp, err
+}
+
+// resendProvider sends emails via Resend API with resend_api_key in config.
+type resendProvider struct {
+	m *Module
+}
+
+func (p *resendProvider) name() string {
+	return providerResend
+}
+
+func (p *resendProvider) check(req *sendEmailRequest) error {
+	return nil
+}
+
+func (p *resendProvider) send(ctx context.Context, req *sendEmailRequest, idempotencyKey string) (*sendResponse, error) {
+	if req.tracking != nil {
+		log.Warnw("tracking is configured per domain by resend provider", "tracking", req.tracking)
+	}
+	client, err := p.m.newClient()
+	if err != nil {
+		return nil, err
+	}
+	return sendEmail(ctx, client, req, idempotencyKey)
+}
+
+// smtpProvider sends emails via the SMTP server in config.
+type smtpProvider struct {
+	m *Module
+}
+
+func (p *smtpProvider) name() string {
+	return providerSMTP
+}
+
+func (p *smtpProvider) check(req *sendEmailRequest) error {
+	if req.ScheduledAt != "" {
+		return fmt.Errorf("scheduled_at is not supported by smtp provider")
+	}
+	return nil
+}
+
+func (p *smtpProvider) send(ctx context.Context, req *sendEmailRequest, idempotencyKey string) (*sendResponse, error) {
+	if idempotencyKey != "" {
+		log.Warnw("idempotency_key is ignored by smtp provider", "key", idempotencyKey)
+	}
+	if req.tracking != nil {
+		log.Warnw("tracking is ignored by smtp provider", "tracking", req.tracking)
+	}
+	msgID, err := p.m.sendSMTP(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &sendResponse{Provider: providerSMTP, ID: msgID}, nil
+}
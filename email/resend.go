@@ -2,10 +2,18 @@
 package email
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/1set/gut/ystring"
 	"github.com/1set/starlet"
@@ -14,9 +22,6 @@ import (
 	"github.com/PureMature/starport/base"
 	"github.com/resend/resend-go/v2"
 	"github.com/samber/lo"
-	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/extension"
-	renderer "github.com/yuin/goldmark/renderer/html"
 	"go.starlark.net/starlark"
 )
 
@@ -25,7 +30,23 @@ const ModuleName = "email"
 
 // Module wraps the ConfigurableModule with specific functionality for sending emails.
 type Module struct {
-	cfgMod *base.ConfigurableModule[string]
+	cfgMod  *base.ConfigurableModule[string]
+	charmFS FileReader
+}
+
+// FileReader reads the content of files from a remote storage, e.g. the cfs module for Charm FS.
+type FileReader interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// SetCharmFS sets the reader for attachment files prefixed with "charm://".
+func (m *Module) SetCharmFS(r FileReader) {
+	m.charmFS = r
+}
+
+// SetDefaultKwarg sets the default value of the keyword argument for the function, e.g. from_id for send. Nil value removes the default.
+func (m *Module) SetDefaultKwarg(funcName, argName string, value starlark.Value) {
+	m.cfgMod.SetDefaultKwarg(funcName, argName, value)
 }
 
 // NewModule creates a new instance of Module.
@@ -50,21 +71,45 @@ func NewModuleWithGetter(resendAPIKey, senderDomain base.ConfigGetter[string]) *
 	return &Module{cfgMod: cm}
 }
 
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"send":          {"subject", "html", "text", "markdown", "markdown_options", "inline_assets", "template", "data", "to", "cc", "bcc", "from", "from_id", "from_profile", "reply_to", "reply_id", "in_reply_to", "references", "attachment_file", "attachment", "inline_images", "ical", "scheduled_at", "idempotency_key", "auto_text", "preview", "compress", "retry", "retry_backoff", "full_response", "track_opens", "track_clicks"},
+	"send_all":      {"messages", "per_second", "retry"},
+	"get":           {"id"},
+	"cancel":        {"id"},
+	"create_domain": {"name", "region"},
+	"verify_domain": {"id"},
+	"broadcast":     {"audience", "subject", "html", "text", "markdown", "markdown_options", "from", "from_id", "from_profile", "reply_to", "reply_id", "name", "scheduled_at"},
+	"render":        {"template", "data"},
+	"validate":      {"address", "check_mx"},
+	"parse_event":   {"payload", "signature", "secret"},
+}
+
 // LoadModule returns the Starlark module loader with the email-specific functions.
 func (m *Module) LoadModule() starlet.ModuleLoader {
 	additionalFuncs := starlark.StringDict{
-		"send": m.genSendFunc(),
+		"send":          m.genSendFunc(),
+		"send_all":      m.genSendAllFunc(),
+		"get":           m.genGetFunc(),
+		"cancel":        m.genCancelFunc(),
+		"list_domains":  m.genListDomainsFunc(),
+		"create_domain": m.genCreateDomainFunc(),
+		"verify_domain": m.genVerifyDomainFunc(),
+		"broadcast":     m.genBroadcastFunc(),
+		"render":        m.genRenderFunc(),
+		"validate":      m.genValidateFunc(),
+		"parse_event":   m.genParseEventFunc(),
 	}
-	return m.cfgMod.LoadModule(ModuleName, additionalFuncs)
+	return m.cfgMod.LoadModule(ModuleName, additionalFuncs, funcParams)
 }
 
 // genSendFunc generates the Starlark callable function to send an email.
 func (m *Module) genSendFunc() starlark.Callable {
 	return starlark.NewBuiltin(ModuleName+".send", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-		// Load config: resend_api_key is required, sender_domain is optional
-		resendAPIKey, err := m.cfgMod.GetConfig("resend_api_key")
+		// Load config: the credentials of provider are loaded when sending, sender_domain is optional
+		provider, err := m.getProvider()
 		if err != nil {
-			return starlark.None, fmt.Errorf("resend_api_key is not set")
+			return starlark.None, err
 		}
 		senderDomain, _ := m.cfgMod.GetConfig("sender_domain")
 
@@ -72,64 +117,104 @@ func (m *Module) genSendFunc() starlark.Callable {
 		newOneOrListStr := func() *types.OneOrMany[starlark.String] { return types.NewOneOrManyNoDefault[starlark.String]() }
 		var (
 			subject            types.StringOrBytes         // must be set
-			bodyHTML           types.NullableStringOrBytes // one of the three must be set
+			bodyHTML           types.NullableStringOrBytes // one of the four must be set
 			bodyText           types.NullableStringOrBytes
 			bodyMarkdown       types.NullableStringOrBytes
+			bodyTemplate       types.NullableStringOrBytes
 			toAddresses        = newOneOrListStr() // must be set
 			ccAddresses        = newOneOrListStr()
 			bccAddresses       = newOneOrListStr()
 			fromAddress        types.StringOrBytes // one of the two must be set
 			fromNameID         types.StringOrBytes
+			fromProfile        types.StringOrBytes
 			replyAddress       types.StringOrBytes // two of them are optional
 			replyNameID        types.StringOrBytes
 			attachmentFiles    = newOneOrListStr()
 			attachmentContents = types.NewOneOrManyNoDefault[*starlark.Dict]()
+			scheduledAt        types.NullableStringOrBytes
+			inlineImages       types.NullableDict
+			idempotencyKey     starlark.Value = starlark.None
+			templateData       starlark.Value = starlark.None
+			markdownOpts       types.NullableDict
+			autoText           = true
+			preview            = false
+			compress           = false
+			retryTimes         = 1
+			retryBackoff       = types.FloatOrInt(1)
+			fullResponse       = false
+			inReplyTo          types.StringOrBytes
+			references         = newOneOrListStr()
+			icalEvent          types.NullableDict
+			inlineAssets       starlark.Value = starlark.None
+			trackOpens         starlark.Value = starlark.None
+			trackClicks        starlark.Value = starlark.None
 		)
 		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
 			"subject", &subject,
-			"html?", &bodyHTML, "text?", &bodyText, "markdown?", &bodyMarkdown,
+			"html?", &bodyHTML, "text?", &bodyText, "markdown?", &bodyMarkdown, "markdown_options?", &markdownOpts, "inline_assets?", &inlineAssets, "template?", &bodyTemplate, "data?", &templateData,
 			"to", toAddresses, "cc?", ccAddresses, "bcc?", bccAddresses,
-			"from?", &fromAddress, "from_id?", &fromNameID,
+			"from?", &fromAddress, "from_id?", &fromNameID, "from_profile?", &fromProfile,
 			"reply_to?", &replyAddress, "reply_id?", &replyNameID,
-			"attachment_file?", attachmentFiles, "attachment?", attachmentContents); err != nil {
+			"in_reply_to?", &inReplyTo, "references?", references,
+			"attachment_file?", attachmentFiles, "attachment?", attachmentContents, "inline_images?", &inlineImages, "ical?", &icalEvent,
+			"scheduled_at?", &scheduledAt, "idempotency_key?", &idempotencyKey, "auto_text?", &autoText, "preview?", &preview, "compress?", &compress,
+			"retry?", &retryTimes, "retry_backoff?", &retryBackoff, "full_response?", &fullResponse,
+			"track_opens?", &trackOpens, "track_clicks?", &trackClicks); err != nil {
 			return starlark.None, err
 		}
 
 		// validate args
-		if body := []string{bodyHTML.GoString(), bodyText.GoString(), bodyMarkdown.GoString()}; lo.EveryBy(body, ystring.IsBlank) {
-			return starlark.None, fmt.Errorf("one of body_html, body_text, or body_markdown must be non-blank")
+		if body := []string{bodyHTML.GoString(), bodyText.GoString(), bodyMarkdown.GoString(), bodyTemplate.GoString()}; lo.EveryBy(body, ystring.IsBlank) {
+			return starlark.None, fmt.Errorf("one of body_html, body_text, body_markdown, or template must be non-blank")
+		}
+		if templateData != starlark.None && bodyTemplate.IsNullOrEmpty() {
+			return starlark.None, fmt.Errorf("data is only used with template")
+		}
+		assetMode, err := parseAssetMode(inlineAssets)
+		if err != nil {
+			return starlark.None, err
+		}
+		if assetMode != "" && bodyMarkdown.IsNullOrEmpty() {
+			return starlark.None, fmt.Errorf("inline_assets is only used with markdown")
+		}
+		if retryTimes < 1 {
+			return starlark.None, fmt.Errorf("retry must be at least 1, got %d", retryTimes)
+		}
+		if retryBackoff < 0 {
+			return starlark.None, fmt.Errorf("retry_backoff must be non-negative, got %v", retryBackoff)
 		}
 		if toAddresses.Len() == 0 {
 			return starlark.None, fmt.Errorf("to must be set and non-empty")
 		}
-		if from := []string{fromAddress.GoString(), fromNameID.GoString()}; lo.EveryBy(from, ystring.IsBlank) {
-			return starlark.None, fmt.Errorf("one of from or from_id must be non-blank")
+		if from := []string{fromAddress.GoString(), fromNameID.GoString(), fromProfile.GoString()}; lo.EveryBy(from, ystring.IsBlank) {
+			return starlark.None, fmt.Errorf("one of from, from_id or from_profile must be non-blank")
+		}
+
+		// load the sender profile, its addresses are used if not given
+		profileFrom, profileReply, err := m.resolveSenderProfile(fromProfile.GoString(), senderDomain)
+		if err != nil {
+			return starlark.None, err
 		}
 
 		// convert from to send address
-		var sendAddr string
-		if fa := fromAddress.GoString(); ystring.IsNotBlank(fa) {
-			sendAddr = fa
-		} else if fi := fromNameID.GoString(); ystring.IsNotBlank(fi) {
-			if ystring.IsNotBlank(senderDomain) {
-				sendAddr = fi + "@" + senderDomain
-			} else {
-				return starlark.None, fmt.Errorf("sender_domain should be set when from_id is used")
-			}
-		} else {
+		sendAddr, err := resolveAddress(fromAddress.GoString(), fromNameID.GoString(), senderDomain, "from_id")
+		if err != nil {
+			return starlark.None, err
+		}
+		if sendAddr == "" {
+			sendAddr = profileFrom
+		}
+		if sendAddr == "" {
 			return starlark.None, fmt.Errorf("no valid from or from_id found")
 		}
 
 		// convert from to reply address
-		var replyAddr string
-		if ra := replyAddress.GoString(); ystring.IsNotBlank(ra) {
-			replyAddr = ra
-		} else if ri := replyNameID.GoString(); ystring.IsNotBlank(ri) {
-			if ystring.IsNotBlank(senderDomain) {
-				replyAddr = ri + "@" + senderDomain
-			} else {
-				return starlark.None, fmt.Errorf("sender_domain should be set when reply_id is used")
-			}
+		replyAddr, err := resolveAddress(replyAddress.GoString(), replyNameID.GoString(), senderDomain, "reply_id")
+		if err != nil {
+			return starlark.None, err
+		}
+		if replyAddr == "" {
+			replyAddr = profileReply
 		}
 
 		// prepare request
@@ -149,40 +234,80 @@ func (m *Module) genSendFunc() starlark.Callable {
 			Subject: subject.GoString(),
 		}
 
+		// for threading, the message IDs are wrapped in angle brackets
+		if id := inReplyTo.GoString(); ystring.IsNotBlank(id) {
+			wid, err := wrapMessageID(id)
+			if err != nil {
+				return starlark.None, fmt.Errorf("in_reply_to: %w", err)
+			}
+			req.Headers = map[string]string{"In-Reply-To": wid}
+		}
+		if refs := references.Slice(); len(refs) > 0 {
+			ids := make([]string, 0, len(refs))
+			for _, r := range refs {
+				if ystring.IsNotBlank(string(r)) {
+					wid, err := wrapMessageID(string(r))
+					if err != nil {
+						return starlark.None, fmt.Errorf("references: %w", err)
+					}
+					ids = append(ids, wid)
+				}
+			}
+			if req.Headers == nil {
+				req.Headers = make(map[string]string)
+			}
+			req.Headers["References"] = strings.Join(ids, " ")
+		} else if req.Headers != nil {
+			// the replied message starts the references if not given
+			req.Headers["References"] = req.Headers["In-Reply-To"]
+		}
+
 		// for body content
 		if !bodyHTML.IsNullOrEmpty() {
 			// directly use HTML content
 			req.Html = bodyHTML.GoString()
-		} else if !bodyText.IsNullOrEmpty() {
-			// directly use text content
-			req.Text = bodyText.GoString()
 		} else if !bodyMarkdown.IsNullOrEmpty() {
 			// convert markdown to HTML
-			markdown := goldmark.New(
-				goldmark.WithRendererOptions(
-					renderer.WithUnsafe(),
-				),
-				goldmark.WithExtensions(
-					extension.Strikethrough,
-					extension.Table,
-					extension.Linkify,
-				),
-			)
-			html := bytes.NewBufferString("")
-			_ = markdown.Convert([]byte(bodyMarkdown.GoString()), html)
-			req.Html = html.String()
+			opt, err := m.getMarkdownOptions(markdownOpts.Value())
+			if err != nil {
+				return starlark.None, err
+			}
+			if req.Html, err = markdownToHTML(bodyMarkdown.GoString(), opt); err != nil {
+				return starlark.None, err
+			}
+		} else if !bodyTemplate.IsNullOrEmpty() {
+			// render HTML template with data
+			html, err := renderTemplate(bodyTemplate.GoString(), templateData)
+			if err != nil {
+				return starlark.None, err
+			}
+			req.Html = html
 		}
+		if !bodyText.IsNullOrEmpty() {
+			// directly use text content, as the alternative of HTML if both are set
+			req.Text = bodyText.GoString()
+		} else if req.Html != "" && autoText {
+			// generate the plain-text alternative from HTML
+			req.Text = htmlToPlainText(req.Html)
+		}
+
+		// keep secrets out of the subject and body
+		guarded, err := m.cfgMod.GuardSecrets(req.Subject, req.Html, req.Text)
+		if err != nil {
+			return starlark.None, err
+		}
+		req.Subject, req.Html, req.Text = guarded[0], guarded[1], guarded[2]
 
 		// for attachments
 		if fps := attachmentFiles.Slice(); len(fps) > 0 {
 			// load file content and attach
 			for _, r := range fps {
 				fp := r.GoString()
-				c, err := ioutil.ReadFile(fp)
+				c, err := m.readAttachmentFile(fp)
 				if err != nil {
 					return starlark.None, err
 				}
-				n := filepath.Base(fp)
+				n := path.Base(strings.TrimPrefix(filepath.ToSlash(fp), charmFilePrefix))
 				req.Attachments = append(req.Attachments, &resend.Attachment{
 					Filename: n,
 					Content:  c,
@@ -190,30 +315,361 @@ func (m *Module) genSendFunc() starlark.Callable {
 			}
 		}
 		if dcts := attachmentContents.Slice(); len(dcts) > 0 {
-			// convert dict to attachment and attach
+			// convert dict to attachment and attach, the content is given or downloaded from the url
 			for _, r := range dcts {
-				fn, ok, err := r.Get(starlark.String("name"))
-				if !ok || err != nil {
-					return starlark.None, fmt.Errorf("attachment must have a name")
+				var name string
+				if fn, ok, err := r.Get(starlark.String("name")); ok && err == nil {
+					name = dataconv.StarString(fn)
 				}
-				ct, ok, err := r.Get(starlark.String("content"))
-				if !ok || err != nil {
-					return starlark.None, fmt.Errorf("attachment must have content")
+				var content []byte
+				if u, ok, err := r.Get(starlark.String("url")); ok && err == nil {
+					data, un, err := downloadAttachment(dataconv.GetThreadContext(thread), dataconv.StarString(u))
+					if err != nil {
+						return starlark.None, err
+					}
+					content = data
+					if name == "" {
+						name = un
+					}
+				} else if ct, ok, err := r.Get(starlark.String("content")); ok && err == nil {
+					content = []byte(dataconv.StarString(ct))
+				} else {
+					return starlark.None, fmt.Errorf("attachment must have content or url")
+				}
+				if name == "" {
+					return starlark.None, fmt.Errorf("attachment must have a name")
 				}
 				req.Attachments = append(req.Attachments, &resend.Attachment{
-					Filename: dataconv.StarString(fn),
-					Content:  []byte(dataconv.StarString(ct)),
+					Filename: name,
+					Content:  content,
 				})
 			}
 		}
 
-		// send it
+		// for inline images, referred by "cid:" or the file path in HTML body
+		sendReq := &sendEmailRequest{SendEmailRequest: req, Attachments: convertAttachments(req.Attachments)}
+		if ii := inlineImages.Value(); ii != nil && ii.Len() > 0 {
+			if req.Html == "" {
+				return starlark.None, fmt.Errorf("inline_images requires html or markdown body")
+			}
+			atts, refs, err := m.loadInlineImages(ii)
+			if err != nil {
+				return starlark.None, err
+			}
+			sendReq.Attachments = append(sendReq.Attachments, atts...)
+			req.Html = rewriteInlineRefs(req.Html, refs)
+		}
+
+		// for images in markdown, embedded so they still show when the recipient blocks remote content
+		if assetMode != "" && req.Html != "" {
+			html, atts, err := m.embedAssets(dataconv.GetThreadContext(thread), req.Html, assetMode)
+			if err != nil {
+				return starlark.None, err
+			}
+			req.Html = html
+			sendReq.Attachments = append(sendReq.Attachments, atts...)
+		}
+
+		// check the size of attachments, zip them if required
+		if sendReq.Attachments, err = limitAttachments(sendReq.Attachments, compress); err != nil {
+			return starlark.None, err
+		}
+
+		// keep the recipients in the allowlist, e.g. in staging environments, before they become the default attendees of invitation
+		if err := m.limitRecipients(sendReq); err != nil {
+			return starlark.None, err
+		}
+
+		// for meeting invitation, attached as a calendar part rendered natively by mail clients, it is small and never zipped
+		if d := icalEvent.Value(); d != nil {
+			ev, err := parseCalendarEvent(d, sendReq)
+			if err != nil {
+				return starlark.None, err
+			}
+			inv, err := newInviteAttachment(ev)
+			if err != nil {
+				return starlark.None, err
+			}
+			sendReq.Attachments = append(sendReq.Attachments, inv)
+		}
+
+		// for scheduled delivery
+		if !scheduledAt.IsNullOrEmpty() {
+			sa, err := parseScheduledAt(scheduledAt.GoString(), base.Now())
+			if err != nil {
+				return starlark.None, err
+			}
+			sendReq.ScheduledAt = sa
+		}
+
+		// for open and click tracking, the defaults in config are used if not given
+		if sendReq.tracking, err = m.getTracking(trackOpens, trackClicks); err != nil {
+			return starlark.None, err
+		}
+
+		// for idempotency key: use the given one, or generate from the request if True
+		var idemKey string
+		switch k := idempotencyKey.(type) {
+		case starlark.NoneType:
+		case starlark.Bool:
+			if k {
+				if idemKey, err = generateIdempotencyKey(sendReq); err != nil {
+					return starlark.None, err
+				}
+			}
+		case starlark.String:
+			idemKey = string(k)
+		default:
+			return starlark.None, fmt.Errorf("idempotency_key must be a string, bool or None, got %s", idempotencyKey.Type())
+		}
+		if len(idemKey) > maxIdempotencyKeyLen {
+			return starlark.None, fmt.Errorf("idempotency_key must be at most %d characters", maxIdempotencyKeyLen)
+		}
+
+		// check the features supported by the provider
+		if err := provider.check(sendReq); err != nil {
+			return starlark.None, err
+		}
+
+		// return the rendered message without sending it, no credentials are required
+		if preview {
+			return previewToStarlark(provider.name(), sendReq, idemKey)
+		}
+
+		// send it via the provider with retries on transient errors
+		backoff := time.Duration(retryBackoff.GoFloat64() * float64(time.Second))
+		resp, err := sendWithRetry(dataconv.GetThreadContext(thread), provider, sendReq, idemKey, retryTimes, backoff)
+		if err != nil {
+			return starlark.None, err
+		}
+
+		// return the response: if fullResponse is set, return the full response, otherwise return the message ID
+		if fullResponse {
+			return resp.toStarlark()
+		}
+		return starlark.String(resp.ID), nil
+	})
+}
+
+const charmFilePrefix = "charm://"
+
+// resolveAddress returns the address if it's set, or the name ID at the sender domain. It returns empty string if neither is set.
+func resolveAddress(addr, nameID, senderDomain, idArg string) (string, error) {
+	if ystring.IsNotBlank(addr) {
+		return addr, nil
+	}
+	if ystring.IsBlank(nameID) {
+		return "", nil
+	}
+	if ystring.IsBlank(senderDomain) {
+		return "", fmt.Errorf("sender_domain should be set when %s is used", idArg)
+	}
+	return nameID + "@" + senderDomain, nil
+}
+
+// wrapMessageID returns the message ID wrapped in angle brackets as required in In-Reply-To and References headers.
+// The ID with line breaks is rejected, since it would inject headers into the message.
+func wrapMessageID(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if strings.ContainsAny(id, "\r\n") {
+		return "", fmt.Errorf("invalid message ID with line breaks: %q", id)
+	}
+	if strings.HasPrefix(id, "<") && strings.HasSuffix(id, ">") {
+		return id, nil
+	}
+	return "<" + id + ">", nil
+}
+
+// readAttachmentFile reads the attachment file from local disk, or from Charm FS if it's prefixed with "charm://".
+func (m *Module) readAttachmentFile(fp string) ([]byte, error) {
+	if !strings.HasPrefix(fp, charmFilePrefix) {
+		return ioutil.ReadFile(fp)
+	}
+	if m.charmFS == nil {
+		return nil, fmt.Errorf("charm fs is not set for attachment: %s", fp)
+	}
+	return m.charmFS.ReadFile(strings.TrimPrefix(fp, charmFilePrefix))
+}
+
+// sendEmailRequest extends the Resend request with the fields not supported by the SDK yet.
+type sendEmailRequest struct {
+	*resend.SendEmailRequest
+	Attachments []*attachment `json:"attachments,omitempty"`
+	ScheduledAt string        `json:"scheduled_at,omitempty"`
+
+	tracking *trackingSettings // applied by the providers supporting per-message tracking
+}
+
+const maxIdempotencyKeyLen = 256
+
+// generateIdempotencyKey returns the key derived from the content of the request, so the same email sent by a retried script gets the same key.
+func generateIdempotencyKey(params *sendEmailRequest) (string, error) {
+	bs, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(bs)
+	return "starport-" + hex.EncodeToString(h[:]), nil
+}
+
+// sendEmail sends the email request to Resend API directly, since the SDK doesn't accept the extended fields.
+// The idempotency key is sent as header if it's not empty.
+func sendEmail(ctx context.Context, client *resend.Client, params *sendEmailRequest, idempotencyKey string) (*sendResponse, error) {
+	req, err := client.NewRequest(ctx, http.MethodPost, "emails", params)
+	if err != nil {
+		return nil, resend.ErrFailedToCreateEmailsSendRequest
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	var body json.RawMessage
+	resp, err := client.Perform(req, &body)
+	if err != nil {
+		return nil, err
+	}
+	sent := new(resend.SendEmailResponse)
+	if err := json.Unmarshal(body, sent); err != nil {
+		return nil, err
+	}
+	return newHTTPSendResponse(providerResend, sent.Id, resp, body), nil
+}
+
+// emailPreview is the fully-rendered email returned in preview mode instead of sending it.
+type emailPreview struct {
+	Provider       string            `json:"provider"`
+	From           string            `json:"from"`
+	To             []string          `json:"to"`
+	Cc             []string          `json:"cc,omitempty"`
+	Bcc            []string          `json:"bcc,omitempty"`
+	ReplyTo        string            `json:"reply_to,omitempty"`
+	Subject        string            `json:"subject"`
+	Html           string            `json:"html,omitempty"`
+	Text           string            `json:"text,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Attachments    []string          `json:"attachments,omitempty"`
+	InlineImages   []string          `json:"inline_images,omitempty"`
+	ScheduledAt    string            `json:"scheduled_at,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Tracking       *trackingSettings `json:"tracking,omitempty"`
+}
+
+// previewToStarlark converts the request to the preview dict, with the names of attachments and the content IDs of inline images.
+func previewToStarlark(provider string, req *sendEmailRequest, idempotencyKey string) (starlark.Value, error) {
+	pv := &emailPreview{
+		Provider:       provider,
+		From:           req.From,
+		To:             req.To,
+		Cc:             req.Cc,
+		Bcc:            req.Bcc,
+		ReplyTo:        req.ReplyTo,
+		Subject:        req.Subject,
+		Html:           req.Html,
+		Text:           req.Text,
+		Headers:        req.Headers,
+		ScheduledAt:    req.ScheduledAt,
+		IdempotencyKey: idempotencyKey,
+		Tracking:       req.tracking,
+	}
+	for _, a := range req.Attachments {
+		if a.ContentID != "" {
+			pv.InlineImages = append(pv.InlineImages, a.ContentID)
+		} else {
+			pv.Attachments = append(pv.Attachments, a.Filename)
+		}
+	}
+	bs, err := json.Marshal(pv)
+	if err != nil {
+		return starlark.None, err
+	}
+	return dataconv.UnmarshalStarlarkJSON(bs)
+}
+
+// emailStatus is the sent email retrieved from Resend API, with the fields not supported by the SDK yet.
+type emailStatus struct {
+	ID          string   `json:"id"`
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	Cc          []string `json:"cc"`
+	Bcc         []string `json:"bcc"`
+	ReplyTo     []string `json:"reply_to"`
+	Subject     string   `json:"subject"`
+	Status      string   `json:"status"`
+	LastEvent   string   `json:"last_event"`
+	CreatedAt   string   `json:"created_at"`
+	ScheduledAt string   `json:"scheduled_at"`
+}
+
+// genGetFunc generates the Starlark callable function to retrieve the status of a sent email.
+func (m *Module) genGetFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".get", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var emailID types.StringOrBytes
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "id", &emailID); err != nil {
+			return starlark.None, err
+		}
+		if ystring.IsBlank(emailID.GoString()) {
+			return starlark.None, fmt.Errorf("id must be non-blank")
+		}
+		client, err := m.newClient()
+		if err != nil {
+			return starlark.None, err
+		}
+
+		// retrieve it
+		ctx := dataconv.GetThreadContext(thread)
+		req, err := client.NewRequest(ctx, http.MethodGet, "emails/"+url.PathEscape(emailID.GoString()), nil)
+		if err != nil {
+			return starlark.None, resend.ErrFailedToCreateEmailsGetRequest
+		}
+		es := new(emailStatus)
+		if _, err = client.Perform(req, es); err != nil {
+			return starlark.None, err
+		}
+
+		// the status is the last event, e.g. sent, delivered, bounced
+		if es.Status == "" {
+			es.Status = es.LastEvent
+		}
+		bs, err := json.Marshal(es)
+		if err != nil {
+			return starlark.None, err
+		}
+		return dataconv.UnmarshalStarlarkJSON(bs)
+	})
+}
+
+// genCancelFunc generates the Starlark callable function to cancel a scheduled email.
+func (m *Module) genCancelFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".cancel", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var emailID types.StringOrBytes
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "id", &emailID); err != nil {
+			return starlark.None, err
+		}
+		if ystring.IsBlank(emailID.GoString()) {
+			return starlark.None, fmt.Errorf("id must be non-blank")
+		}
+		client, err := m.newClient()
+		if err != nil {
+			return starlark.None, err
+		}
+
+		// cancel it, only scheduled emails not sent yet can be canceled
 		ctx := dataconv.GetThreadContext(thread)
-		client := resend.NewClient(resendAPIKey)
-		sent, err := client.Emails.SendWithContext(ctx, req)
+		req, err := client.NewRequest(ctx, http.MethodPost, "emails/"+url.PathEscape(emailID.GoString())+"/cancel", nil)
 		if err != nil {
+			return starlark.None, fmt.Errorf("failed to create cancel request: %w", err)
+		}
+		if _, err = client.Perform(req, nil); err != nil {
 			return starlark.None, err
 		}
-		return starlark.String(sent.Id), nil
+		return starlark.None, nil
 	})
 }
+
+// newClient creates a Resend client with the API key in config.
+func (m *Module) newClient() (*resend.Client, error) {
+	resendAPIKey, err := m.cfgMod.GetConfig("resend_api_key")
+	if err != nil {
+		return nil, fmt.Errorf("resend_api_key is not set")
+	}
+	return resend.NewClient(resendAPIKey), nil
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	relativeTimePattern = regexp.MustCompile(`^in\s+(\d+)\s*([a-z]+)$`)
+	relativeTimeUnits   = map[string]time.Duration{
+		"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+		"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+		"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+		"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+	}
+)
+
+// parseScheduledAt converts the scheduled time in RFC3339 or relative form like "in 1 hour" to the RFC3339 string in UTC.
+func parseScheduledAt(s string, now time.Time) (string, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if !t.After(now) {
+			return "", fmt.Errorf("scheduled_at must be in the future: %s", s)
+		}
+		return t.UTC().Format(time.RFC3339), nil
+	}
+
+	// relative time: in <number> <unit>
+	mt := relativeTimePattern.FindStringSubmatch(strings.ToLower(s))
+	if mt == nil {
+		return "", fmt.Errorf("unsupported scheduled_at: %q, use RFC3339 or the form like \"in 1 hour\"", s)
+	}
+	n, err := strconv.Atoi(mt[1])
+	if err != nil || n <= 0 {
+		return "", fmt.Errorf("invalid scheduled_at: %q", s)
+	}
+	unit, ok := relativeTimeUnits[mt[2]]
+	if !ok {
+		return "", fmt.Errorf("unknown time unit in scheduled_at: %q", mt[2])
+	}
+	return now.Add(time.Duration(n) * unit).UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,212 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"path"
+	"time"
+)
+
+const sendgridEndpoint = "https://api.sendgrid.com/v3/mail/send"
+
+// SetSendGrid sets the API key of SendGrid to send emails, and switches the email provider to SendGrid.
+func (m *Module) SetSendGrid(apiKey string) {
+	m.cfgMod.SetConfigValue("email_provider", providerSendGrid)
+	m.cfgMod.SetConfigValue("sendgrid_api_key", apiKey)
+}
+
+// sendgridAddress is the email address with optional name in SendGrid API.
+type sendgridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// sendgridPersonalization is the recipients of the email in SendGrid API.
+type sendgridPersonalization struct {
+	To  []*sendgridAddress `json:"to"`
+	Cc  []*sendgridAddress `json:"cc,omitempty"`
+	Bcc []*sendgridAddress `json:"bcc,omitempty"`
+}
+
+// sendgridContent is a body part of the email in SendGrid API.
+type sendgridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sendgridAttachment is the attachment or inline image in SendGrid API.
+type sendgridAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+	Disposition string `json:"disposition,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+// sendgridRequest is the request of mail send in SendGrid API.
+type sendgridRequest struct {
+	Personalizations []*sendgridPersonalization `json:"personalizations"`
+	From             *sendgridAddress           `json:"from"`
+	ReplyTo          *sendgridAddress           `json:"reply_to,omitempty"`
+	Subject          string                     `json:"subject"`
+	Content          []*sendgridContent         `json:"content"`
+	Attachments      []*sendgridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string          `json:"headers,omitempty"`
+	SendAt           int64                      `json:"send_at,omitempty"`
+	TrackingSettings *sendgridTrackingSettings  `json:"tracking_settings,omitempty"`
+}
+
+// sendgridTracking is the switch of a tracking setting in SendGrid API.
+type sendgridTracking struct {
+	Enable bool `json:"enable"`
+}
+
+// sendgridTrackingSettings is the open and click tracking of the email in SendGrid API.
+type sendgridTrackingSettings struct {
+	ClickTracking *sendgridTracking `json:"click_tracking,omitempty"`
+	OpenTracking  *sendgridTracking `json:"open_tracking,omitempty"`
+}
+
+// sendgridProvider sends emails via SendGrid API with sendgrid_api_key in config.
+type sendgridProvider struct {
+	m *Module
+}
+
+func (p *sendgridProvider) name() string {
+	return providerSendGrid
+}
+
+func (p *sendgridProvider) check(req *sendEmailRequest) error {
+	_, err := newSendGridRequest(req)
+	return err
+}
+
+func (p *sendgridProvider) send(ctx context.Context, req *sendEmailRequest, idempotencyKey string) (*sendResponse, error) {
+	apiKey, err := p.m.cfgMod.GetConfig("sendgrid_api_key")
+	if err != nil || apiKey == "" {
+		return nil, fmt.Errorf("sendgrid_api_key is not set")
+	}
+	if idempotencyKey != "" {
+		log.Warnw("idempotency_key is ignored by sendgrid provider", "key", idempotencyKey)
+	}
+	sr, err := newSendGridRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := json.Marshal(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	// send the request, the message ID is in the header of accepted response
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, sendgridEndpoint, bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+	hr.Header.Set("Authorization", "Bearer "+apiKey)
+	hr.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(hr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("sendgrid: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return newHTTPSendResponse(providerSendGrid, resp.Header.Get("X-Message-Id"), resp, body), nil
+}
+
+// newSendGridRequest converts the request to the one of SendGrid API, the text part goes before HTML as SendGrid requires.
+func newSendGridRequest(req *sendEmailRequest) (*sendgridRequest, error) {
+	convAddrs := func(l []string) ([]*sendgridAddress, error) {
+		var res []*sendgridAddress
+		for _, s := range l {
+			a, err := mail.ParseAddress(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", s, err)
+			}
+			res = append(res, &sendgridAddress{Email: a.Address, Name: a.Name})
+		}
+		return res, nil
+	}
+
+	// addresses
+	from, err := convAddrs([]string{req.From})
+	if err != nil {
+		return nil, err
+	}
+	ps := &sendgridPersonalization{}
+	if ps.To, err = convAddrs(req.To); err != nil {
+		return nil, err
+	}
+	if ps.Cc, err = convAddrs(req.Cc); err != nil {
+		return nil, err
+	}
+	if ps.Bcc, err = convAddrs(req.Bcc); err != nil {
+		return nil, err
+	}
+	sr := &sendgridRequest{
+		Personalizations: []*sendgridPersonalization{ps},
+		From:             from[0],
+		Subject:          req.Subject,
+		Headers:          req.Headers,
+	}
+	if req.ReplyTo != "" {
+		rt, err := convAddrs([]string{req.ReplyTo})
+		if err != nil {
+			return nil, err
+		}
+		sr.ReplyTo = rt[0]
+	}
+
+	// body and attachments
+	if req.Text != "" {
+		sr.Content = append(sr.Content, &sendgridContent{Type: "text/plain", Value: req.Text})
+	}
+	if req.Html != "" {
+		sr.Content = append(sr.Content, &sendgridContent{Type: "text/html", Value: req.Html})
+	}
+	for _, a := range req.Attachments {
+		sa := &sendgridAttachment{
+			Content:     a.Content,
+			Filename:    a.Filename,
+			Type:        mime.TypeByExtension(path.Ext(a.Filename)),
+			Disposition: "attachment",
+		}
+		if a.ContentType != "" {
+			sa.Type = a.ContentType
+		}
+		if a.ContentID != "" {
+			sa.Disposition, sa.ContentID = "inline", a.ContentID
+		}
+		sr.Attachments = append(sr.Attachments, sa)
+	}
+
+	// scheduled delivery in unix time
+	if req.ScheduledAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ScheduledAt)
+		if err != nil {
+			return nil, err
+		}
+		sr.SendAt = t.Unix()
+	}
+
+	// open and click tracking
+	if ts := req.tracking; ts != nil {
+		sr.TrackingSettings = &sendgridTrackingSettings{}
+		if ts.Opens != nil {
+			sr.TrackingSettings.OpenTracking = &sendgridTracking{Enable: *ts.Opens}
+		}
+		if ts.Clicks != nil {
+			sr.TrackingSettings.ClickTracking = &sendgridTracking{Enable: *ts.Clicks}
+		}
+	}
+	return sr, nil
+}
@@ -0,0 +1,162 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/PureMature/starport/base"
+)
+
+const sesPath = "/v2/email/outbound-emails"
+
+// SetSES sets the region and credentials of Amazon SES to send emails, and switches the email provider to SES.
+func (m *Module) SetSES(region, accessKeyID, secretAccessKey string) {
+	m.cfgMod.SetConfigValue("email_provider", providerSES)
+	m.cfgMod.SetConfigValue("ses_region", region)
+	m.cfgMod.SetConfigValue("ses_access_key_id", accessKeyID)
+	m.cfgMod.SetConfigValue("ses_secret_access_key", secretAccessKey)
+}
+
+// sesRequest is the request of SendEmail in SES API v2 with raw content.
+type sesRequest struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses  []string `json:"ToAddresses,omitempty"`
+		CcAddresses  []string `json:"CcAddresses,omitempty"`
+		BccAddresses []string `json:"BccAddresses,omitempty"`
+	} `json:"Destination"`
+	Content struct {
+		Raw struct {
+			Data []byte `json:"Data"`
+		} `json:"Raw"`
+	} `json:"Content"`
+}
+
+// sesProvider sends emails via Amazon SES API v2 with the region and credentials in config.
+// The message is built in MIME like SMTP, and the request is signed with AWS Signature Version 4.
+type sesProvider struct {
+	m *Module
+}
+
+func (p *sesProvider) name() string {
+	return providerSES
+}
+
+func (p *sesProvider) check(req *sendEmailRequest) error {
+	if req.ScheduledAt != "" {
+		return fmt.Errorf("scheduled_at is not supported by ses provider")
+	}
+	return nil
+}
+
+func (p *sesProvider) send(ctx context.Context, req *sendEmailRequest, idempotencyKey string) (*sendResponse, error) {
+	region, _ := p.m.cfgMod.GetConfig("ses_region")
+	keyID, _ := p.m.cfgMod.GetConfig("ses_access_key_id")
+	secret, _ := p.m.cfgMod.GetConfig("ses_secret_access_key")
+	if region == "" || keyID == "" || secret == "" {
+		return nil, fmt.Errorf("ses_region, ses_access_key_id and ses_secret_access_key must be set")
+	}
+	if idempotencyKey != "" {
+		log.Warnw("idempotency_key is ignored by ses provider", "key", idempotencyKey)
+	}
+	if req.tracking != nil {
+		log.Warnw("tracking is configured by configuration sets in ses provider", "tracking", req.tracking)
+	}
+
+	// build the raw message
+	from, err := mail.ParseAddress(req.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	msgID, err := newMessageID(from.Address)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := buildMIMEMessage(req, msgID)
+	if err != nil {
+		return nil, err
+	}
+	sr := &sesRequest{FromEmailAddress: req.From}
+	sr.Destination.ToAddresses = req.To
+	sr.Destination.CcAddresses = req.Cc
+	sr.Destination.BccAddresses = req.Bcc
+	sr.Content.Raw.Data = raw
+	body, err := json.Marshal(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	// sign and send the request
+	host := "email." + region + ".amazonaws.com"
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+sesPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	signAWSv4(hr, body, host, region, "ses", keyID, secret)
+	resp, err := http.DefaultClient.Do(hr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	rb, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("ses: %s: %s", resp.Status, bytes.TrimSpace(rb))
+	}
+	var res struct {
+		MessageID string `json:"MessageId"`
+	}
+	if err := json.Unmarshal(rb, &res); err != nil {
+		return nil, fmt.Errorf("ses: invalid response: %w", err)
+	}
+	return newHTTPSendResponse(providerSES, res.MessageID, resp, rb), nil
+}
+
+// signAWSv4 signs the request with AWS Signature Version 4 by setting the X-Amz-Date and Authorization headers.
+func signAWSv4(r *http.Request, body []byte, host, region, service, keyID, secret string) {
+	hmacSHA256 := func(key []byte, s string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(s))
+		return h.Sum(nil)
+	}
+	sha256Hex := func(b []byte) string {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+
+	// canonical request with the signed headers
+	now := base.Now().UTC()
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	r.Header.Set("X-Amz-Date", amzDate)
+	signedHeaders := "content-type;host;x-amz-date"
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"content-type:" + r.Header.Get("Content-Type"),
+		"host:" + host,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	// string to sign and the signing key derived from the secret
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signedHeaders, sig))
+}
@@ -0,0 +1,339 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"strings"
+
+	"github.com/PureMature/starport/base"
+)
+
+// SetSMTP sets the SMTP server to send emails, and switches the email provider to SMTP.
+// Port 465 uses implicit TLS, other ports upgrade with STARTTLS if the server supports it.
+func (m *Module) SetSMTP(host, port, username, password string) {
+	m.cfgMod.SetConfigValue("email_provider", providerSMTP)
+	m.cfgMod.SetConfigValue("smtp_host", host)
+	m.cfgMod.SetConfigValue("smtp_port", port)
+	m.cfgMod.SetConfigValue("smtp_username", username)
+	m.cfgMod.SetConfigValue("smtp_password", password)
+}
+
+// sendSMTP builds the MIME message of the request and sends it via the SMTP server in config, and returns the message ID.
+func (m *Module) sendSMTP(ctx context.Context, req *sendEmailRequest) (string, error) {
+	host, err := m.cfgMod.GetConfig("smtp_host")
+	if err != nil || host == "" {
+		return "", fmt.Errorf("smtp_host is not set")
+	}
+	port, _ := m.cfgMod.GetConfig("smtp_port")
+	if port == "" {
+		port = "587"
+	}
+	username, _ := m.cfgMod.GetConfig("smtp_username")
+	password, _ := m.cfgMod.GetConfig("smtp_password")
+
+	// build the message
+	from, err := mail.ParseAddress(req.From)
+	if err != nil {
+		return "", fmt.Errorf("invalid from address: %w", err)
+	}
+	msgID, err := newMessageID(from.Address)
+	if err != nil {
+		return "", err
+	}
+	msg, err := buildMIMEMessage(req, msgID)
+	if err != nil {
+		return "", err
+	}
+	var rcpts []string
+	for _, l := range [][]string{req.To, req.Cc, req.Bcc} {
+		for _, a := range l {
+			addr, err := mail.ParseAddress(a)
+			if err != nil {
+				return "", fmt.Errorf("invalid recipient address %q: %w", a, err)
+			}
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+
+	// connect to the server, port 465 is for implicit TLS
+	var (
+		d    net.Dialer
+		addr = net.JoinHostPort(host, port)
+		tc   = &tls.Config{ServerName: host}
+	)
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	if port == "465" {
+		conn = tls.Client(conn, tc)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close() // nolint:errcheck
+		return "", err
+	}
+	defer c.Close() // nolint:errcheck
+
+	// upgrade and authenticate
+	if port != "465" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tc); err != nil {
+				return "", err
+			}
+		}
+	}
+	if username != "" {
+		if err := c.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+			return "", err
+		}
+	}
+
+	// send the message
+	if err := c.Mail(from.Address); err != nil {
+		return "", err
+	}
+	for _, r := range rcpts {
+		if err := c.Rcpt(r); err != nil {
+			return "", err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return msgID, c.Quit()
+}
+
+// newMessageID returns a random message ID in the domain of the sender.
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if err := base.RandRead(b); err != nil {
+		return "", err
+	}
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
+
+// headerLineBreaks replaces the line breaks in header names and values, so the values from scripts or inbound mails can't inject headers.
+var headerLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// buildMIMEMessage builds the MIME message of the request. The body is multipart/alternative if both text and HTML are set,
+// and it's wrapped in multipart/related for inline images, and multipart/mixed for attachments.
+func buildMIMEMessage(req *sendEmailRequest, msgID string) ([]byte, error) {
+	var buf bytes.Buffer
+	hdr := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", headerLineBreaks.Replace(k), headerLineBreaks.Replace(v))
+		}
+	}
+	hdr("From", req.From)
+	hdr("To", strings.Join(req.To, ", "))
+	hdr("Cc", strings.Join(req.Cc, ", "))
+	hdr("Reply-To", req.ReplyTo)
+	hdr("Subject", mime.QEncoding.Encode("utf-8", req.Subject))
+	hdr("Date", base.Now().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	hdr("Message-ID", msgID)
+	for k, v := range req.Headers {
+		hdr(k, v)
+	}
+	hdr("MIME-Version", "1.0")
+
+	// split attachments into inline images and regular ones
+	var inlines, attachments []*attachment
+	for _, a := range req.Attachments {
+		if a.ContentID != "" {
+			inlines = append(inlines, a)
+		} else {
+			attachments = append(attachments, a)
+		}
+	}
+
+	// the body part, or the alternative parts of text and HTML
+	bodyType, body := "text/plain", req.Text
+	if req.Html != "" {
+		bodyType, body = "text/html", req.Html
+	}
+	writeAlternative := func(w *multipart.Writer) error {
+		if err := writeTextPart(w, "text/plain", req.Text); err != nil {
+			return err
+		}
+		return writeTextPart(w, "text/html", req.Html)
+	}
+	writeBody := func(w *multipart.Writer) error {
+		if req.Text != "" && req.Html != "" {
+			return writeMultipart(w, "alternative", writeAlternative)
+		}
+		return writeTextPart(w, bodyType, body)
+	}
+
+	// alternative message without attachments
+	if len(attachments) == 0 && len(inlines) == 0 && req.Text != "" && req.Html != "" {
+		mw := multipart.NewWriter(&buf)
+		hdr("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+		buf.WriteString("\r\n")
+		if err := writeAlternative(mw); err != nil {
+			return nil, err
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	// single part message without attachments
+	if len(attachments) == 0 && len(inlines) == 0 {
+		hdr("Content-Type", bodyType+"; charset=utf-8")
+		hdr("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		qw := quotedprintable.NewWriter(&buf)
+		if _, err := qw.Write([]byte(body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	// body with inline images
+	writeRelated := func(w *multipart.Writer) error {
+		if err := writeBody(w); err != nil {
+			return err
+		}
+		for _, a := range inlines {
+			if err := writeAttachmentPart(w, a, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// multipart message, the top level is mixed if there are attachments
+	mw := multipart.NewWriter(&buf)
+	if len(attachments) == 0 {
+		hdr("Content-Type", "multipart/related; boundary="+mw.Boundary())
+		buf.WriteString("\r\n")
+		if err := writeRelated(mw); err != nil {
+			return nil, err
+		}
+	} else {
+		hdr("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		buf.WriteString("\r\n")
+		var err error
+		if len(inlines) > 0 {
+			err = writeMultipart(mw, "related", writeRelated)
+		} else {
+			err = writeBody(mw)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range attachments {
+			if err := writeAttachmentPart(mw, a, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMultipart writes a nested multipart part of the subtype, with the parts written by fn.
+func writeMultipart(w *multipart.Writer, subtype string, fn func(*multipart.Writer) error) error {
+	var buf bytes.Buffer
+	nw := multipart.NewWriter(&buf)
+	if err := fn(nw); err != nil {
+		return err
+	}
+	if err := nw.Close(); err != nil {
+		return err
+	}
+	pw, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/" + subtype + "; boundary=" + nw.Boundary()},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = pw.Write(buf.Bytes())
+	return err
+}
+
+// writeTextPart writes the text or HTML part in quoted-printable encoding.
+func writeTextPart(w *multipart.Writer, contentType, body string) error {
+	pw, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qw := quotedprintable.NewWriter(pw)
+	if _, err := qw.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// writeAttachmentPart writes the attachment part in base64 encoding, inline images are referred by their content IDs.
+func writeAttachmentPart(w *multipart.Writer, a *attachment, inline bool) error {
+	ct := a.ContentType
+	if ct == "" {
+		ct = mime.TypeByExtension(path.Ext(a.Filename))
+	}
+	if ct == "" {
+		ct = http.DetectContentType(a.data)
+	}
+	h := textproto.MIMEHeader{
+		"Content-Type":              {ct},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	disp := "attachment"
+	if inline {
+		disp = "inline"
+		h.Set("Content-ID", "<"+a.ContentID+">")
+	}
+	h.Set("Content-Disposition", mime.FormatMediaType(disp, map[string]string{"filename": a.Filename}))
+	pw, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	// wrap base64 lines at 76 characters
+	enc := base64.StdEncoding.EncodeToString(a.data)
+	for len(enc) > 76 {
+		if _, err := pw.Write([]byte(enc[:76] + "\r\n")); err != nil {
+			return err
+		}
+		enc = enc[76:]
+	}
+	_, err = pw.Write([]byte(enc + "\r\n"))
+	return err
+}
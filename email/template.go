@@ -0,0 +1,49 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+)
+
+// renderTemplate renders the Go html/template with the Starlark value as data, e.g. "Hi {{.name}}" with {"name": "Alice"}.
+// The values are escaped for HTML, and missing keys in the data are reported as errors.
+func renderTemplate(text string, data starlark.Value) (string, error) {
+	tmpl, err := template.New("email").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse template: %w", err)
+	}
+	var gd interface{}
+	if data != nil && data != starlark.None {
+		if gd, err = dataconv.Unmarshal(data); err != nil {
+			return "", fmt.Errorf("convert template data: %w", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, gd); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// genRenderFunc generates the Starlark callable function to render an HTML template with data.
+func (m *Module) genRenderFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".render", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			text types.StringOrBytes
+			data starlark.Value = starlark.None
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "template", &text, "data?", &data); err != nil {
+			return starlark.None, err
+		}
+		s, err := renderTemplate(text.GoString(), data)
+		if err != nil {
+			return starlark.None, err
+		}
+		return starlark.String(s), nil
+	})
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// trackingSettings is the open and click tracking of an email, nil means the default of the provider.
+type trackingSettings struct {
+	Opens  *bool `json:"opens,omitempty"`
+	Clicks *bool `json:"clicks,omitempty"`
+}
+
+// SetTracking sets the default open and click tracking of emails, which can be overridden by track_opens and track_clicks in send.
+// Only the providers supporting per-message tracking apply them, e.g. SendGrid, while Resend configures tracking per domain.
+func (m *Module) SetTracking(opens, clicks bool) {
+	m.cfgMod.SetConfigValue("track_opens", strconv.FormatBool(opens))
+	m.cfgMod.SetConfigValue("track_clicks", strconv.FormatBool(clicks))
+}
+
+// getTracking returns the tracking settings of the per-call arguments, or the defaults in config if they are None.
+// It returns nil if neither is set.
+func (m *Module) getTracking(opens, clicks starlark.Value) (*trackingSettings, error) {
+	get := func(arg string, v starlark.Value) (*bool, error) {
+		switch t := v.(type) {
+		case starlark.Bool:
+			b := bool(t)
+			return &b, nil
+		case starlark.NoneType:
+		default:
+			return nil, fmt.Errorf("%s must be a bool or None, got %s", arg, v.Type())
+		}
+		s, err := m.cfgMod.GetConfig(arg)
+		if err != nil || strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s config: %w", arg, err)
+		}
+		return &b, nil
+	}
+
+	var (
+		ts  trackingSettings
+		err error
+	)
+	if ts.Opens, err = get("track_opens", opens); err != nil {
+		return nil, err
+	}
+	if ts.Clicks, err = get("track_clicks", clicks); err != nil {
+		return nil, err
+	}
+	if ts.Opens == nil && ts.Clicks == nil {
+		return nil, nil
+	}
+	return &ts, nil
+}
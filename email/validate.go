@@ -0,0 +1,89 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/mail"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+)
+
+// addressVerdict is the result of validating an email address.
+type addressVerdict struct {
+	Address string   `json:"address"`
+	Valid   bool     `json:"valid"`
+	Reason  string   `json:"reason,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Email   string   `json:"email,omitempty"`
+	Local   string   `json:"local,omitempty"`
+	Domain  string   `json:"domain,omitempty"`
+	MX      []string `json:"mx,omitempty"`
+}
+
+// validateAddress checks the syntax of the address, i.e. "user@example.com" or "Name <user@example.com>".
+func validateAddress(s string) *addressVerdict {
+	v := &addressVerdict{Address: s}
+	addr, err := mail.ParseAddress(strings.TrimSpace(s))
+	if err != nil {
+		v.Reason = "invalid syntax: " + strings.TrimPrefix(err.Error(), "mail: ")
+		return v
+	}
+	i := strings.LastIndex(addr.Address, "@")
+	v.Name, v.Email = addr.Name, addr.Address
+	v.Local, v.Domain = addr.Address[:i], strings.ToLower(addr.Address[i+1:])
+	if !strings.Contains(strings.Trim(v.Domain, "."), ".") {
+		v.Reason = "domain has no top-level domain"
+		return v
+	}
+	v.Valid = true
+	return v
+}
+
+// genValidateFunc generates the Starlark callable function to validate an email address by its syntax, and optionally the MX records of its domain.
+// It returns a dict with the verdict, the reason if invalid, and the parts of the address.
+func (m *Module) genValidateFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".validate", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			address types.StringOrBytes
+			checkMX bool
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "address", &address, "check_mx?", &checkMX); err != nil {
+			return starlark.None, err
+		}
+
+		// check the syntax, and then the MX records if required
+		v := validateAddress(address.GoString())
+		if v.Valid && checkMX {
+			mxs, err := net.DefaultResolver.LookupMX(dataconv.GetThreadContext(thread), v.Domain)
+			var de *net.DNSError
+			switch {
+			case err == nil:
+				for _, mx := range mxs {
+					v.MX = append(v.MX, strings.TrimSuffix(mx.Host, "."))
+				}
+			case errors.As(err, &de) && de.IsNotFound:
+				// no MX record found, handled below
+			default:
+				return starlark.None, err
+			}
+			if len(v.MX) == 0 {
+				v.Valid = false
+				v.Reason = "domain has no mx records"
+			}
+		}
+		return addressToStarlark(v)
+	})
+}
+
+// addressToStarlark converts the verdict to a Starlark dict.
+func addressToStarlark(v *addressVerdict) (starlark.Value, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return starlark.None, err
+	}
+	return dataconv.UnmarshalStarlarkJSON(bs)
+}
@@ -0,0 +1,334 @@
+// Package ftp provides a Starlark module that transfers files over FTP and FTPS.
+package ftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet"
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"github.com/jlaffaye/ftp"
+	stdtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// ModuleName defines the expected name for this module when used in Starlark's load() function, e.g., load('ftp', 'get')
+const ModuleName = "ftp"
+
+// Module wraps the ConfigurableModule with specific functionality for FTP transfers.
+type Module struct {
+	cfgMod *base.ConfigurableModule[string]
+}
+
+// NewModule creates a new instance of Module.
+func NewModule() *Module {
+	cm := base.NewConfigurableModule[string]()
+	return &Module{cfgMod: cm}
+}
+
+// NewModuleWithConfig creates a new instance of Module with the given configuration values.
+// The tlsMode can be "none", "explicit" (AUTH TLS) or "implicit" (FTPS).
+func NewModuleWithConfig(host, username, password, tlsMode string) *Module {
+	cm := base.NewConfigurableModule[string]()
+	cm.SetConfigValue("host", host)
+	cm.SetConfigValue("username", username)
+	cm.SetConfigValue("password", password)
+	cm.SetConfigValue("tls", tlsMode)
+	return &Module{cfgMod: cm}
+}
+
+// NewModuleWithGetter creates a new instance of Module with the given configuration getters.
+func NewModuleWithGetter(host, username, password, tlsMode base.ConfigGetter[string]) *Module {
+	cm := base.NewConfigurableModule[string]()
+	cm.SetConfig("host", host)
+	cm.SetConfig("username", username)
+	cm.SetConfig("password", password)
+	cm.SetConfig("tls", tlsMode)
+	return &Module{cfgMod: cm}
+}
+
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"connect": {"host", "username", "password", "tls", "timeout"},
+	"list":    {"path"},
+	"get":     {"path"},
+	"put":     {"path", "content"},
+}
+
+// LoadModule returns the Starlark module loader with the FTP-specific functions.
+func (m *Module) LoadModule() starlet.ModuleLoader {
+	additionalFuncs := starlark.StringDict{
+		"connect": starlark.NewBuiltin(ModuleName+".connect", m.connect),
+		"list":    starlark.NewBuiltin(ModuleName+".list", m.listDir),
+		"get":     starlark.NewBuiltin(ModuleName+".get", m.getFile),
+		"put":     starlark.NewBuiltin(ModuleName+".put", m.putFile),
+	}
+	return m.cfgMod.LoadModule(ModuleName, additionalFuncs, funcParams)
+}
+
+var (
+	none           = starlark.None
+	defaultTimeout = 30 * time.Second
+)
+
+// dialOptions holds the resolved options to connect to a server.
+type dialOptions struct {
+	host     string
+	username string
+	password string
+	tlsMode  string
+	timeout  time.Duration
+}
+
+// resolveOptions merges the per-call arguments with the module configuration, the arguments take precedence.
+func (m *Module) resolveOptions(host, username, password, tlsMode *types.NullableStringOrBytes, timeout types.FloatOrInt) (*dialOptions, error) {
+	pick := func(val *types.NullableStringOrBytes, key string) string {
+		if !val.IsNullOrEmpty() {
+			return val.GoString()
+		}
+		s, _ := m.cfgMod.GetConfig(key)
+		return s
+	}
+	o := &dialOptions{
+		host:     pick(host, "host"),
+		username: pick(username, "username"),
+		password: pick(password, "password"),
+		tlsMode:  strings.ToLower(pick(tlsMode, "tls")),
+		timeout:  defaultTimeout,
+	}
+	if o.host == "" {
+		return nil, fmt.Errorf("host is not set")
+	}
+	if timeout > 0 {
+		o.timeout = time.Duration(timeout.GoFloat64() * float64(time.Second))
+	}
+
+	// append the default port if missing
+	if _, _, err := net.SplitHostPort(o.host); err != nil {
+		if o.tlsMode == "implicit" {
+			o.host = net.JoinHostPort(o.host, "990")
+		} else {
+			o.host = net.JoinHostPort(o.host, "21")
+		}
+	}
+	return o, nil
+}
+
+// dial connects and logs in to the server with the given options.
+func dial(ctx context.Context, o *dialOptions) (*ftp.ServerConn, error) {
+	serverName, _, err := net.SplitHostPort(o.host)
+	if err != nil {
+		return nil, err
+	}
+	opts := []ftp.DialOption{
+		ftp.DialWithContext(ctx),
+		ftp.DialWithTimeout(o.timeout),
+	}
+	switch o.tlsMode {
+	case "", "none":
+		// plain FTP
+	case "explicit":
+		opts = append(opts, ftp.DialWithExplicitTLS(&tls.Config{ServerName: serverName}))
+	case "implicit":
+		opts = append(opts, ftp.DialWithTLS(&tls.Config{ServerName: serverName}))
+	default:
+		return nil, fmt.Errorf("unsupported tls mode: %s", o.tlsMode)
+	}
+
+	c, err := ftp.Dial(o.host, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// use anonymous login if no username is set
+	user, pass := o.username, o.password
+	if user == "" {
+		user, pass = "anonymous", "anonymous"
+	}
+	if err := c.Login(user, pass); err != nil {
+		_ = c.Quit()
+		return nil, err
+	}
+	log.Debugw("ftp connected", "host", o.host, "tls", o.tlsMode)
+	return c, nil
+}
+
+// connFunc is the operation to run on the connection, with its arguments already unpacked.
+type connFunc func(c *ftp.ServerConn) (starlark.Value, error)
+
+// runConnFunc unpacks the arguments with the given parser, and runs the operation on the connection.
+func runConnFunc(c *ftp.ServerConn, parse func(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (connFunc, error), b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	fn, err := parse(b, args, kwargs)
+	if err != nil {
+		return none, err
+	}
+	return fn(c)
+}
+
+// withConn connects to the server with module configuration, runs the function and closes the connection.
+func (m *Module) withConn(thread *starlark.Thread, fn connFunc) (starlark.Value, error) {
+	nul := types.NewNullableStringOrBytesNoDefault
+	o, err := m.resolveOptions(nul(), nul(), nul(), nul(), 0)
+	if err != nil {
+		return none, err
+	}
+	c, err := dial(dataconv.GetThreadContext(thread), o)
+	if err != nil {
+		return none, err
+	}
+	defer c.Quit() // nolint:errcheck
+	return fn(c)
+}
+
+func (m *Module) connect(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		host     = types.NewNullableStringOrBytesNoDefault()
+		username = types.NewNullableStringOrBytesNoDefault()
+		password = types.NewNullableStringOrBytesNoDefault()
+		tlsMode  = types.NewNullableStringOrBytesNoDefault()
+		timeout  types.FloatOrInt
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "host?", host, "username?", username, "password?", password, "tls?", tlsMode, "timeout?", &timeout); err != nil {
+		return none, err
+	}
+
+	// connect to the server
+	o, err := m.resolveOptions(host, username, password, tlsMode, timeout)
+	if err != nil {
+		return none, err
+	}
+	c, err := dial(dataconv.GetThreadContext(thread), o)
+	if err != nil {
+		return none, err
+	}
+
+	// wrap the connection as a struct of bound functions
+	fields := starlark.StringDict{
+		"host": starlark.String(o.host),
+		"list": starlark.NewBuiltin("ftp_conn.list", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return runConnFunc(c, listEntries, b, args, kwargs)
+		}),
+		"get": starlark.NewBuiltin("ftp_conn.get", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return runConnFunc(c, retrieveFile, b, args, kwargs)
+		}),
+		"put": starlark.NewBuiltin("ftp_conn.put", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return runConnFunc(c, storeFile, b, args, kwargs)
+		}),
+		"close": starlark.NewBuiltin("ftp_conn.close", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+				return none, err
+			}
+			return none, c.Quit()
+		}),
+	}
+	return starlarkstruct.FromStringDict(starlark.String("ftp_conn"), fields), nil
+}
+
+func (m *Module) listDir(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	fn, err := listEntries(b, args, kwargs)
+	if err != nil {
+		return none, err
+	}
+	return m.withConn(thread, fn)
+}
+
+func (m *Module) getFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	fn, err := retrieveFile(b, args, kwargs)
+	if err != nil {
+		return none, err
+	}
+	return m.withConn(thread, fn)
+}
+
+func (m *Module) putFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	fn, err := storeFile(b, args, kwargs)
+	if err != nil {
+		return none, err
+	}
+	return m.withConn(thread, fn)
+}
+
+// listEntries unpacks the arguments, and returns the operation listing the entries in the given directory.
+func listEntries(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (connFunc, error) {
+	var path = types.NewNullableStringOrBytes("")
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path?", path); err != nil {
+		return nil, err
+	}
+
+	return func(c *ftp.ServerConn) (starlark.Value, error) {
+		entries, err := c.List(path.GoString())
+		if err != nil {
+			return none, err
+		}
+		res := make([]starlark.Value, 0, len(entries))
+		for _, e := range entries {
+			fields := starlark.StringDict{
+				"name":     starlark.String(e.Name),
+				"type":     starlark.String(entryTypeName(e.Type)),
+				"size":     starlark.MakeUint64(e.Size),
+				"mod_time": stdtime.Time(e.Time),
+				"target":   starlark.String(e.Target),
+			}
+			res = append(res, starlarkstruct.FromStringDict(starlark.String("ftp_entry"), fields))
+		}
+		return starlark.NewList(res), nil
+	}, nil
+}
+
+// entryTypeName returns the readable name of the entry type.
+func entryTypeName(t ftp.EntryType) string {
+	switch t {
+	case ftp.EntryTypeFile:
+		return "file"
+	case ftp.EntryTypeFolder:
+		return "dir"
+	case ftp.EntryTypeLink:
+		return "link"
+	default:
+		return "unknown"
+	}
+}
+
+// retrieveFile unpacks the arguments, and returns the operation downloading the content of the given file.
+func retrieveFile(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (connFunc, error) {
+	var path types.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+
+	return func(c *ftp.ServerConn) (starlark.Value, error) {
+		r, err := c.Retr(path.GoString())
+		if err != nil {
+			return none, err
+		}
+		defer r.Close() // nolint:errcheck
+
+		buf := bytes.NewBuffer(nil)
+		if _, err := io.Copy(buf, r); err != nil {
+			return none, err
+		}
+		return starlark.String(buf.Bytes()), nil
+	}, nil
+}
+
+// storeFile unpacks the arguments, and returns the operation uploading the content as the given file.
+func storeFile(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (connFunc, error) {
+	var path, content types.StringOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "content", &content); err != nil {
+		return nil, err
+	}
+
+	return func(c *ftp.ServerConn) (starlark.Value, error) {
+		err := c.Stor(path.GoString(), bytes.NewReader(content.GoBytes()))
+		return none, err
+	}, nil
+}
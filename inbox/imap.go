@@ -0,0 +1,440 @@
+// Package inbox provides a Starlark module that reads mailboxes over IMAP.
+package inbox
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet"
+	"github.com/1set/starlet/dataconv/types"
+	"github.com/PureMature/starport/base"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message/mail"
+	stdtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+// ModuleName defines the expected name for this module when used in Starlark's load() function, e.g., load('inbox', 'search')
+const ModuleName = "inbox"
+
+// Module wraps the ConfigurableModule with specific functionality for reading mailboxes.
+type Module struct {
+	cfgMod *base.ConfigurableModule[string]
+}
+
+// NewModule creates a new instance of Module.
+func NewModule() *Module {
+	cm := base.NewConfigurableModule[string]()
+	return &Module{cfgMod: cm}
+}
+
+// NewModuleWithConfig creates a new instance of Module with the given configuration values.
+// The tlsMode can be "implicit" (default, IMAPS), "starttls" or "none".
+func NewModuleWithConfig(host, username, password, tlsMode string) *Module {
+	cm := base.NewConfigurableModule[string]()
+	cm.SetConfigValue("host", host)
+	cm.SetConfigValue("username", username)
+	cm.SetConfigValue("password", password)
+	cm.SetConfigValue("tls", tlsMode)
+	return &Module{cfgMod: cm}
+}
+
+// NewModuleWithGetter creates a new instance of Module with the given configuration getters.
+func NewModuleWithGetter(host, username, password, tlsMode base.ConfigGetter[string]) *Module {
+	cm := base.NewConfigurableModule[string]()
+	cm.SetConfig("host", host)
+	cm.SetConfig("username", username)
+	cm.SetConfig("password", password)
+	cm.SetConfig("tls", tlsMode)
+	return &Module{cfgMod: cm}
+}
+
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"search": {"mailbox", "unseen", "from", "subject", "text", "since", "before", "limit"},
+	"fetch":  {"uid", "mailbox", "mark_seen"},
+	"mark":   {"uid", "mailbox", "seen", "flagged", "deleted"},
+	"move":   {"uid", "dest", "mailbox"},
+}
+
+// LoadModule returns the Starlark module loader with the inbox-specific functions.
+func (m *Module) LoadModule() starlet.ModuleLoader {
+	additionalFuncs := starlark.StringDict{
+		"list_mailboxes": starlark.NewBuiltin(ModuleName+".list_mailboxes", m.listMailboxes),
+		"search":         starlark.NewBuiltin(ModuleName+".search", m.searchMessages),
+		"fetch":          starlark.NewBuiltin(ModuleName+".fetch", m.fetchMessage),
+		"mark":           starlark.NewBuiltin(ModuleName+".mark", m.markMessage),
+		"move":           starlark.NewBuiltin(ModuleName+".move", m.moveMessage),
+	}
+	return m.cfgMod.LoadModule(ModuleName, additionalFuncs, funcParams)
+}
+
+var (
+	none           = starlark.None
+	defaultMailbox = "INBOX"
+)
+
+// connect dials and logs in to the IMAP server with the module configuration.
+func (m *Module) connect() (*client.Client, error) {
+	host, err := m.cfgMod.GetConfig("host")
+	if err != nil || host == "" {
+		return nil, errors.New("host is not set")
+	}
+	username, _ := m.cfgMod.GetConfig("username")
+	password, _ := m.cfgMod.GetConfig("password")
+	tlsMode, _ := m.cfgMod.GetConfig("tls")
+	tlsMode = strings.ToLower(tlsMode)
+
+	// append the default port if missing
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		if tlsMode == "" || tlsMode == "implicit" {
+			host = net.JoinHostPort(host, "993")
+		} else {
+			host = net.JoinHostPort(host, "143")
+		}
+	}
+	serverName, _, _ := net.SplitHostPort(host)
+	tlsCfg := &tls.Config{ServerName: serverName}
+
+	// dial with the tls mode
+	var c *client.Client
+	switch tlsMode {
+	case "", "implicit":
+		c, err = client.DialTLS(host, tlsCfg)
+	case "starttls":
+		if c, err = client.Dial(host); err == nil {
+			if err = c.StartTLS(tlsCfg); err != nil {
+				_ = c.Logout()
+			}
+		}
+	case "none":
+		c, err = client.Dial(host)
+	default:
+		return nil, fmt.Errorf("unsupported tls mode: %s", tlsMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// log in
+	if err := c.Login(username, password); err != nil {
+		_ = c.Logout()
+		return nil, err
+	}
+	log.Debugw("imap connected", "host", host, "tls", tlsMode)
+	return c, nil
+}
+
+// withMailbox connects to the server, selects the mailbox and runs the function.
+func (m *Module) withMailbox(mailbox string, readOnly bool, fn func(c *client.Client) (starlark.Value, error)) (starlark.Value, error) {
+	c, err := m.connect()
+	if err != nil {
+		return none, err
+	}
+	defer c.Logout() // nolint:errcheck
+
+	if mailbox == "" {
+		mailbox = defaultMailbox
+	}
+	if _, err := c.Select(mailbox, readOnly); err != nil {
+		return none, err
+	}
+	return fn(c)
+}
+
+func (m *Module) listMailboxes(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0, 0); err != nil {
+		return none, err
+	}
+
+	c, err := m.connect()
+	if err != nil {
+		return none, err
+	}
+	defer c.Logout() // nolint:errcheck
+
+	// collect mailbox names
+	ch := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", ch)
+	}()
+	var names []starlark.Value
+	for mi := range ch {
+		names = append(names, starlark.String(mi.Name))
+	}
+	if err := <-done; err != nil {
+		return none, err
+	}
+	return starlark.NewList(names), nil
+}
+
+func (m *Module) searchMessages(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		mailbox    = types.NewNullableStringOrBytes(defaultMailbox)
+		unseen     bool
+		fromAddr   = types.NewNullableStringOrBytesNoDefault()
+		subject    = types.NewNullableStringOrBytesNoDefault()
+		text       = types.NewNullableStringOrBytesNoDefault()
+		sinceTime  = types.Nullable[stdtime.Time]{}
+		beforeTime = types.Nullable[stdtime.Time]{}
+		limit      = 0
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+		"mailbox?", mailbox, "unseen?", &unseen, "from?", fromAddr, "subject?", subject, "text?", text,
+		"since?", &sinceTime, "before?", &beforeTime, "limit?", &limit); err != nil {
+		return none, err
+	}
+
+	// build search criteria
+	criteria := imap.NewSearchCriteria()
+	if unseen {
+		criteria.WithoutFlags = []string{imap.SeenFlag}
+	}
+	if !fromAddr.IsNullOrEmpty() {
+		criteria.Header.Add("From", fromAddr.GoString())
+	}
+	if !subject.IsNullOrEmpty() {
+		criteria.Header.Add("Subject", subject.GoString())
+	}
+	if !text.IsNullOrEmpty() {
+		criteria.Text = []string{text.GoString()}
+	}
+	if !sinceTime.IsNull() {
+		criteria.Since = time.Time(sinceTime.Value())
+	}
+	if !beforeTime.IsNull() {
+		criteria.Before = time.Time(beforeTime.Value())
+	}
+
+	return m.withMailbox(mailbox.GoString(), true, func(c *client.Client) (starlark.Value, error) {
+		uids, err := c.UidSearch(criteria)
+		if err != nil {
+			return none, err
+		}
+		// keep the latest messages if limited
+		if limit > 0 && len(uids) > limit {
+			uids = uids[len(uids)-limit:]
+		}
+		if len(uids) == 0 {
+			return starlark.NewList(nil), nil
+		}
+
+		// fetch envelopes
+		seq := new(imap.SeqSet)
+		seq.AddNum(uids...)
+		items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size}
+		ch := make(chan *imap.Message, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidFetch(seq, items, ch)
+		}()
+		var res []starlark.Value
+		for msg := range ch {
+			res = append(res, messageSummary(msg))
+		}
+		if err := <-done; err != nil {
+			return none, err
+		}
+		return starlark.NewList(res), nil
+	})
+}
+
+func (m *Module) fetchMessage(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		uid      uint32
+		mailbox  = types.NewNullableStringOrBytes(defaultMailbox)
+		markSeen bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "uid", &uid, "mailbox?", mailbox, "mark_seen?", &markSeen); err != nil {
+		return none, err
+	}
+
+	return m.withMailbox(mailbox.GoString(), !markSeen, func(c *client.Client) (starlark.Value, error) {
+		// fetch the whole message, peek unless marking as seen
+		section := &imap.BodySectionName{Peek: !markSeen}
+		seq := new(imap.SeqSet)
+		seq.AddNum(uid)
+		items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size, section.FetchItem()}
+		ch := make(chan *imap.Message, 1)
+		if err := c.UidFetch(seq, items, ch); err != nil {
+			return none, err
+		}
+		msg := <-ch
+		if msg == nil {
+			return none, fmt.Errorf("message not found: %d", uid)
+		}
+		body := msg.GetBody(section)
+		if body == nil {
+			return none, fmt.Errorf("message body not found: %d", uid)
+		}
+
+		// parse the body parts
+		md := messageSummary(msg)
+		if err := parseMessageBody(body, md); err != nil {
+			return none, err
+		}
+		return md, nil
+	})
+}
+
+func (m *Module) markMessage(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		uid     uint32
+		mailbox = types.NewNullableStringOrBytes(defaultMailbox)
+		seen    = types.Nullable[starlark.Bool]{}
+		flagged = types.Nullable[starlark.Bool]{}
+		deleted = types.Nullable[starlark.Bool]{}
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "uid", &uid, "mailbox?", mailbox, "seen?", &seen, "flagged?", &flagged, "deleted?", &deleted); err != nil {
+		return none, err
+	}
+
+	// group flags to add or remove
+	var addFlags, delFlags []interface{}
+	for flag, val := range map[string]types.Nullable[starlark.Bool]{
+		imap.SeenFlag:    seen,
+		imap.FlaggedFlag: flagged,
+		imap.DeletedFlag: deleted,
+	} {
+		if val.IsNull() {
+			continue
+		}
+		if val.Value() {
+			addFlags = append(addFlags, flag)
+		} else {
+			delFlags = append(delFlags, flag)
+		}
+	}
+
+	return m.withMailbox(mailbox.GoString(), false, func(c *client.Client) (starlark.Value, error) {
+		seq := new(imap.SeqSet)
+		seq.AddNum(uid)
+		if len(addFlags) > 0 {
+			if err := c.UidStore(seq, imap.FormatFlagsOp(imap.AddFlags, true), addFlags, nil); err != nil {
+				return none, err
+			}
+		}
+		if len(delFlags) > 0 {
+			if err := c.UidStore(seq, imap.FormatFlagsOp(imap.RemoveFlags, true), delFlags, nil); err != nil {
+				return none, err
+			}
+		}
+		return none, nil
+	})
+}
+
+func (m *Module) moveMessage(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		uid     uint32
+		dest    types.StringOrBytes
+		mailbox = types.NewNullableStringOrBytes(defaultMailbox)
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "uid", &uid, "dest", &dest, "mailbox?", mailbox); err != nil {
+		return none, err
+	}
+
+	return m.withMailbox(mailbox.GoString(), false, func(c *client.Client) (starlark.Value, error) {
+		seq := new(imap.SeqSet)
+		seq.AddNum(uid)
+		return none, c.UidMove(seq, dest.GoString())
+	})
+}
+
+// messageSummary converts the envelope and flags of a message to a Starlark dictionary.
+func messageSummary(msg *imap.Message) *starlark.Dict {
+	md := starlark.NewDict(8)
+	_ = md.SetKey(starlark.String("uid"), starlark.MakeUint64(uint64(msg.Uid)))
+	_ = md.SetKey(starlark.String("size"), starlark.MakeUint64(uint64(msg.Size)))
+	flags := make([]starlark.Value, len(msg.Flags))
+	for i, f := range msg.Flags {
+		flags[i] = starlark.String(f)
+	}
+	_ = md.SetKey(starlark.String("flags"), starlark.NewList(flags))
+
+	if env := msg.Envelope; env != nil {
+		_ = md.SetKey(starlark.String("subject"), starlark.String(env.Subject))
+		_ = md.SetKey(starlark.String("date"), stdtime.Time(env.Date))
+		_ = md.SetKey(starlark.String("message_id"), starlark.String(env.MessageId))
+		_ = md.SetKey(starlark.String("from"), addressList(env.From))
+		_ = md.SetKey(starlark.String("to"), addressList(env.To))
+		_ = md.SetKey(starlark.String("cc"), addressList(env.Cc))
+	}
+	return md
+}
+
+// addressList converts a list of IMAP addresses to a Starlark list of strings.
+func addressList(addrs []*imap.Address) *starlark.List {
+	res := make([]starlark.Value, 0, len(addrs))
+	for _, a := range addrs {
+		res = append(res, starlark.String(a.Address()))
+	}
+	return starlark.NewList(res)
+}
+
+// parseMessageBody reads the MIME parts of the message, and sets text, html and attachments to the dictionary.
+func parseMessageBody(body io.Reader, md *starlark.Dict) error {
+	mr, err := mail.CreateReader(body)
+	if err != nil {
+		return err
+	}
+
+	var (
+		text, html  string
+		attachments []starlark.Value
+	)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		buf := bytes.NewBuffer(nil)
+		if _, err := io.Copy(buf, p.Body); err != nil {
+			return err
+		}
+		switch h := p.Header.(type) {
+		case *mail.InlineHeader:
+			// only the text parts are the body, other inline parts like images or calendars are returned as attachments
+			ct, _, _ := h.ContentType()
+			switch ct {
+			case "text/html":
+				html += buf.String()
+			case "text/plain", "":
+				text += buf.String()
+			default:
+				fn, _ := (&mail.AttachmentHeader{Header: h.Header}).Filename()
+				attachments = append(attachments, attachmentDict(fn, ct, h.Get("Content-Id"), buf.Bytes()))
+			}
+		case *mail.AttachmentHeader:
+			fn, _ := h.Filename()
+			ct, _, _ := h.ContentType()
+			attachments = append(attachments, attachmentDict(fn, ct, h.Get("Content-Id"), buf.Bytes()))
+		}
+	}
+
+	_ = md.SetKey(starlark.String("text"), starlark.String(text))
+	_ = md.SetKey(starlark.String("html"), starlark.String(html))
+	_ = md.SetKey(starlark.String("attachments"), starlark.NewList(attachments))
+	return nil
+}
+
+// attachmentDict converts the attachment or the non-text inline part to a Starlark dictionary, the content ID is for the inline parts
+// referenced by "cid:" in the HTML body, and empty if not set.
+func attachmentDict(name, contentType, contentID string, content []byte) *starlark.Dict {
+	ad := starlark.NewDict(4)
+	_ = ad.SetKey(starlark.String("name"), starlark.String(name))
+	_ = ad.SetKey(starlark.String("content_type"), starlark.String(contentType))
+	_ = ad.SetKey(starlark.String("content_id"), starlark.String(strings.Trim(strings.TrimSpace(contentID), "<>")))
+	_ = ad.SetKey(starlark.String("content"), starlark.Bytes(content))
+	return ad
+}
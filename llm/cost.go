@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	oai "github.com/sashabaranov/go-openai"
+)
+
+// modelPrice is the price of a model in USD per million tokens.
+type modelPrice struct {
+	prefix string
+	input  float64
+	output float64
+}
+
+// modelPrices maps model name prefixes to their prices, longer prefixes come first.
+var modelPrices = []modelPrice{
+	{"gpt-4o-mini", 0.15, 0.6},
+	{"gpt-4o", 5, 15},
+	{"gpt-4-turbo", 10, 30},
+	{"gpt-4-1106", 10, 30},
+	{"gpt-4-0125", 10, 30},
+	{"gpt-4-vision", 10, 30},
+	{"gpt-4-32k", 60, 120},
+	{"gpt-4", 30, 60},
+	{"gpt-3.5-turbo-instruct", 1.5, 2},
+	{"gpt-3.5-turbo", 0.5, 1.5},
+	{"o1-mini", 3, 12},
+	{"o1", 15, 60},
+}
+
+// SetModelPrice sets the price of the model in USD per million input and output tokens, it's used to estimate the cost for max_cost.
+// The model name is matched as a prefix, and the custom prices take precedence over the built-in ones.
+func (m *Module) SetModelPrice(model string, inputPerMillion, outputPerMillion float64) {
+	m.prices = append([]modelPrice{{strings.ToLower(model), inputPerMillion, outputPerMillion}}, m.prices...)
+}
+
+// findModelPrice returns the price of the model, custom prices are checked first.
+func (m *Module) findModelPrice(model string) (modelPrice, bool) {
+	model = strings.ToLower(model)
+	for _, list := range [][]modelPrice{m.prices, modelPrices} {
+		for _, p := range list {
+			if strings.HasPrefix(model, p.prefix) {
+				return p, true
+			}
+		}
+	}
+	return modelPrice{}, false
+}
+
+// checkCost estimates the prompt tokens and the cost of the request, and refuses it if the limits are exceeded.
+// The cost assumes all choices use up the max tokens, non-positive limits are ignored.
+func (m *Module) checkCost(req oai.ChatCompletionRequest, maxCost float64, maxPromptTokens int) error {
+	if maxCost <= 0 && maxPromptTokens <= 0 {
+		return nil
+	}
+	promptTokens := estimateTokens(req.Messages)
+	if maxPromptTokens > 0 && promptTokens > maxPromptTokens {
+		return fmt.Errorf("estimated %d prompt tokens exceeds max_prompt_tokens %d", promptTokens, maxPromptTokens)
+	}
+	if maxCost <= 0 {
+		return nil
+	}
+
+	// estimate the cost
+	price, ok := m.findModelPrice(req.Model)
+	if !ok {
+		return fmt.Errorf("unknown price of model %s for max_cost", req.Model)
+	}
+	n := req.N
+	if n < 1 {
+		n = 1
+	}
+	cost := (float64(promptTokens)*price.input + float64(req.MaxTokens*n)*price.output) / 1e6
+	if cost > maxCost {
+		return fmt.Errorf("estimated cost $%.4f exceeds max_cost $%.4f", cost, maxCost)
+	}
+	return nil
+}
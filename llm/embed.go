@@ -0,0 +1,236 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	oai "github.com/sashabaranov/go-openai"
+	"go.starlark.net/starlark"
+)
+
+// EmbeddingCache stores the embedding vectors by key in named databases, e.g. a store backed by Charm KV.
+type EmbeddingCache interface {
+	// Get returns the cached value of the key in the database, and whether it's found.
+	Get(db, key string) ([]byte, bool, error)
+	// Set stores the value of the key in the database.
+	Set(db, key string, value []byte) error
+}
+
+// SetEmbeddingCache sets the cache used by llm.embed_many() when the cache argument is given.
+func (m *Module) SetEmbeddingCache(c EmbeddingCache) {
+	m.embedCache = c
+}
+
+var (
+	defaultEmbeddingModel = string(oai.SmallEmbedding3)
+	maxEmbeddingBatchSize = 2048
+	embedRetryInterval    = time.Second
+)
+
+// embedBatch is a batch of texts to embed, with their indexes in the input.
+type embedBatch struct {
+	indexes []int
+	texts   []string
+	vectors [][]float32
+	err     error
+}
+
+// embeddingCacheKey returns the cache key for the text embedded by the model.
+func embeddingCacheKey(model string, dimensions int, text string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s", model, dimensions, text)))
+	return "embed/" + hex.EncodeToString(h[:])
+}
+
+// genEmbedManyFunc generates the Starlark callable function to embed many texts in batches.
+func (m *Module) genEmbedManyFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".embed_many", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			texts       = types.NewOneOrManyNoDefault[starlark.String]()
+			userModel   = types.NewNullableStringOrBytesNoDefault()
+			dimensions  = 0
+			batchSize   = 100
+			concurrency = 2
+			cacheDB     = types.NewNullableStringOrBytesNoDefault()
+			progress    = types.NullableCallable{}
+			retryTimes  = 3
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+			"texts", texts, "model?", userModel, "dimensions?", &dimensions,
+			"batch_size?", &batchSize, "concurrency?", &concurrency, "cache?", cacheDB, "progress?", &progress, "retry?", &retryTimes,
+		); err != nil {
+			return none, err
+		}
+		if batchSize <= 0 || batchSize > maxEmbeddingBatchSize {
+			return none, fmt.Errorf("batch_size must be between 1 and %d, got %d", maxEmbeddingBatchSize, batchSize)
+		}
+		if concurrency <= 0 {
+			return none, fmt.Errorf("concurrency must be positive, got %d", concurrency)
+		}
+		if retryTimes < 1 {
+			return none, fmt.Errorf("retry must be at least 1, got %d", retryTimes)
+		}
+		if m.dryRun {
+			return none, errors.New("embed_many is not supported in dry-run mode")
+		}
+		model := m.getModel("openai_embedding_model", userModel.GoString())
+		if model == "" {
+			model = defaultEmbeddingModel
+		}
+		db := cacheDB.GoString()
+		if db != "" && m.embedCache == nil {
+			return none, errors.New("embedding cache is not set")
+		}
+
+		// look up the cache, and collect the texts to embed
+		var (
+			inputs  = texts.Slice()
+			vectors = make([][]float32, len(inputs))
+			pending []int
+		)
+		for i, s := range inputs {
+			if db != "" {
+				if val, found, err := m.embedCache.Get(db, embeddingCacheKey(model, dimensions, s.GoString())); err != nil {
+					log.Warnw("fail to get cached embedding", "db", db, "error", err)
+				} else if found {
+					var vec []float32
+					if err := json.Unmarshal(val, &vec); err == nil {
+						vectors[i] = vec
+						continue
+					}
+				}
+			}
+			pending = append(pending, i)
+		}
+
+		// split into batches
+		var batches []*embedBatch
+		for start := 0; start < len(pending); start += batchSize {
+			end := start + batchSize
+			if end > len(pending) {
+				end = len(pending)
+			}
+			bt := &embedBatch{indexes: pending[start:end]}
+			for _, idx := range bt.indexes {
+				bt.texts = append(bt.texts, inputs[idx].GoString())
+			}
+			guarded, err := m.cfgMod.GuardSecrets(bt.texts...)
+			if err != nil {
+				return none, err
+			}
+			bt.texts = guarded
+			batches = append(batches, bt)
+		}
+
+		// embed the batches concurrently
+		cli, err := m.getClient(model, nil)
+		if err != nil {
+			return none, err
+		}
+		ctx, cancel := context.WithCancel(dataconv.GetThreadContext(thread))
+		defer cancel()
+		var (
+			sem     = make(chan struct{}, concurrency)
+			results = make(chan *embedBatch, len(batches))
+		)
+		for _, bt := range batches {
+			go func(bt *embedBatch) {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				bt.vectors, bt.err = createEmbeddings(ctx, cli, oai.EmbeddingRequestStrings{
+					Input:      bt.texts,
+					Model:      oai.EmbeddingModel(model),
+					Dimensions: dimensions,
+				}, retryTimes)
+				results <- bt
+			}(bt)
+		}
+
+		// collect results in the thread of Starlark, for cache and progress callback
+		done := len(inputs) - len(pending)
+		for range batches {
+			bt := <-results
+			if bt.err != nil {
+				return none, bt.err
+			}
+			for j, idx := range bt.indexes {
+				vectors[idx] = bt.vectors[j]
+				if db == "" {
+					continue
+				}
+				if val, err := json.Marshal(bt.vectors[j]); err == nil {
+					if err := m.embedCache.Set(db, embeddingCacheKey(model, dimensions, inputs[idx].GoString()), val); err != nil {
+						log.Warnw("fail to cache embedding", "db", db, "error", err)
+					}
+				}
+			}
+			done += len(bt.indexes)
+			if pf := progress.Value(); pf != nil {
+				if _, err := starlark.Call(thread, pf, starlark.Tuple{starlark.MakeInt(done), starlark.MakeInt(len(inputs))}, nil); err != nil {
+					return none, err
+				}
+			}
+		}
+
+		// convert to list of lists of floats
+		res := make([]starlark.Value, len(vectors))
+		for i, vec := range vectors {
+			fl := make([]starlark.Value, len(vec))
+			for j, f := range vec {
+				fl[j] = starlark.Float(f)
+			}
+			res[i] = starlark.NewList(fl)
+		}
+		return starlark.NewList(res), nil
+	})
+}
+
+// createEmbeddings sends the embedding request to the provider, and retries with backoff on errors except bad requests.
+func createEmbeddings(ctx context.Context, cli *oai.Client, req oai.EmbeddingRequestStrings, retryTimes int) ([][]float32, error) {
+	var (
+		resp oai.EmbeddingResponse
+		err  error
+	)
+	for i := 0; i < retryTimes; i++ {
+		if i > 0 {
+			// wait longer for each retry, e.g. rate limited
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(embedRetryInterval << (i - 1)):
+			}
+		}
+		resp, err = cli.CreateEmbeddings(ctx, req)
+		if err == nil {
+			break
+		}
+		// if the error is a bad request, break the loop, no need to retry
+		var ae *oai.APIError
+		if errors.As(err, &ae) && ae != nil && ae.HTTPStatusCode == http.StatusBadRequest {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(req.Input) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(resp.Data), len(req.Input))
+	}
+
+	// order by index in the response
+	vectors := make([][]float32, len(req.Input))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("unexpected embedding index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
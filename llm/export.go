@@ -0,0 +1,219 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	"go.starlark.net/starlark"
+)
+
+// charmFilePrefix is the prefix of paths in Charm FS, the files are written via the writer set by SetCharmFS.
+const charmFilePrefix = "charm://"
+
+// FileWriter writes files to a remote storage, e.g. the cfs module for Charm FS.
+type FileWriter interface {
+	WriteFile(name string, data []byte) error
+}
+
+// SetCharmFS sets the writer for exported transcripts with paths prefixed with "charm://".
+func (m *Module) SetCharmFS(w FileWriter) {
+	m.charmFS = w
+}
+
+// transcriptUsage is the token usage of a message or the whole transcript.
+type transcriptUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// add adds the other usage to this one.
+func (u *transcriptUsage) add(o *transcriptUsage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+}
+
+// transcriptMessage is a message in the exported transcript.
+type transcriptMessage struct {
+	Role      string           `json:"role"`
+	Text      string           `json:"text,omitempty"`
+	Images    int              `json:"images,omitempty"`
+	Timestamp string           `json:"timestamp,omitempty"`
+	Usage     *transcriptUsage `json:"usage,omitempty"`
+}
+
+// transcript is the exported conversation.
+type transcript struct {
+	Title    string               `json:"title,omitempty"`
+	Messages []*transcriptMessage `json:"messages"`
+	Usage    *transcriptUsage     `json:"usage,omitempty"`
+}
+
+// genExportFunc generates the Starlark callable function to render the messages of a conversation as a transcript in markdown or JSON.
+// The transcript is returned, and also written to the local file or Charm FS if the path is given.
+func (m *Module) genExportFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".export", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			messages = types.NewOneOrManyNoDefault[*starlark.Dict]()
+			format   = types.NewNullableStringOrBytes("markdown")
+			fp       = types.NewNullableStringOrBytesNoDefault()
+			title    = types.NewNullableStringOrBytesNoDefault()
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "messages", messages, "format?", format, "path?", fp, "title?", title); err != nil {
+			return none, err
+		}
+
+		// convert the messages
+		tr, err := newTranscript(title.GoString(), messages.Slice())
+		if err != nil {
+			return none, err
+		}
+
+		// render in the format
+		var out string
+		switch f := strings.ToLower(format.GoString()); f {
+		case "markdown", "md":
+			out = tr.markdown()
+		case "json":
+			bs, err := json.MarshalIndent(tr, "", "  ")
+			if err != nil {
+				return none, err
+			}
+			out = string(bs)
+		default:
+			return none, fmt.Errorf("unsupported export format: %s", f)
+		}
+
+		// write to the file if required
+		if p := fp.GoString(); p != "" {
+			if err := m.writeExportFile(p, []byte(out)); err != nil {
+				return none, err
+			}
+		}
+		return starlark.String(out), nil
+	})
+}
+
+// writeExportFile writes the data to the local file, or the file in Charm FS if the path is prefixed with "charm://".
+func (m *Module) writeExportFile(fp string, data []byte) error {
+	if strings.HasPrefix(fp, charmFilePrefix) {
+		if m.charmFS == nil {
+			return errors.New("charm fs is not set for " + charmFilePrefix + " paths")
+		}
+		return m.charmFS.WriteFile(strings.TrimPrefix(fp, charmFilePrefix), data)
+	}
+	return os.WriteFile(fp, data, 0644)
+}
+
+// newTranscript converts the message dicts to a transcript. The dicts are the ones of llm.message(), with optional "timestamp" and "usage".
+func newTranscript(title string, msgs []*starlark.Dict) (*transcript, error) {
+	tr := &transcript{Title: title}
+	total := &transcriptUsage{}
+	for i, md := range msgs {
+		role, ok := getStringFromDict(md, "role")
+		if !ok {
+			return nil, fmt.Errorf("message %d: role is required", i+1)
+		}
+		msg := &transcriptMessage{Role: role}
+		msg.Text, _ = getStringFromDict(md, "text")
+		for _, key := range []string{"image", "image_file", "image_url"} {
+			l, _ := getStringsFromDict(md, key)
+			msg.Images += len(l)
+		}
+
+		// the timestamp is a string or unix seconds
+		if v, found, _ := md.Get(starlark.String("timestamp")); found {
+			ts, err := exportTimestamp(v)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i+1, err)
+			}
+			msg.Timestamp = ts
+		}
+
+		// the usage is a dict like the one in the full response
+		if v, found, _ := md.Get(starlark.String("usage")); found && v != none {
+			u, err := exportUsage(v)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i+1, err)
+			}
+			msg.Usage = u
+			total.add(u)
+		}
+		tr.Messages = append(tr.Messages, msg)
+	}
+	if total.TotalTokens > 0 || total.PromptTokens > 0 || total.CompletionTokens > 0 {
+		tr.Usage = total
+	}
+	return tr, nil
+}
+
+// exportTimestamp converts the timestamp value to RFC3339 string, the value is a string, or int or float of unix seconds.
+func exportTimestamp(v starlark.Value) (string, error) {
+	switch t := v.(type) {
+	case starlark.String:
+		return string(t), nil
+	case starlark.Int, starlark.Float:
+		var sec types.FloatOrInt
+		if err := sec.Unpack(t); err != nil {
+			return "", err
+		}
+		return time.Unix(0, int64(sec.GoFloat64()*float64(time.Second))).UTC().Format(time.RFC3339), nil
+	default:
+		return "", fmt.Errorf("timestamp must be a string or unix seconds, got %s", v.Type())
+	}
+}
+
+// exportUsage converts the usage dict with token counts to transcriptUsage.
+func exportUsage(v starlark.Value) (*transcriptUsage, error) {
+	d, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("usage must be a dict, got %s", v.Type())
+	}
+	bs, err := dataconv.MarshalStarlarkJSON(d, 0)
+	if err != nil {
+		return nil, err
+	}
+	u := &transcriptUsage{}
+	if err := json.Unmarshal([]byte(bs), u); err != nil {
+		return nil, fmt.Errorf("invalid usage: %w", err)
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	return u, nil
+}
+
+// markdown renders the transcript in markdown, each message is a section with the role and timestamp as heading.
+func (tr *transcript) markdown() string {
+	var sb strings.Builder
+	if tr.Title != "" {
+		fmt.Fprintf(&sb, "# %s\n\n", tr.Title)
+	}
+	for _, msg := range tr.Messages {
+		sb.WriteString("### " + msg.Role)
+		if msg.Timestamp != "" {
+			sb.WriteString(" · " + msg.Timestamp)
+		}
+		sb.WriteString("\n\n")
+		if msg.Text != "" {
+			sb.WriteString(strings.TrimSpace(msg.Text) + "\n\n")
+		}
+		if msg.Images > 0 {
+			fmt.Fprintf(&sb, "_[%d image(s)]_\n\n", msg.Images)
+		}
+		if u := msg.Usage; u != nil {
+			fmt.Fprintf(&sb, "_tokens: %d prompt, %d completion, %d total_\n\n", u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+		}
+	}
+	if u := tr.Usage; u != nil {
+		fmt.Fprintf(&sb, "---\n\n**Total tokens:** %d prompt, %d completion, %d total\n", u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+	}
+	return sb.String()
+}
@@ -5,7 +5,7 @@ go 1.18
 require (
 	bitbucket.org/neiku/hlog v0.1.2
 	github.com/1set/starlet v0.1.3-0.20240812175751-6f896086c469
-	github.com/PureMature/starport/base v0.0.4
+	github.com/PureMature/starport/base v0.0.5
 	github.com/sashabaranov/go-openai v1.24.1
 	go.starlark.net v0.0.0-20240123142251-f86470692795
 	go.uber.org/zap v1.24.0
@@ -23,3 +23,5 @@ require (
 	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
+
+replace github.com/PureMature/starport/base => ../base
@@ -0,0 +1,217 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlet/dataconv/types"
+	oai "github.com/sashabaranov/go-openai"
+	"go.starlark.net/starlark"
+)
+
+var (
+	summaryLengths = map[string]string{
+		"short":  "in one or two sentences",
+		"medium": "in one paragraph",
+		"long":   "in several paragraphs covering all key points",
+	}
+	summarizePrompt = "You are a precise summarizer. Summarize the text given by the user %s. " +
+		"Keep the language of the original text, do not add facts that are not in the text, and reply with the summary only."
+	extractPrompt = "You extract structured data from the text given by the user. " +
+		"Reply with a JSON object containing exactly these keys:\n%s\n" +
+		"Use null for values that cannot be found in the text, and do not add other keys."
+)
+
+// genSummarizeFunc generates the Starlark callable function to summarize text with the chat model.
+func (m *Module) genSummarizeFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".summarize", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			text       types.StringOrBytes
+			length     starlark.Value = starlark.String("short")
+			userModel                 = types.NewNullableStringOrBytesNoDefault()
+			maxTokens                 = 512
+			retryTimes                = 1
+			allowError                = false
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+			"text", &text, "length?", &length, "model?", userModel, "max_tokens?", &maxTokens,
+			"retry?", &retryTimes, "allow_error?", &allowError,
+		); err != nil {
+			return none, err
+		}
+		if text.IsEmpty() {
+			return none, errors.New("text is required")
+		}
+
+		// describe the length of summary
+		var lengthDesc string
+		switch l := length.(type) {
+		case starlark.String:
+			desc, ok := summaryLengths[string(l)]
+			if !ok {
+				return none, fmt.Errorf("unsupported length: %s", l)
+			}
+			lengthDesc = desc
+		case starlark.Int:
+			words, ok := l.Int64()
+			if !ok || words <= 0 {
+				return none, fmt.Errorf("length must be a positive number of words, got %s", l)
+			}
+			lengthDesc = fmt.Sprintf("in about %d words", words)
+		default:
+			return none, fmt.Errorf("length must be a string or int, got %s", length.Type())
+		}
+
+		// send the request
+		model := m.getModel("openai_gpt_model", userModel.GoString())
+		if model == "" {
+			return none, errors.New("gpt model is not set")
+		}
+		req := oai.ChatCompletionRequest{
+			Model: model,
+			Messages: []oai.ChatCompletionMessage{
+				{Role: oai.ChatMessageRoleSystem, Content: fmt.Sprintf(summarizePrompt, lengthDesc)},
+				{Role: oai.ChatMessageRoleUser, Content: text.GoString()},
+			},
+			MaxTokens:   maxTokens,
+			Temperature: 0.2,
+		}
+		cli, err := m.resolveClient(model, nil)
+		if err != nil {
+			return none, err
+		}
+		resp, err := m.sendChatRequest(thread, cli, req, retryTimes)
+		if err == nil && len(resp.Choices) == 0 {
+			err = errors.New("no summary returned")
+		}
+		if err != nil {
+			if allowError {
+				return none, nil
+			}
+			return none, err
+		}
+		return starlark.String(strings.TrimSpace(resp.Choices[0].Message.Content)), nil
+	})
+}
+
+// genExtractFunc generates the Starlark callable function to extract fields from text with the chat model.
+func (m *Module) genExtractFunc() starlark.Callable {
+	return starlark.NewBuiltin(ModuleName+".extract", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			text       types.StringOrBytes
+			fields     starlark.Value
+			userModel  = types.NewNullableStringOrBytesNoDefault()
+			maxTokens  = 1024
+			retryTimes = 1
+			allowError = false
+		)
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+			"text", &text, "fields", &fields, "model?", userModel, "max_tokens?", &maxTokens,
+			"retry?", &retryTimes, "allow_error?", &allowError,
+		); err != nil {
+			return none, err
+		}
+		if text.IsEmpty() {
+			return none, errors.New("text is required")
+		}
+
+		// describe the fields: a list of names, or a dict of names and descriptions
+		var (
+			names []string
+			lines []string
+		)
+		switch f := fields.(type) {
+		case *starlark.Dict:
+			for _, it := range f.Items() {
+				name, ok := starlark.AsString(it[0])
+				if !ok {
+					return none, fmt.Errorf("field name must be a string, got %s", it[0].Type())
+				}
+				names = append(names, name)
+				lines = append(lines, fmt.Sprintf("- %s: %s", name, dataconv.StarString(it[1])))
+			}
+		case starlark.Iterable:
+			iter := f.Iterate()
+			defer iter.Done()
+			var x starlark.Value
+			for iter.Next(&x) {
+				name, ok := starlark.AsString(x)
+				if !ok {
+					return none, fmt.Errorf("field name must be a string, got %s", x.Type())
+				}
+				names = append(names, name)
+				lines = append(lines, "- "+name)
+			}
+		default:
+			return none, fmt.Errorf("fields must be a list or dict, got %s", fields.Type())
+		}
+		if len(names) == 0 {
+			return none, errors.New("fields must be non-empty")
+		}
+
+		// send the request
+		model := m.getModel("openai_gpt_model", userModel.GoString())
+		if model == "" {
+			return none, errors.New("gpt model is not set")
+		}
+		req := oai.ChatCompletionRequest{
+			Model: model,
+			Messages: []oai.ChatCompletionMessage{
+				{Role: oai.ChatMessageRoleSystem, Content: fmt.Sprintf(extractPrompt, strings.Join(lines, "\n"))},
+				{Role: oai.ChatMessageRoleUser, Content: text.GoString()},
+			},
+			MaxTokens:   maxTokens,
+			Temperature: 0,
+			ResponseFormat: &oai.ChatCompletionResponseFormat{
+				Type: oai.ChatCompletionResponseFormatTypeJSONObject,
+			},
+		}
+		cli, err := m.resolveClient(model, nil)
+		if err != nil {
+			return none, err
+		}
+		res, err := m.extractFields(thread, cli, req, names, retryTimes)
+		if err != nil {
+			if allowError {
+				return none, nil
+			}
+			return none, err
+		}
+		return res, nil
+	})
+}
+
+// extractFields sends the request and converts the JSON response to a dict with only the given field names.
+func (m *Module) extractFields(thread *starlark.Thread, cli *oai.Client, req oai.ChatCompletionRequest, names []string, retryTimes int) (starlark.Value, error) {
+	resp, err := m.sendChatRequest(thread, cli, req, retryTimes)
+	if err != nil {
+		return none, err
+	}
+	if len(resp.Choices) == 0 {
+		return none, errors.New("no result returned")
+	}
+
+	// parse and pick the fields
+	val, err := dataconv.DecodeStarlarkJSON([]byte(resp.Choices[0].Message.Content))
+	if err != nil {
+		return none, fmt.Errorf("invalid JSON result: %w", err)
+	}
+	obj, ok := val.(*starlark.Dict)
+	if !ok {
+		return none, fmt.Errorf("got %s result, want JSON object", val.Type())
+	}
+	res := starlark.NewDict(len(names))
+	for _, name := range names {
+		v, found, err := obj.Get(starlark.String(name))
+		if err != nil {
+			return none, err
+		}
+		if !found {
+			v = none
+		}
+		_ = res.SetKey(starlark.String(name), v)
+	}
+	return res, nil
+}
@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	_ "image/gif" // register GIF decoder
+)
+
+// imageOptions controls how images are downscaled and compressed before being sent to the provider.
+type imageOptions struct {
+	maxSize int // maximum width or height in pixels, 0 means no downscaling
+	quality int // JPEG quality from 1 to 100, 0 means no re-compression
+}
+
+// enabled reports whether any image processing is required.
+func (o imageOptions) enabled() bool {
+	return o.maxSize > 0 || o.quality > 0
+}
+
+// validate checks the options are in the valid range.
+func (o imageOptions) validate() error {
+	if o.maxSize < 0 {
+		return fmt.Errorf("image_max_size must be non-negative, got %d", o.maxSize)
+	}
+	if o.quality < 0 || o.quality > 100 {
+		return fmt.Errorf("image_quality must be between 1 and 100, got %d", o.quality)
+	}
+	return nil
+}
+
+// processImage downscales and compresses the image data with the options, and returns the new data with its MIME type.
+// The original data is returned as is if no processing is required, the format is not supported, or the result is not smaller.
+func processImage(data []byte, mimeType string, opt imageOptions) ([]byte, string) {
+	if !opt.enabled() {
+		return data, mimeType
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Debugw("skip processing unsupported image", "error", err)
+		return data, mimeType
+	}
+
+	// shrink the image if it's too large
+	resized := false
+	if b := img.Bounds(); opt.maxSize > 0 && (b.Dx() > opt.maxSize || b.Dy() > opt.maxSize) {
+		w, h := fitSize(b.Dx(), b.Dy(), opt.maxSize)
+		img = resizeImage(img, w, h)
+		resized = true
+	}
+	if !resized && opt.quality == 0 {
+		return data, mimeType
+	}
+
+	// encode as JPEG if quality is set or the source is JPEG, otherwise keep PNG for transparency
+	var (
+		buf     bytes.Buffer
+		newMime string
+	)
+	if opt.quality > 0 || format == "jpeg" {
+		q := opt.quality
+		if q == 0 {
+			q = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, flattenImage(img), &jpeg.Options{Quality: q})
+		newMime = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, img)
+		newMime = "image/png"
+	}
+	if err != nil {
+		log.Debugw("fail to encode image", "error", err)
+		return data, mimeType
+	}
+	if !resized && buf.Len() >= len(data) {
+		return data, mimeType
+	}
+	return buf.Bytes(), newMime
+}
+
+// fitSize returns the width and height scaled to fit in the square of the given size, keeping the aspect ratio.
+func fitSize(w, h, size int) (int, int) {
+	if w >= h {
+		nh := h * size / w
+		if nh < 1 {
+			nh = 1
+		}
+		return size, nh
+	}
+	nw := w * size / h
+	if nw < 1 {
+		nw = 1
+	}
+	return nw, size
+}
+
+// resizeImage resizes the image to the given size by averaging the source pixels covered by each target pixel.
+func resizeImage(src image.Image, w, h int) *image.RGBA {
+	var (
+		sb  = src.Bounds()
+		sw  = sb.Dx()
+		sh  = sb.Dy()
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	)
+	for y := 0; y < h; y++ {
+		y0 := sb.Min.Y + y*sh/h
+		y1 := sb.Min.Y + (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := sb.Min.X + x*sw/w
+			x1 := sb.Min.X + (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			// average the covered pixels
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// flattenImage draws the image on a white background, since JPEG doesn't support transparency.
+func flattenImage(src image.Image) image.Image {
+	if o, ok := src.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return src
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := src.At(x, y).RGBA()
+			bg := 0xffff - a
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + bg) >> 8),
+				G: uint8((g + bg) >> 8),
+				B: uint8((bl + bg) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	oai "github.com/sashabaranov/go-openai"
+	"go.starlark.net/starlark"
+)
+
+var errNoMock = errors.New("dry run is on but no mock is set")
+
+// SetDryRun turns on or off the dry-run mode, in which the requests are sent to the mock function set by llm.set_mock() instead of the provider.
+func (m *Module) SetDryRun(on bool) {
+	m.dryRun = on
+}
+
+// setMock sets the Starlark callable as the mock for chat and draw in the dry-run mode, passing None clears the mock.
+// It doesn't change the dry-run mode, which is controlled by the host with SetDryRun, and requests fail in dry-run mode without a mock.
+// The mock is called with the kind of request ("chat" or "draw") and the request as a dict, and returns a string or a list of strings as the response content.
+func (m *Module) setMock(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var fn starlark.Value
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fn", &fn); err != nil {
+		return none, err
+	}
+
+	switch f := fn.(type) {
+	case starlark.NoneType:
+		m.mockFn = nil
+	case starlark.Callable:
+		m.mockFn = f
+	default:
+		return none, fmt.Errorf("%s: got %s, want callable or None", b.Name(), fn.Type())
+	}
+	return none, nil
+}
+
+// callMock calls the mock function with the request, and returns the contents of the response.
+func (m *Module) callMock(thread *starlark.Thread, kind string, req interface{}) ([]string, error) {
+	if m.mockFn == nil {
+		return nil, errNoMock
+	}
+	sr, err := dataconv.GoToStarlarkViaJSON(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := starlark.Call(thread, m.mockFn, starlark.Tuple{starlark.String(kind), sr}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("mock %s: %w", kind, err)
+	}
+	var contents stringOrBytesList
+	if err := contents.Unpack(res); err != nil {
+		return nil, fmt.Errorf("mock %s: %w", kind, err)
+	}
+	return contents, nil
+}
+
+// mockChat returns the chat completion response built from the mock function.
+func (m *Module) mockChat(thread *starlark.Thread, req oai.ChatCompletionRequest) (oai.ChatCompletionResponse, error) {
+	var resp oai.ChatCompletionResponse
+	contents, err := m.callMock(thread, "chat", req)
+	if err != nil {
+		return resp, err
+	}
+	resp.Object = "chat.completion"
+	resp.Model = req.Model
+	for i, c := range contents {
+		resp.Choices = append(resp.Choices, oai.ChatCompletionChoice{
+			Index: i,
+			Message: oai.ChatCompletionMessage{
+				Role:    oai.ChatMessageRoleAssistant,
+				Content: c,
+			},
+			FinishReason: oai.FinishReasonStop,
+		})
+	}
+	return resp, nil
+}
+
+// mockImage returns the image response built from the mock function. The contents are URLs, or raw image data for non-URL response format.
+func (m *Module) mockImage(thread *starlark.Thread, req oai.ImageRequest) (oai.ImageResponse, error) {
+	var resp oai.ImageResponse
+	contents, err := m.callMock(thread, "draw", req)
+	if err != nil {
+		return resp, err
+	}
+	if len(contents) == 0 {
+		return resp, errors.New("mock draw: no image returned")
+	}
+	isURL := strings.ToLower(req.ResponseFormat) == "url"
+	for _, c := range contents {
+		if isURL {
+			resp.Data = append(resp.Data, oai.ImageResponseDataInner{URL: c})
+		} else {
+			resp.Data = append(resp.Data, oai.ImageResponseDataInner{B64JSON: base64.StdEncoding.EncodeToString([]byte(c))})
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	oai "github.com/sashabaranov/go-openai"
+	"go.starlark.net/starlark"
+)
+
+// PolicyViolationError is returned when the prompt is rejected by the moderation endpoint or the denylist before image generation.
+type PolicyViolationError struct {
+	// Source is what rejects the prompt, i.e. "moderation" or "denylist".
+	Source string
+	// Categories are the categories flagged by the moderation endpoint.
+	Categories []string
+	// Terms are the denylisted terms found in the prompt.
+	Terms []string
+}
+
+// Error implements the error interface.
+func (e *PolicyViolationError) Error() string {
+	var details []string
+	if len(e.Categories) > 0 {
+		details = append(details, "categories: "+strings.Join(e.Categories, ", "))
+	}
+	if len(e.Terms) > 0 {
+		details = append(details, "terms: "+strings.Join(e.Terms, ", "))
+	}
+	return fmt.Sprintf("prompt violates content policy by %s (%s)", e.Source, strings.Join(details, "; "))
+}
+
+// SetModeration turns on or off the moderation check of prompts for all llm.draw() calls, regardless of the moderate argument.
+func (m *Module) SetModeration(on bool) {
+	m.moderate = on
+}
+
+// SetDenylist sets the terms that are not allowed in the prompts of llm.draw(), the terms are matched case-insensitively.
+func (m *Module) SetDenylist(terms []string) {
+	m.denylist = nil
+	for _, t := range terms {
+		if t = strings.TrimSpace(strings.ToLower(t)); t != "" {
+			m.denylist = append(m.denylist, t)
+		}
+	}
+}
+
+// checkPrompt checks the prompt against the denylist, and then the moderation endpoint if required.
+// The moderation endpoint is skipped in dry-run mode.
+func (m *Module) checkPrompt(thread *starlark.Thread, prompt string, moderate bool, headers map[string]string) error {
+	// check the denylist first, no request is needed
+	lp := strings.ToLower(prompt)
+	var terms []string
+	for _, t := range m.denylist {
+		if strings.Contains(lp, t) {
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) > 0 {
+		return &PolicyViolationError{Source: "denylist", Terms: terms}
+	}
+	if !(moderate || m.moderate) || m.dryRun {
+		return nil
+	}
+
+	// call the moderation endpoint
+	cli, err := m.getClient("", headers)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.Moderations(dataconv.GetThreadContext(thread), oai.ModerationRequest{Input: prompt})
+	if err != nil {
+		return fmt.Errorf("moderation: %w", err)
+	}
+	for _, r := range resp.Results {
+		if !r.Flagged {
+			continue
+		}
+		return &PolicyViolationError{Source: "moderation", Categories: flaggedCategories(r.Categories)}
+	}
+	return nil
+}
+
+// guardMessages scans the text contents of chat messages for configured secrets, and blocks or redacts them in place.
+func (m *Module) guardMessages(msgs []oai.ChatCompletionMessage) error {
+	// collect the texts
+	var texts []*string
+	for i := range msgs {
+		msg := &msgs[i]
+		if msg.Content != "" {
+			texts = append(texts, &msg.Content)
+		}
+		for j := range msg.MultiContent {
+			if part := &msg.MultiContent[j]; part.Type == oai.ChatMessagePartTypeText {
+				texts = append(texts, &part.Text)
+			}
+		}
+	}
+	payloads := make([]string, len(texts))
+	for i, t := range texts {
+		payloads[i] = *t
+	}
+
+	// guard and write back
+	guarded, err := m.cfgMod.GuardSecrets(payloads...)
+	if err != nil {
+		return err
+	}
+	for i, t := range texts {
+		*t = guarded[i]
+	}
+	return nil
+}
+
+// flaggedCategories returns the sorted names of flagged categories.
+func flaggedCategories(rc oai.ResultCategories) []string {
+	var (
+		flags map[string]bool
+		res   []string
+	)
+	if bs, err := json.Marshal(rc); err == nil {
+		_ = json.Unmarshal(bs, &flags)
+	}
+	for k, v := range flags {
+		if v {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -28,6 +28,14 @@ const ModuleName = "llm"
 type Module struct {
 	cfgMod *base.ConfigurableModule[string]
 	cli    *oai.Client
+	dryRun bool
+	mockFn starlark.Callable
+
+	embedCache EmbeddingCache
+	charmFS    FileWriter
+	prices     []modelPrice
+	moderate   bool
+	denylist   []string
 }
 
 // NewModule creates a new instance of Module.
@@ -45,6 +53,8 @@ func NewModuleWithConfig(serviceProvider, endpointURL, apiKey, gptModel, dalleMo
 	cm.SetConfigValue(prefix+"api_key", apiKey)
 	cm.SetConfigValue(prefix+"gpt_model", gptModel)
 	cm.SetConfigValue(prefix+"dalle_model", dalleModel)
+	cm.SetConfigValue(prefix+"org_id", "")
+	cm.SetConfigValue(prefix+"project_id", "")
 	return &Module{cfgMod: cm}
 }
 
@@ -57,17 +67,48 @@ func NewModuleWithGetter(serviceProvider, endpointURL, apiKey, gptModel, dalleMo
 	cm.SetConfig(prefix+"api_key", apiKey)
 	cm.SetConfig(prefix+"gpt_model", gptModel)
 	cm.SetConfig(prefix+"dalle_model", dalleModel)
+	cm.SetConfigValue(prefix+"org_id", "")
+	cm.SetConfigValue(prefix+"project_id", "")
 	return &Module{cfgMod: cm}
 }
 
+// SetOrganization sets the organization and project IDs sent with each request to OpenAI, they can also be set by
+// set_openai_org_id() and set_openai_project_id() in Starlark.
+func (m *Module) SetOrganization(orgID, projectID string) {
+	m.cfgMod.SetConfigValue("openai_org_id", orgID)
+	m.cfgMod.SetConfigValue("openai_project_id", projectID)
+}
+
+// SetDefaultKwarg sets the default value of the keyword argument for the function, e.g. temperature for chat. Nil value removes the default.
+func (m *Module) SetDefaultKwarg(funcName, argName string, value starlark.Value) {
+	m.cfgMod.SetDefaultKwarg(funcName, argName, value)
+}
+
+// funcParams lists the parameter names of the functions in order, for the default keyword arguments.
+var funcParams = map[string][]string{
+	"message":    {"role", "text", "image", "image_file", "image_url"},
+	"chat":       {"text", "image", "image_file", "image_url", "messages", "model", "n", "max_tokens", "temperature", "top_p", "frequency_penalty", "presence_penalty", "stop", "response_format", "schema", "repair", "trim", "context_window", "image_max_size", "image_quality", "max_cost", "max_prompt_tokens", "headers", "retry", "full_response", "allow_error"},
+	"draw":       {"prompt", "model", "n", "quality", "size", "style", "response_format", "moderate", "headers", "retry", "full_response", "allow_error"},
+	"summarize":  {"text", "length", "model", "max_tokens", "retry", "allow_error"},
+	"extract":    {"text", "fields", "model", "max_tokens", "retry", "allow_error"},
+	"embed_many": {"texts", "model", "dimensions", "batch_size", "concurrency", "cache", "progress", "retry"},
+	"export":     {"messages", "format", "path", "title"},
+	"set_mock":   {"fn"},
+}
+
 // LoadModule returns the Starlark module loader with the email-specific functions.
 func (m *Module) LoadModule() starlet.ModuleLoader {
 	additionalFuncs := starlark.StringDict{
-		"message": starlark.NewBuiltin("message", newMessageStruct),
-		"chat":    m.genChatFunc(),
-		"draw":    m.genDrawFunc(),
+		"message":    starlark.NewBuiltin("message", newMessageStruct),
+		"chat":       m.genChatFunc(),
+		"draw":       m.genDrawFunc(),
+		"summarize":  m.genSummarizeFunc(),
+		"extract":    m.genExtractFunc(),
+		"embed_many": m.genEmbedManyFunc(),
+		"export":     m.genExportFunc(),
+		"set_mock":   starlark.NewBuiltin(ModuleName+".set_mock", m.setMock),
 	}
-	return m.cfgMod.LoadModule(ModuleName, additionalFuncs)
+	return m.cfgMod.LoadModule(ModuleName, additionalFuncs, funcParams)
 }
 
 var (
@@ -80,12 +121,12 @@ func newMessageStruct(thread *starlark.Thread, b *starlark.Builtin, args starlar
 	var (
 		role          = types.NewNullableStringOrBytes(oai.ChatMessageRoleUser)
 		msgText       = types.NewNullableStringOrBytesNoDefault()
-		msgImageBytes = types.NewNullableStringOrBytesNoDefault()
-		msgImageFile  = types.NewNullableStringOrBytesNoDefault()
-		msgImageURL   = types.NewNullableStringOrBytesNoDefault()
+		msgImageBytes stringOrBytesList
+		msgImageFile  stringOrBytesList
+		msgImageURL   stringOrBytesList
 	)
 	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "role?", role,
-		"text?", msgText, "image?", msgImageBytes, "image_file?", msgImageFile, "image_url?", msgImageURL,
+		"text?", msgText, "image?", &msgImageBytes, "image_file?", &msgImageFile, "image_url?", &msgImageURL,
 	); err != nil {
 		return none, err
 	}
@@ -95,17 +136,15 @@ func newMessageStruct(thread *starlark.Thread, b *starlark.Builtin, args starlar
 
 	// Add key values
 	prepared := map[string]*types.NullableStringOrBytes{
-		"role":       role,
-		"text":       msgText,
-		"image":      msgImageBytes,
-		"image_file": msgImageFile,
-		"image_url":  msgImageURL,
+		"role": role,
+		"text": msgText,
 	}
 	for key, val := range prepared {
 		if !val.IsNullOrEmpty() {
 			md.SetKey(starlark.String(key), val.StarlarkString())
 		}
 	}
+	setImageKeys(md, msgImageBytes, msgImageFile, msgImageURL)
 
 	return md, nil
 }
@@ -121,14 +160,16 @@ func (m *Module) genDrawFunc() starlark.Callable {
 			size           = types.NewNullableStringOrBytes("1024x1024")
 			style          = types.NewNullableStringOrBytes("vivid")
 			responseFormat = types.NewNullableStringOrBytes("url")
+			moderate       = false
 			// call
+			extraHeaders = types.NullableDict{}
 			retryTimes   = 1
 			fullResponse = false
 			allowError   = false
 		)
 		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
-			"prompt", prompt, "model?", userModel, "n?", &numOfChoices, "quality?", quality, "size?", size, "style?", style, "response_format?", responseFormat,
-			"retry?", &retryTimes, "full_response?", &fullResponse, "allow_error?", &allowError,
+			"prompt", prompt, "model?", userModel, "n?", &numOfChoices, "quality?", quality, "size?", size, "style?", style, "response_format?", responseFormat, "moderate?", &moderate,
+			"headers?", &extraHeaders, "retry?", &retryTimes, "full_response?", &fullResponse, "allow_error?", &allowError,
 		); err != nil {
 			return none, err
 		}
@@ -155,30 +196,33 @@ func (m *Module) genDrawFunc() starlark.Callable {
 			ResponseFormat: responseFormat.GoString(),
 		}
 
-		// get client
-		cli, err := m.getClient(model)
+		// get extra headers
+		headers, err := dictToStringMap(extraHeaders.Value())
 		if err != nil {
-			return nil, err
+			return none, err
 		}
 
-		// send request to provider
-		ctx := dataconv.GetThreadContext(thread)
-		var resp oai.ImageResponse
-		for i := 0; i < retryTimes; i++ {
-			resp, err = cli.CreateImage(ctx, req)
-			// if no error, break the loop, got the response
-			if err == nil {
-				break
-			}
-			// if the error is a bad request, break the loop, no need to retry
-			var ae *oai.APIError
-			if errors.As(err, &ae) && ae != nil {
-				if ae.HTTPStatusCode == http.StatusBadRequest {
-					break
-				}
-			}
+		// keep secrets out of the prompt
+		guarded, err := m.cfgMod.GuardSecrets(req.Prompt)
+		if err != nil {
+			return none, err
+		}
+		req.Prompt = guarded[0]
+
+		// check the prompt against content policy
+		if err := m.checkPrompt(thread, req.Prompt, moderate, headers); err != nil {
+			return none, err
 		}
 
+		// get the client before sending, so the config errors are not hidden by allow_error
+		cli, err := m.resolveClient(req.Model, headers)
+		if err != nil {
+			return none, err
+		}
+
+		// send request to provider
+		resp, err := m.sendImageRequest(thread, cli, req, retryTimes)
+
 		// handle error: if allowError is set, return None, otherwise return the error
 		if err != nil {
 			if allowError {
@@ -233,9 +277,9 @@ func (m *Module) genChatFunc() starlark.Callable {
 		var (
 			// message
 			msgText       = types.NewNullableStringOrBytesNoDefault()
-			msgImageBytes = types.NewNullableStringOrBytesNoDefault()
-			msgImageFile  = types.NewNullableStringOrBytesNoDefault()
-			msgImageURL   = types.NewNullableStringOrBytesNoDefault()
+			msgImageBytes stringOrBytesList
+			msgImageFile  stringOrBytesList
+			msgImageURL   stringOrBytesList
 			messages      = types.NewOneOrManyNoDefault[*starlark.Dict]()
 			// model request
 			userModel        = types.NewNullableStringOrBytesNoDefault()
@@ -247,15 +291,27 @@ func (m *Module) genChatFunc() starlark.Callable {
 			presencePenalty  = types.FloatOrInt(0.0)
 			stopSequences    = types.NewOneOrManyNoDefault[starlark.String]()
 			responseFormat   = types.NewNullableStringOrBytes("text")
+			schemaDict       = types.NullableDict{}
+			repairTimes      = 0
+			trimMode         = types.NewNullableStringOrBytes(trimNone)
+			contextWindow    = 0
+			imageMaxSize     = 0
+			imageQuality     = 0
+			maxCost          = types.FloatOrInt(0)
+			maxPromptTokens  = 0
 			// call
+			extraHeaders = types.NullableDict{}
 			retryTimes   = 1
 			fullResponse = false
 			allowError   = false
 		)
 		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
-			"text?", msgText, "image?", msgImageBytes, "image_file?", msgImageFile, "image_url?", msgImageURL, "messages?", messages,
+			"text?", msgText, "image?", &msgImageBytes, "image_file?", &msgImageFile, "image_url?", &msgImageURL, "messages?", messages,
 			"model?", userModel, "n?", &numOfChoices, "max_tokens?", &maxTokens, "temperature?", &temperature, "top_p?", &topP, "frequency_penalty?", &frequencyPenalty, "presence_penalty?", &presencePenalty, "stop?", stopSequences, "response_format?", responseFormat,
-			"retry?", &retryTimes, "full_response?", &fullResponse, "allow_error?", &allowError,
+			"schema?", &schemaDict, "repair?", &repairTimes,
+			"trim?", trimMode, "context_window?", &contextWindow, "image_max_size?", &imageMaxSize, "image_quality?", &imageQuality,
+			"max_cost?", &maxCost, "max_prompt_tokens?", &maxPromptTokens,
+			"headers?", &extraHeaders, "retry?", &retryTimes, "full_response?", &fullResponse, "allow_error?", &allowError,
 		); err != nil {
 			return none, err
 		}
@@ -269,24 +325,30 @@ func (m *Module) genChatFunc() starlark.Callable {
 		// history messages, prepend user message if defined
 		allMsgs := messages.Slice()
 		usrMd := starlark.NewDict(1)
-		prepared := map[string]*types.NullableStringOrBytes{
-			"text":       msgText,
-			"image":      msgImageBytes,
-			"image_file": msgImageFile,
-			"image_url":  msgImageURL,
-		}
-		for key, val := range prepared {
-			if !val.IsNullOrEmpty() {
-				usrMd.SetKey(starlark.String(key), val.StarlarkString())
-			}
+		if !msgText.IsNullOrEmpty() {
+			usrMd.SetKey(starlark.String("text"), msgText.StarlarkString())
 		}
+		setImageKeys(usrMd, msgImageBytes, msgImageFile, msgImageURL)
 		if usrMd.Len() > 0 {
 			usrMd.SetKey(starlark.String("role"), starlark.String(oai.ChatMessageRoleUser))
 			allMsgs = append([]*starlark.Dict{usrMd}, allMsgs...)
 		}
 
-		// convert to OpenAI chat messages
-		chatMessages, err := messagesToChatMessages(allMsgs)
+		// convert to OpenAI chat messages, images are downscaled and compressed if required
+		imgOpt := imageOptions{maxSize: imageMaxSize, quality: imageQuality}
+		if err := imgOpt.validate(); err != nil {
+			return none, err
+		}
+		chatMessages, err := messagesToChatMessages(allMsgs, imgOpt)
+		if err != nil {
+			return none, err
+		}
+
+		// trim messages to fit in the context window, the user message of this call is always kept
+		if contextWindow <= 0 {
+			contextWindow = contextWindowSize(model)
+		}
+		chatMessages, err = trimMessages(chatMessages, trimMode.GoString(), contextWindow, maxTokens, usrMd.Len() > 0)
 		if err != nil {
 			return none, err
 		}
@@ -305,10 +367,25 @@ func (m *Module) genChatFunc() starlark.Callable {
 			PresencePenalty:  presencePenalty.GoFloat32(),
 			FrequencyPenalty: frequencyPenalty.GoFloat32(),
 		}
-		if rf := responseFormat.GoString(); rf == "json" {
+		var schema *jsonSchema
+		if sd := schemaDict.Value(); sd != nil {
+			if schema, err = parseSchemaDict(sd); err != nil {
+				return none, err
+			}
+		}
+		if rf := responseFormat.GoString(); rf == "json" || rf == "json_schema" {
 			req.ResponseFormat = &oai.ChatCompletionResponseFormat{
 				Type: oai.ChatCompletionResponseFormatTypeJSONObject,
 			}
+			// for json_schema, the schema is given to the model as system message
+			if rf == "json_schema" {
+				if schema == nil {
+					return none, errors.New("schema is required for json_schema response format")
+				}
+				req.Messages = append([]oai.ChatCompletionMessage{{Role: oai.ChatMessageRoleSystem, Content: fmt.Sprintf(schemaPrompt, schema.raw)}}, req.Messages...)
+			}
+		} else if schema != nil {
+			return none, fmt.Errorf("schema is only supported for json or json_schema response format, got %s", rf)
 		} else if rf == "text" {
 			req.ResponseFormat = &oai.ChatCompletionResponseFormat{
 				Type: oai.ChatCompletionResponseFormatTypeText,
@@ -317,30 +394,26 @@ func (m *Module) genChatFunc() starlark.Callable {
 			return none, fmt.Errorf("unsupported response format: %s", rf)
 		}
 
-		// get client
-		cli, err := m.getClient(model)
+		// get extra headers
+		headers, err := dictToStringMap(extraHeaders.Value())
 		if err != nil {
-			return nil, err
+			return none, err
 		}
 
-		// send request to provider
-		ctx := dataconv.GetThreadContext(thread)
-		var resp oai.ChatCompletionResponse
-		for i := 0; i < retryTimes; i++ {
-			resp, err = cli.CreateChatCompletion(ctx, req)
-			// if no error, break the loop, got the response
-			if err == nil {
-				break
-			}
-			// if the error is a bad request, break the loop, no need to retry
-			var ae *oai.APIError
-			if errors.As(err, &ae) && ae != nil {
-				if ae.HTTPStatusCode == http.StatusBadRequest {
-					break
-				}
-			}
+		// refuse the request if it's too large or too expensive
+		if err := m.checkCost(req, maxCost.GoFloat64(), maxPromptTokens); err != nil {
+			return none, err
 		}
 
+		// get the client before sending, so the config errors are not hidden by allow_error
+		cli, err := m.resolveClient(req.Model, headers)
+		if err != nil {
+			return none, err
+		}
+
+		// send request to provider
+		resp, err := m.sendChatRequest(thread, cli, req, retryTimes)
+
 		// handle error: if allowError is set, return None, otherwise return the error
 		if err != nil {
 			if allowError {
@@ -349,6 +422,17 @@ func (m *Module) genChatFunc() starlark.Callable {
 			return none, err
 		}
 
+		// validate the JSON contents against the schema, and return the parsed values
+		var parsed []starlark.Value
+		if schema != nil {
+			if parsed, err = m.validateChoices(thread, cli, req, retryTimes, maxCost.GoFloat64(), maxPromptTokens, &resp, schema, repairTimes); err != nil {
+				if allowError {
+					return none, nil
+				}
+				return none, err
+			}
+		}
+
 		// return the response: if fullResponse is set, return the full response, otherwise return the content
 		if fullResponse {
 			return dataconv.GoToStarlarkViaJSON(&resp)
@@ -356,6 +440,12 @@ func (m *Module) genChatFunc() starlark.Callable {
 		if len(resp.Choices) == 0 {
 			return none, nil
 		}
+		if parsed != nil {
+			if numOfChoices == 1 {
+				return parsed[0], nil
+			}
+			return starlark.NewList(parsed), nil
+		}
 		// if numOfChoices is 1, return the content string, otherwise return a list of contents
 		if numOfChoices == 1 {
 			return starlark.String(resp.Choices[0].Message.Content), nil
@@ -368,15 +458,85 @@ func (m *Module) genChatFunc() starlark.Callable {
 	})
 }
 
-// SetClient sets the OpenAI client for this module.
+// sendChatRequest sends the chat completion request to the provider, and retries on errors except bad requests.
+// The configured secrets in the messages are blocked or redacted in place first, so every caller gets the guard.
+// In dry-run mode, the request is sent to the mock function instead, and the client from resolveClient is nil.
+func (m *Module) sendChatRequest(thread *starlark.Thread, cli *oai.Client, req oai.ChatCompletionRequest, retryTimes int) (resp oai.ChatCompletionResponse, err error) {
+	// keep secrets out of the messages
+	if err := m.guardMessages(req.Messages); err != nil {
+		return resp, err
+	}
+	if m.dryRun {
+		return m.mockChat(thread, req)
+	}
+	ctx := dataconv.GetThreadContext(thread)
+	for i := 0; i < retryTimes; i++ {
+		resp, err = cli.CreateChatCompletion(ctx, req)
+		// if no error, break the loop, got the response
+		if err == nil {
+			break
+		}
+		// if the error is a bad request, break the loop, no need to retry
+		var ae *oai.APIError
+		if errors.As(err, &ae) && ae != nil {
+			if ae.HTTPStatusCode == http.StatusBadRequest {
+				break
+			}
+		}
+	}
+	return resp, err
+}
+
+// sendImageRequest sends the image generation request to the provider, and retries on errors except bad requests.
+// In dry-run mode, the request is sent to the mock function instead, and the client from resolveClient is nil.
+func (m *Module) sendImageRequest(thread *starlark.Thread, cli *oai.Client, req oai.ImageRequest, retryTimes int) (resp oai.ImageResponse, err error) {
+	if m.dryRun {
+		return m.mockImage(thread, req)
+	}
+	ctx := dataconv.GetThreadContext(thread)
+	for i := 0; i < retryTimes; i++ {
+		resp, err = cli.CreateImage(ctx, req)
+		// if no error, break the loop, got the response
+		if err == nil {
+			break
+		}
+		// if the error is a bad request, break the loop, no need to retry
+		var ae *oai.APIError
+		if errors.As(err, &ae) && ae != nil {
+			if ae.HTTPStatusCode == http.StatusBadRequest {
+				break
+			}
+		}
+	}
+	return resp, err
+}
+
+// SetClient sets the OpenAI client for this module. The client is used as is, so the requests with extra headers, organization
+// or project IDs fail instead of sending without them.
 func (m *Module) SetClient(cli *oai.Client) {
 	m.cli = cli
 }
 
-// getClient retrieves the OpenAI client for this module.
-func (m *Module) getClient(model string) (*oai.Client, error) {
+// resolveClient retrieves the OpenAI client for the requests, or nil in dry-run mode where the requests are sent to the mock function.
+func (m *Module) resolveClient(model string, headers map[string]string) (*oai.Client, error) {
+	if m.dryRun {
+		return nil, nil
+	}
+	return m.getClient(model, headers)
+}
+
+// getClient retrieves the OpenAI client for this module, the extra headers are sent with each request of the new client.
+func (m *Module) getClient(model string, headers map[string]string) (*oai.Client, error) {
 	if m.cli != nil {
-		// use the existing client
+		// use the existing client, which can't carry the extra headers
+		if len(headers) > 0 {
+			return nil, errors.New("headers are not supported with the client set by host")
+		}
+		for _, key := range []string{"openai_org_id", "openai_project_id"} {
+			if id, err := m.cfgMod.GetConfig(key); err == nil && id != "" {
+				return nil, fmt.Errorf("%s is not supported with the client set by host", key)
+			}
+		}
 		return m.cli, nil
 	}
 
@@ -411,10 +571,42 @@ func (m *Module) getClient(model string) (*oai.Client, error) {
 		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
 
+	// set organization and project for routing
+	if orgID, err := m.cfgMod.GetConfig("openai_org_id"); err == nil {
+		cfg.OrgID = orgID
+	}
+	allHeaders := make(map[string]string)
+	if projectID, err := m.cfgMod.GetConfig("openai_project_id"); err == nil && projectID != "" {
+		allHeaders["OpenAI-Project"] = projectID
+	}
+	for k, v := range headers {
+		allHeaders[k] = v
+	}
+	if len(allHeaders) > 0 {
+		cfg.HTTPClient = &http.Client{
+			Transport: &headerTransport{base: http.DefaultTransport, headers: allHeaders},
+		}
+	}
+
 	// create a new client
 	return oai.NewClientWithConfig(cfg), nil
 }
 
+// headerTransport is an http.RoundTripper that adds extra headers to each request, e.g. for API gateways.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	for k, v := range t.headers {
+		r.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(r)
+}
+
 // getModel retrieves the model name.
 // If modelVal is empty, it will use the modelKey to retrieve the model value from the configuration.
 func (m *Module) getModel(key, val string) string {
@@ -448,44 +640,137 @@ func getStringFromDict(d *starlark.Dict, key string) (string, bool) {
 	return emptyStr, false
 }
 
-// imageFileToBase64 reads file and convert it to base64 data.
-func imageFileToBase64(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
+// getStringsFromDict retrieves a list of non-empty strings from a dictionary, the value can be a string or a list of strings.
+func getStringsFromDict(d *starlark.Dict, key string) ([]string, bool) {
+	v, ok, err := d.Get(starlark.String(key))
+	if err != nil || !ok || v == nil {
+		return nil, false
 	}
-	defer file.Close()
+	var l stringOrBytesList
+	if err := l.Unpack(v); err != nil || len(l) == 0 {
+		return nil, false
+	}
+	return l, true
+}
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return "", err
+// stringOrBytesList is an Unpacker that converts a Starlark string, bytes, or an iterable of them to a slice of non-empty Go strings.
+type stringOrBytesList []string
+
+// Unpack implements starlark.Unpacker.
+func (l *stringOrBytesList) Unpack(v starlark.Value) error {
+	asString := func(x starlark.Value) (string, bool) {
+		switch s := x.(type) {
+		case starlark.String:
+			return string(s), true
+		case starlark.Bytes:
+			return string(s), true
+		}
+		return emptyStr, false
 	}
 
-	fileSize := fileInfo.Size()
-	fileBuffer := make([]byte, fileSize)
+	// single value or None
+	if _, ok := v.(starlark.NoneType); ok {
+		*l = nil
+		return nil
+	}
+	if s, ok := asString(v); ok {
+		*l = nil
+		if s != emptyStr {
+			*l = []string{s}
+		}
+		return nil
+	}
 
-	bytesRead, err := file.Read(fileBuffer)
-	if err != nil {
-		return "", err
+	// list, tuple or set of values
+	iter, ok := v.(starlark.Iterable)
+	if !ok {
+		return fmt.Errorf("got %s, want string, bytes, or iterable", v.Type())
 	}
-	if bytesRead != int(fileSize) {
-		return "", fmt.Errorf("expected to read %d bytes but read %d", fileSize, bytesRead)
+	it := iter.Iterate()
+	defer it.Done()
+	var (
+		x   starlark.Value
+		res []string
+	)
+	for it.Next(&x) {
+		s, ok := asString(x)
+		if !ok {
+			return fmt.Errorf("got %s in iterable, want string or bytes", x.Type())
+		}
+		if s != emptyStr {
+			res = append(res, s)
+		}
 	}
+	*l = res
+	return nil
+}
+
+// starlarkValue returns a single string for one element, or a list of strings for many.
+func (l stringOrBytesList) starlarkValue() starlark.Value {
+	if len(l) == 1 {
+		return starlark.String(l[0])
+	}
+	res := make([]starlark.Value, len(l))
+	for i, s := range l {
+		res[i] = starlark.String(s)
+	}
+	return starlark.NewList(res)
+}
 
-	base64Data := base64.StdEncoding.EncodeToString(fileBuffer)
+// setImageKeys sets the image related keys to the message dictionary if they are not empty.
+func setImageKeys(md *starlark.Dict, imageBytes, imageFiles, imageURLs stringOrBytesList) {
+	prepared := map[string]stringOrBytesList{
+		"image":      imageBytes,
+		"image_file": imageFiles,
+		"image_url":  imageURLs,
+	}
+	for key, val := range prepared {
+		if len(val) > 0 {
+			md.SetKey(starlark.String(key), val.starlarkValue())
+		}
+	}
+}
+
+// dictToStringMap converts a Starlark dictionary to a map of strings, nil dictionary results in nil map.
+func dictToStringMap(d *starlark.Dict) (map[string]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+	res := make(map[string]string, d.Len())
+	for _, it := range d.Items() {
+		k, ok := starlark.AsString(it[0])
+		if !ok {
+			return nil, fmt.Errorf("header name must be a string, got %s", it[0].Type())
+		}
+		res[k] = dataconv.StarString(it[1])
+	}
+	return res, nil
+}
+
+// imageFileToBase64 reads file and convert it to base64 data.
+func imageFileToBase64(filePath string, opt imageOptions) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
 	mimeType := mime.TypeByExtension(filepath.Ext(filePath))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	data, mimeType = processImage(data, mimeType, opt)
+	base64Data := base64.StdEncoding.EncodeToString(data)
 	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data), nil
 }
 
 // imageDataToBase64 converts image data to base64 data.
-func imageDataToBase64(data []byte) string {
+func imageDataToBase64(data []byte, opt imageOptions) string {
+	data, mimeType := processImage(data, http.DetectContentType(data), opt)
 	base64Data := base64.StdEncoding.EncodeToString(data)
-	mimeType := http.DetectContentType(data)
 	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data)
 }
 
 // messagesToChatMessages converts a list of messages in starlark Dictionary to a list of OpenAI chat messages.
-func messagesToChatMessages(msgs []*starlark.Dict) ([]oai.ChatCompletionMessage, error) {
+func messagesToChatMessages(msgs []*starlark.Dict, imgOpt imageOptions) ([]oai.ChatCompletionMessage, error) {
 	var res []oai.ChatCompletionMessage
 	for i, md := range msgs {
 		msg := oai.ChatCompletionMessage{}
@@ -497,9 +782,9 @@ func messagesToChatMessages(msgs []*starlark.Dict) ([]oai.ChatCompletionMessage,
 
 		// get the content
 		text, okT := getStringFromDict(md, "text")
-		imageBytes, okI := getStringFromDict(md, "image")
-		imageFile, okF := getStringFromDict(md, "image_file")
-		imageURL, okU := getStringFromDict(md, "image_url")
+		imageBytes, okI := getStringsFromDict(md, "image")
+		imageFiles, okF := getStringsFromDict(md, "image_file")
+		imageURLs, okU := getStringsFromDict(md, "image_url")
 		okImg := okI || okF || okU
 
 		// if all are empty, return an error
@@ -523,7 +808,7 @@ func messagesToChatMessages(msgs []*starlark.Dict) ([]oai.ChatCompletionMessage,
 				Text: text,
 			})
 		}
-		if okU { // for image URL part
+		for _, imageURL := range imageURLs { // for image URL parts
 			mcp = append(mcp, oai.ChatMessagePart{
 				Type: oai.ChatMessagePartTypeImageURL,
 				ImageURL: &oai.ChatMessageImageURL{
@@ -532,8 +817,8 @@ func messagesToChatMessages(msgs []*starlark.Dict) ([]oai.ChatCompletionMessage,
 				},
 			})
 		}
-		if okI { // for image content part, convert to mime & base64
-			b64 := imageDataToBase64([]byte(imageBytes))
+		for _, imageData := range imageBytes { // for image content parts, convert to mime & base64
+			b64 := imageDataToBase64([]byte(imageData), imgOpt)
 			mcp = append(mcp, oai.ChatMessagePart{
 				Type: oai.ChatMessagePartTypeImageURL,
 				ImageURL: &oai.ChatMessageImageURL{
@@ -542,8 +827,8 @@ func messagesToChatMessages(msgs []*starlark.Dict) ([]oai.ChatCompletionMessage,
 				},
 			})
 		}
-		if okF { // for image file part, read and convert to mime & base64
-			b64, err := imageFileToBase64(imageFile)
+		for _, imageFile := range imageFiles { // for image file parts, read and convert to mime & base64
+			b64, err := imageFileToBase64(imageFile, imgOpt)
 			if err != nil {
 				return nil, fmt.Errorf("message %d: %w", i+1, err)
 			}
@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/1set/starlet/dataconv"
+	oai "github.com/sashabaranov/go-openai"
+	"go.starlark.net/starlark"
+)
+
+var (
+	schemaPrompt = "Reply with a JSON object that conforms to this JSON schema:\n%s"
+	repairPrompt = "The JSON you replied is invalid:\n%s\nReply with the fixed JSON only."
+)
+
+// jsonSchema is a parsed JSON schema, only a subset of keywords is supported for validation:
+// type, properties, required, additionalProperties, items, enum, minimum, maximum, minLength, maxLength, minItems, maxItems.
+type jsonSchema struct {
+	raw  string
+	root map[string]interface{}
+}
+
+// parseSchemaDict converts the Starlark dict to JSON schema.
+func parseSchemaDict(d *starlark.Dict) (*jsonSchema, error) {
+	raw, err := dataconv.EncodeStarlarkJSON(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &jsonSchema{raw: raw, root: root}, nil
+}
+
+// validate parses the content as JSON and validates it against the schema, and returns the parsed value or the list of problems.
+func (s *jsonSchema) validate(content string) (starlark.Value, []string) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return nil, []string{"not a valid JSON: " + err.Error()}
+	}
+	if probs := validateSchemaValue(v, s.root, "$"); len(probs) > 0 {
+		return nil, probs
+	}
+	sv, err := dataconv.DecodeStarlarkJSON([]byte(content))
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	return sv, nil
+}
+
+// validateSchemaValue validates the decoded JSON value against the schema node, and returns the problems found with their paths.
+func validateSchemaValue(v interface{}, node map[string]interface{}, path string) []string {
+	var probs []string
+	addf := func(format string, args ...interface{}) {
+		probs = append(probs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	// check type and enum first, the rest makes no sense if type is mismatched
+	if t, ok := node["type"]; ok && !matchSchemaType(v, t) {
+		addf("got %s, want %v", jsonTypeName(v), t)
+		return probs
+	}
+	if enum, ok := node["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addf("value is not one of %v", enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		props, _ := node["properties"].(map[string]interface{})
+		if req, ok := node["required"].([]interface{}); ok {
+			for _, r := range req {
+				if name, ok := r.(string); ok {
+					if _, found := val[name]; !found {
+						addf("missing required property %q", name)
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(map[string]interface{}); ok {
+				probs = append(probs, validateSchemaValue(val[k], ps, path+"."+k)...)
+			} else if ap, ok := node["additionalProperties"]; ok {
+				if allowed, isBool := ap.(bool); isBool && !allowed {
+					addf("unexpected property %q", k)
+				} else if aps, isMap := ap.(map[string]interface{}); isMap {
+					probs = append(probs, validateSchemaValue(val[k], aps, path+"."+k)...)
+				}
+			}
+		}
+	case []interface{}:
+		if n, ok := schemaNumber(node, "minItems"); ok && float64(len(val)) < n {
+			addf("got %d items, want at least %v", len(val), n)
+		}
+		if n, ok := schemaNumber(node, "maxItems"); ok && float64(len(val)) > n {
+			addf("got %d items, want at most %v", len(val), n)
+		}
+		if items, ok := node["items"].(map[string]interface{}); ok {
+			for i, it := range val {
+				probs = append(probs, validateSchemaValue(it, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		l := float64(len([]rune(val)))
+		if n, ok := schemaNumber(node, "minLength"); ok && l < n {
+			addf("string is shorter than %v", n)
+		}
+		if n, ok := schemaNumber(node, "maxLength"); ok && l > n {
+			addf("string is longer than %v", n)
+		}
+	case float64:
+		if n, ok := schemaNumber(node, "minimum"); ok && val < n {
+			addf("%v is less than minimum %v", val, n)
+		}
+		if n, ok := schemaNumber(node, "maximum"); ok && val > n {
+			addf("%v is greater than maximum %v", val, n)
+		}
+	}
+	return probs
+}
+
+// matchSchemaType reports whether the value matches the type or any of the types in the schema.
+func matchSchemaType(v interface{}, t interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		actual := jsonTypeName(v)
+		return actual == tt || (tt == "number" && actual == "integer")
+	case []interface{}:
+		for _, x := range tt {
+			if matchSchemaType(v, x) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// jsonTypeName returns the JSON schema type name of the decoded JSON value.
+func jsonTypeName(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// schemaNumber returns the number value of the keyword in the schema node.
+func schemaNumber(node map[string]interface{}, key string) (float64, bool) {
+	n, ok := node[key].(float64)
+	return n, ok
+}
+
+// jsonEqual reports whether the two decoded JSON values are equal.
+func jsonEqual(a, b interface{}) bool {
+	ba, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ba) == string(bb)
+}
+
+// validateChoices validates the content of each choice against the schema, and asks the model to fix the invalid JSON for at most repairTimes.
+// The content of choices is replaced with the fixed one, and the parsed values are returned. Each repair request is checked against
+// the same cost limits as the original one.
+func (m *Module) validateChoices(thread *starlark.Thread, cli *oai.Client, req oai.ChatCompletionRequest, retryTimes int, maxCost float64, maxPromptTokens int, resp *oai.ChatCompletionResponse, schema *jsonSchema, repairTimes int) ([]starlark.Value, error) {
+	res := make([]starlark.Value, len(resp.Choices))
+	for i := range resp.Choices {
+		content := resp.Choices[i].Message.Content
+		val, probs := schema.validate(content)
+		for attempt := 0; len(probs) > 0 && attempt < repairTimes; attempt++ {
+			log.Debugw("repair invalid JSON", "choice", i, "attempt", attempt+1, "problems", probs)
+
+			// follow up with the invalid reply and problems
+			fixReq := req
+			fixReq.N = 1
+			fixReq.Messages = append(append([]oai.ChatCompletionMessage{}, req.Messages...),
+				oai.ChatCompletionMessage{Role: oai.ChatMessageRoleAssistant, Content: content},
+				oai.ChatCompletionMessage{Role: oai.ChatMessageRoleUser, Content: fmt.Sprintf(repairPrompt, strings.Join(probs, "\n"))},
+			)
+			if err := m.checkCost(fixReq, maxCost, maxPromptTokens); err != nil {
+				return nil, err
+			}
+			fixResp, err := m.sendChatRequest(thread, cli, fixReq, retryTimes)
+			if err != nil {
+				return nil, err
+			}
+			if len(fixResp.Choices) == 0 {
+				break
+			}
+			content = fixResp.Choices[0].Message.Content
+			val, probs = schema.validate(content)
+		}
+		if len(probs) > 0 {
+			return nil, fmt.Errorf("choice %d does not match schema: %s", i, strings.Join(probs, "; "))
+		}
+		resp.Choices[i].Message.Content = content
+		res[i] = val
+	}
+	return res, nil
+}
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	oai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	trimNone   = "none"
+	trimOldest = "oldest"
+	trimMiddle = "middle"
+)
+
+// contextWindows maps model name prefixes to their context window sizes in tokens, longer prefixes come first.
+var contextWindows = []struct {
+	prefix string
+	size   int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-1106", 128000},
+	{"gpt-4-0125", 128000},
+	{"gpt-4-vision", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo-instruct", 4096},
+	{"gpt-3.5-turbo", 16385},
+	{"o1", 128000},
+}
+
+// contextWindowSize returns the context window size of the model, or 0 if unknown.
+func contextWindowSize(model string) int {
+	model = strings.ToLower(model)
+	for _, cw := range contextWindows {
+		if strings.HasPrefix(model, cw.prefix) {
+			return cw.size
+		}
+	}
+	return 0
+}
+
+// estimateTokens roughly estimates the number of prompt tokens of the messages, i.e. 4 characters per token,
+// plus the overhead of each message and a fixed cost for each image.
+func estimateTokens(msgs []oai.ChatCompletionMessage) int {
+	const (
+		msgOverhead = 4
+		imageTokens = 765
+	)
+	cnt := 3 // every reply is primed with the assistant role
+	for _, msg := range msgs {
+		cnt += msgOverhead + textTokens(msg.Role) + textTokens(msg.Content)
+		for _, p := range msg.MultiContent {
+			if p.Type == oai.ChatMessagePartTypeImageURL {
+				cnt += imageTokens
+			} else {
+				cnt += textTokens(p.Text)
+			}
+		}
+	}
+	return cnt
+}
+
+// textTokens roughly estimates the number of tokens of the text.
+func textTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// trimMessages drops messages until the estimated prompt tokens fit in the context window minus the completion tokens.
+// System messages and the last message are always kept, so is the first message if keepFirst is set.
+// The mode "oldest" drops messages from the beginning, "middle" drops messages from the middle, and "none" keeps all messages.
+func trimMessages(msgs []oai.ChatCompletionMessage, mode string, contextWindow, maxTokens int, keepFirst bool) ([]oai.ChatCompletionMessage, error) {
+	switch mode {
+	case "", trimNone:
+		return msgs, nil
+	case trimOldest, trimMiddle:
+	default:
+		return nil, fmt.Errorf("unsupported trim mode: %s", mode)
+	}
+
+	// unknown context window, nothing to do
+	if contextWindow <= 0 {
+		log.Warnw("unknown context window, skip trimming", "mode", mode)
+		return msgs, nil
+	}
+	budget := contextWindow - maxTokens
+	if estimateTokens(msgs) <= budget {
+		return msgs, nil
+	}
+
+	// find the indexes of droppable messages
+	var droppable []int
+	for i, msg := range msgs {
+		if msg.Role == oai.ChatMessageRoleSystem || i == len(msgs)-1 || (keepFirst && i == 0) {
+			continue
+		}
+		droppable = append(droppable, i)
+	}
+
+	// drop messages one by one in the order of the mode
+	dropped := make(map[int]bool)
+	kept := func() []oai.ChatCompletionMessage {
+		res := make([]oai.ChatCompletionMessage, 0, len(msgs)-len(dropped))
+		for i, msg := range msgs {
+			if !dropped[i] {
+				res = append(res, msg)
+			}
+		}
+		return res
+	}
+	for len(droppable) > 0 {
+		var pos int
+		if mode == trimMiddle {
+			pos = len(droppable) / 2
+		}
+		dropped[droppable[pos]] = true
+		droppable = append(droppable[:pos], droppable[pos+1:]...)
+		if res := kept(); estimateTokens(res) <= budget {
+			log.Debugw("messages trimmed", "mode", mode, "dropped", len(dropped), "kept", len(res))
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("messages exceed the context window of %d tokens even after trimming", contextWindow)
+}